@@ -12,8 +12,12 @@ import (
 	"time"
 
 	"prometheus-dingtalk-hook/internal/admin"
+	"prometheus-dingtalk-hook/internal/capture"
+	"prometheus-dingtalk-hook/internal/dedup"
+	"prometheus-dingtalk-hook/internal/dingtalk"
 	"prometheus-dingtalk-hook/internal/reload"
 	"prometheus-dingtalk-hook/internal/runtime"
+	"prometheus-dingtalk-hook/internal/sendlog"
 	"prometheus-dingtalk-hook/internal/server"
 )
 
@@ -25,17 +29,38 @@ var (
 
 func main() {
 	var configPath string
+	var logFormat string
+	var checkConfig, checkStrict bool
 	flag.StringVar(&configPath, "config", "config.yaml", "Path to YAML config file")
+	flag.BoolVar(&runtime.ForceDryRun, "dry-run", false, "Log DingTalk messages instead of sending them (overrides dingtalk.dry_run)")
+	flag.StringVar(&logFormat, "log-format", "logfmt", "Log output format: logfmt or json")
+	flag.BoolVar(&checkConfig, "check-config", false, "Load the config and build the runtime, including templates, then exit without starting the server")
+	flag.BoolVar(&checkStrict, "check-config.strict", false, "With -check-config, also warn about unused robots and channels no route sends to")
 	flag.Parse()
 
 	// 输出版本信息
 	fmt.Printf("prometheus-dingtalk-hook %s (commit: %s, built at: %s)\n", version, commit, date)
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	logOpts := &slog.HandlerOptions{
 		Level: slog.LevelInfo,
-	}))
+	}
+	var logHandler slog.Handler
+	switch logFormat {
+	case "logfmt":
+		logHandler = slog.NewTextHandler(os.Stdout, logOpts)
+	case "json":
+		logHandler = slog.NewJSONHandler(os.Stdout, logOpts)
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -log-format %q: must be logfmt or json\n", logFormat)
+		os.Exit(2)
+	}
+	logger := slog.New(logHandler)
 	slog.SetDefault(logger)
 
+	if checkConfig || checkStrict {
+		os.Exit(runCheckConfig(logger, configPath, checkStrict))
+	}
+
 	rt, err := runtime.LoadFromFile(logger, configPath)
 	if err != nil {
 		logger.Error("load config failed", "err", err)
@@ -44,23 +69,33 @@ func main() {
 
 	store := runtime.NewStore(rt)
 
-	reloadMgr, err := reload.New(logger, configPath, store, rt.Config.Reload.Enabled, rt.Config.Reload.Interval.Duration())
+	reloadMgr, err := reload.New(logger, configPath, store, rt.Config.Reload.Enabled, rt.Config.Reload.Mode, rt.Config.Reload.Interval.Duration())
 	if err != nil {
 		logger.Error("init reload failed", "err", err)
 		os.Exit(1)
 	}
 
+	captured := capture.New()
+	sendLog := sendlog.New(sendlog.DefaultMax)
+	sends := sendlog.NewHistory()
+	dedupCache := dedup.New()
+	dispatcher := server.NewDispatcher()
+
 	adminHandler := admin.New(admin.Options{
 		Logger:     logger,
 		ConfigPath: configPath,
 		Store:      store,
 		Reload:     reloadMgr,
+		Capture:    captured,
+		SendLog:    sendLog,
+		Sends:      sends,
 	})
 
 	srv := server.New(server.Options{
 		Logger:       logger,
 		ListenAddr:   rt.Config.Server.Listen,
 		AlertPath:    rt.Config.Server.Path,
+		StrictPath:   rt.Config.Server.StrictPath,
 		AdminPrefix:  rt.Config.Admin.PathPrefix,
 		AdminHandler: adminHandler,
 		State:        store,
@@ -69,23 +104,52 @@ func main() {
 		WriteTimeout: rt.Config.Server.WriteTimeout.Duration(),
 		IdleTimeout:  rt.Config.Server.IdleTimeout.Duration(),
 		MaxBodyBytes: rt.Config.Server.MaxBodyBytes,
+		Capture:      captured,
+		SendLog:      sendLog,
+		Sends:        sends,
+		Dedup:        dedupCache,
+		Dispatcher:   dispatcher,
+		TLSCertFile:  rt.Config.Server.TLSCertFile,
+		TLSKeyFile:   rt.Config.Server.TLSKeyFile,
+
+		TelemetryListen: rt.Config.Server.TelemetryListen,
 	})
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
 	reloadMgr.Start(ctx)
+	go dedupCache.Run(ctx, time.Minute, func() time.Duration {
+		return store.Load().MaxDedupWindow()
+	})
+
+	if rt.Config.DingTalk.StartupDNSCheck {
+		go checkWebhookDNS(ctx, logger, rt)
+	}
 
+	// ListenAndServe returns as soon as Shutdown starts; main waits on
+	// drained so in-flight requests and their sends are not cut off.
+	drained := make(chan struct{})
 	go func() {
+		defer close(drained)
 		<-ctx.Done()
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), store.Load().Config.Server.ShutdownTimeout.Duration())
 		defer cancel()
-		_ = srv.Shutdown(shutdownCtx)
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("server shutdown incomplete", "err", err)
+		}
+		stats := dispatcher.Drain(shutdownCtx)
+		if stats.Abandoned > 0 {
+			logger.Warn("shutdown abandoned in-flight sends", "flushed", stats.Flushed, "abandoned", stats.Abandoned)
+		} else {
+			logger.Info("in-flight sends drained", "flushed", stats.Flushed)
+		}
 	}()
 
-	logger.Info("starting server", "listen", rt.Config.Server.Listen, "path", rt.Config.Server.Path)
+	logger.Info("starting server", "listen", rt.Config.Server.Listen, "telemetry_listen", rt.Config.Server.TelemetryListen, "path", rt.Config.Server.Path, "tls", rt.TLSCertificate != nil, "dry_run", rt.DingTalk.DryRun())
 	if err := srv.ListenAndServe(); err != nil {
 		if err == server.ErrServerClosed {
+			<-drained
 			logger.Info("server closed")
 			return
 		}
@@ -94,3 +158,41 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// runCheckConfig loads and builds the config at path as startup would and
+// returns the exit code: 0 when it is valid, 1 otherwise. Loading logs the
+// config's warnings; with strict they are also printed to stderr, still
+// without failing the check.
+func runCheckConfig(logger *slog.Logger, path string, strict bool) int {
+	rt, err := runtime.LoadFromFile(logger, path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config %s is invalid: %v\n", path, err)
+		return 1
+	}
+	if strict {
+		for _, w := range rt.Warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+		}
+	}
+	fmt.Printf("config %s is valid\n", path)
+	return 0
+}
+
+// checkWebhookDNS logs robots whose webhook host does not resolve. It does
+// not block startup; a failure is only reported, never fatal.
+func checkWebhookDNS(ctx context.Context, logger *slog.Logger, rt *runtime.Runtime) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	webhooks := make(map[string]string, len(rt.Robots))
+	for name, robot := range rt.Robots {
+		webhooks[name] = robot.Webhook
+	}
+	failures := dingtalk.CheckWebhookDNS(ctx, nil, webhooks)
+	for _, f := range failures {
+		logger.Warn("webhook host does not resolve", "robot", f.Robot, "host", f.Host, "err", f.Err)
+	}
+	if len(failures) == 0 {
+		logger.Info("webhook dns check ok", "robots", len(webhooks))
+	}
+}
@@ -0,0 +1,189 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+)
+
+// auditEntry is one line of the audit log. Endpoint is the request method
+// and path; SHA256 is the hash of the written content, so a change can be
+// matched to a file without logging content that may hold secrets.
+type auditEntry struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`
+	Remote   string    `json:"remote"`
+	Endpoint string    `json:"endpoint"`
+	Action   string    `json:"action"`
+	Summary  string    `json:"summary,omitempty"`
+	SHA256   string    `json:"sha256,omitempty"`
+	Result   string    `json:"result"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// audit records a mutating admin action. Summaries must only name what
+// changed, never secret values. Entries go to admin.audit.file as JSON lines,
+// or to the application log when no file is configured.
+func (h *handler) audit(r *http.Request, action, summary string, actionErr error) {
+	h.auditContent(r, action, summary, nil, actionErr)
+}
+
+// auditContent is audit for actions that write content, which is recorded
+// by its SHA-256 hash.
+func (h *handler) auditContent(r *http.Request, action, summary string, content []byte, actionErr error) {
+	if h.store == nil {
+		return
+	}
+	rt := h.store.Load()
+	if rt == nil || rt.Config == nil || !rt.Config.Admin.Audit.Enabled {
+		return
+	}
+
+	user, _, _ := r.BasicAuth()
+	entry := auditEntry{
+		Time:     time.Now(),
+		User:     user,
+		Remote:   r.RemoteAddr,
+		Endpoint: r.Method + " " + r.URL.Path,
+		Action:   action,
+		Summary:  summary,
+		Result:   "ok",
+	}
+	if content != nil {
+		sum := sha256.Sum256(content)
+		entry.SHA256 = hex.EncodeToString(sum[:])
+	}
+	if actionErr != nil {
+		entry.Result = "rolled_back"
+		entry.Error = actionErr.Error()
+	}
+
+	path := strings.TrimSpace(rt.Config.Admin.Audit.File)
+	if path == "" {
+		h.logger.Info("admin audit", "user", entry.User, "remote", entry.Remote, "endpoint", entry.Endpoint, "action", entry.Action, "summary", entry.Summary, "sha256", entry.SHA256, "result", entry.Result, "error", entry.Error)
+		return
+	}
+	if err := appendAuditEntry(path, entry); err != nil {
+		h.logger.Error("write audit log failed", "path", path, "err", err)
+	}
+}
+
+// auditMu serializes audit writes so concurrent requests never interleave
+// lines, whatever the file system guarantees for O_APPEND.
+var auditMu sync.Mutex
+
+// appendAuditEntry appends entry as one JSON line and syncs the file, so an
+// acknowledged change is on disk even if the process dies right after.
+// Rotation is left to external tools; the file is reopened on every write.
+func appendAuditEntry(path string, entry auditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// configChangeSummary lists the sections and named entries that differ
+// between old and next, e.g. "server; robots ~r1 +r2; channels -ops".
+func configChangeSummary(old, next *config.Config) string {
+	if old == nil {
+		return "config replaced (previous config unreadable)"
+	}
+	if next == nil {
+		return ""
+	}
+
+	var parts []string
+	sections := []struct {
+		name      string
+		old, next any
+	}{
+		{"server", old.Server, next.Server},
+		{"auth", old.Auth, next.Auth},
+		{"admin", old.Admin, next.Admin},
+		{"reload", old.Reload, next.Reload},
+		{"template", old.Template, next.Template},
+	}
+	for _, s := range sections {
+		if !reflect.DeepEqual(s.old, s.next) {
+			parts = append(parts, s.name)
+		}
+	}
+
+	oldDT, nextDT := old.DingTalk, next.DingTalk
+	oldDT.Robots, oldDT.Channels, oldDT.Routes = nil, nil, nil
+	nextDT.Robots, nextDT.Channels, nextDT.Routes = nil, nil, nil
+	if !reflect.DeepEqual(oldDT, nextDT) {
+		parts = append(parts, "dingtalk")
+	}
+
+	parts = appendNamedDiff(parts, "robots", byName(old.DingTalk.Robots, func(r config.RobotConfig) string { return r.Name }), byName(next.DingTalk.Robots, func(r config.RobotConfig) string { return r.Name }))
+	parts = appendNamedDiff(parts, "channels", byName(old.DingTalk.Channels, func(c config.ChannelConfig) string { return c.Name }), byName(next.DingTalk.Channels, func(c config.ChannelConfig) string { return c.Name }))
+	parts = appendNamedDiff(parts, "routes", byName(old.DingTalk.Routes, func(r config.RouteConfig) string { return r.Name }), byName(next.DingTalk.Routes, func(r config.RouteConfig) string { return r.Name }))
+
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, "; ")
+}
+
+func byName[T any](items []T, name func(T) string) map[string]T {
+	out := make(map[string]T, len(items))
+	for _, it := range items {
+		out[strings.TrimSpace(name(it))] = it
+	}
+	return out
+}
+
+func appendNamedDiff[T any](parts []string, section string, old, next map[string]T) []string {
+	var changes []string
+	for _, name := range sortedKeys(next) {
+		prev, ok := old[name]
+		switch {
+		case !ok:
+			changes = append(changes, "+"+name)
+		case !reflect.DeepEqual(prev, next[name]):
+			changes = append(changes, "~"+name)
+		}
+	}
+	var removed []string
+	for name := range old {
+		if _, ok := next[name]; !ok {
+			removed = append(removed, "-"+name)
+		}
+	}
+	sort.Strings(removed)
+	changes = append(changes, removed...)
+	if len(changes) == 0 {
+		return parts
+	}
+	return append(parts, fmt.Sprintf("%s %s", section, strings.Join(changes, " ")))
+}
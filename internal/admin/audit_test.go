@@ -0,0 +1,117 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"prometheus-dingtalk-hook/internal/reload"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+const auditTestConfig = `auth:
+  token: "secret-token"
+admin:
+  audit:
+    enabled: true
+    file: "audit.log"
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid/robot"
+      msg_type: "markdown"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`
+
+func TestHandler_AuditConfigPut(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(auditTestConfig), 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	rt, err := runtime.LoadFromFile(nil, configPath)
+	if err != nil {
+		t.Fatalf("runtime.LoadFromFile: %v", err)
+	}
+	store := runtime.NewStore(rt)
+	reloadMgr, err := reload.New(nil, configPath, store, false, reload.ModePoll, 0)
+	if err != nil {
+		t.Fatalf("reload.New: %v", err)
+	}
+	h := &handler{logger: slog.Default(), configPath: configPath, store: store, reload: reloadMgr}
+
+	next := strings.Replace(auditTestConfig, "secret-token", "rotated-token", 1)
+	next = strings.Replace(next, `robots: ["r1"]`, `robots: ["r1"]
+    - name: "ops"
+      robots: ["r1"]`, 1)
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/config", strings.NewReader(next))
+	req.SetBasicAuth("alice", "pw")
+	rr := httptest.NewRecorder()
+	h.handleConfig(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatalf("os.ReadFile: %v", err)
+	}
+	if strings.Contains(string(raw), "secret-token") || strings.Contains(string(raw), "rotated-token") {
+		t.Fatalf("audit log leaks secrets: %s", raw)
+	}
+	var entry auditEntry
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(raw))), &entry); err != nil {
+		t.Fatalf("json.Unmarshal: %v (%s)", err, raw)
+	}
+	if entry.User != "alice" || entry.Action != "config.put" || entry.Result != "ok" || entry.Endpoint != "PUT /api/v1/config" {
+		t.Fatalf("entry=%+v", entry)
+	}
+	if sum := sha256.Sum256([]byte(next)); entry.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("sha256=%q", entry.SHA256)
+	}
+	if !strings.Contains(entry.Summary, "auth") || !strings.Contains(entry.Summary, "channels +ops") {
+		t.Fatalf("summary=%q", entry.Summary)
+	}
+}
+
+func TestAppendAuditEntry_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			entry := auditEntry{User: "u", Action: "template.put", Summary: fmt.Sprintf("%d %s", i, strings.Repeat("x", 4096))}
+			if err := appendAuditEntry(path, entry); err != nil {
+				t.Errorf("appendAuditEntry: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("os.ReadFile: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) != 20 {
+		t.Fatalf("lines=%d want 20", len(lines))
+	}
+	for _, line := range lines {
+		var entry auditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("interleaved line: %v", err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package admin
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/metrics"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+// handleSupportBundle serves a zip with what is needed to diagnose the hook
+// without shell access. It never contains secrets: the config is redacted
+// like the JSON config view, webhook parameters are masked and send errors
+// only carry redacted webhook URLs.
+func (h *handler) handleSupportBundle(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, apiResp{Code: 1, Message: "method not allowed"})
+		return
+	}
+
+	data, err := os.ReadFile(h.configPath)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
+		return
+	}
+	baseDir := filepath.Dir(h.configPath)
+	parsed, parseErr := config.Parse(data, baseDir)
+	if parseErr != nil {
+		// The file on disk may be broken while the running config is fine;
+		// the running one is what matters for diagnosis.
+		parsed = rt.Config
+	}
+	cfg, sensitive := redactConfig(parsed, baseDir)
+	for i := range cfg.DingTalk.Robots {
+		params := make(map[string]string, len(cfg.DingTalk.Robots[i].WebhookParams))
+		for k := range cfg.DingTalk.Robots[i].WebhookParams {
+			params[k] = "REDACTED"
+		}
+		cfg.DingTalk.Robots[i].WebhookParams = params
+	}
+
+	var metricsText bytes.Buffer
+	if err := metrics.WriteText(&metricsText); err != nil {
+		fmt.Fprintf(&metricsText, "# gather metrics: %v\n", err)
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"config.json", map[string]any{"config": cfg, "sensitive": sensitive, "config_file_error": errString(parseErr)}},
+		{"templates.json", rt.Renderer.TemplateNames()},
+		{"send_errors.json", h.sendLog.List()},
+		{"status.json", h.status(rt)},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		b, err := json.MarshalIndent(f.data, "", "  ")
+		if err == nil {
+			err = zipWriteFile(zw, f.name, b)
+		}
+		if err != nil {
+			_ = zw.Close()
+			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
+	}
+	if err := zipWriteFile(zw, "metrics.txt", metricsText.Bytes()); err != nil {
+		_ = zw.Close()
+		writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
+		return
+	}
+	if err := zw.Close(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
+		return
+	}
+
+	name := fmt.Sprintf("prometheus-dingtalk-hook-support-%s.zip", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
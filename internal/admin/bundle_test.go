@@ -0,0 +1,90 @@
+package admin
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"prometheus-dingtalk-hook/internal/runtime"
+	"prometheus-dingtalk-hook/internal/sendlog"
+)
+
+const bundleTestConfig = `auth:
+  token: "secret-token"
+admin:
+  enabled: true
+  basic_auth:
+    username: "admin"
+    password: "admin-password"
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "https://oapi.dingtalk.com/robot/send?access_token=robot-token"
+      secret: "SECsigning"
+      webhook_params:
+        route_key: "gateway-key"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`
+
+func TestHandler_SupportBundle(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(bundleTestConfig), 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	rt, err := runtime.LoadFromFile(nil, configPath)
+	if err != nil {
+		t.Fatalf("runtime.LoadFromFile: %v", err)
+	}
+	log := sendlog.New(10)
+	log.Add(sendlog.Entry{Receiver: "ops", Channel: "default", Robot: "r1", Error: "dingtalk errcode=300001 errmsg=token is not exist"})
+	h := &handler{logger: slog.Default(), configPath: configPath, store: runtime.NewStore(rt), sendLog: log}
+
+	rr := httptest.NewRecorder()
+	h.handleSupportBundle(rr, httptest.NewRequest(http.MethodGet, "/api/v1/support-bundle", nil), rt)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader: %v", err)
+	}
+	var names []string
+	var all strings.Builder
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Open(%s): %v", f.Name, err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		all.Write(b)
+	}
+	sort.Strings(names)
+	want := []string{"config.json", "metrics.txt", "send_errors.json", "status.json", "templates.json"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("entries=%v want %v", names, want)
+	}
+
+	content := all.String()
+	for _, secret := range []string{"secret-token", "admin-password", "robot-token", "SECsigning", "gateway-key", "oapi.dingtalk.com"} {
+		if strings.Contains(content, secret) {
+			t.Fatalf("bundle leaks %q", secret)
+		}
+	}
+	if !strings.Contains(content, "token is not exist") {
+		t.Fatalf("bundle misses send errors")
+	}
+}
@@ -0,0 +1,90 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+// defaultCleanupAge keeps directories of an import that may still be running.
+const defaultCleanupAge = time.Hour
+
+// handleCleanup removes the "<dir>.bak-*" backups and ".import-*" staging
+// directories applyImport leaves next to the template dir when an import
+// fails half way. Only directories older than older_than (default 1h) go.
+func (h *handler) handleCleanup(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, apiResp{Code: 1, Message: "method not allowed"})
+		return
+	}
+
+	olderThan := defaultCleanupAge
+	if raw := strings.TrimSpace(r.URL.Query().Get("older_than")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: "older_than must be a non-negative duration"})
+			return
+		}
+		olderThan = d
+	}
+
+	removed, err := cleanupImportLeftovers(filepath.Dir(h.configPath), rt.Config.Template.Dir, time.Now().Add(-olderThan))
+	h.audit(r, "maintenance.cleanup", fmt.Sprintf("removed %d directories", len(removed)), err)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error(), Data: map[string]any{"removed": removed}})
+		return
+	}
+	writeJSON(w, http.StatusOK, apiResp{Code: 0, Message: "ok", Data: map[string]any{"removed": removed}})
+}
+
+// cleanupImportLeftovers removes import backups of tplDir and staging
+// directories beside it that were last modified before cutoff. Everything
+// removed must be under baseDir. It returns the removed paths relative to
+// baseDir.
+func cleanupImportLeftovers(baseDir, tplDir string, cutoff time.Time) ([]string, error) {
+	tplDir = strings.TrimSpace(tplDir)
+	if tplDir == "" {
+		return nil, nil
+	}
+	parent := filepath.Dir(filepath.Clean(tplDir))
+	backupPrefix := filepath.Base(filepath.Clean(tplDir)) + ".bak-"
+
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var removed []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() || !(strings.HasPrefix(name, backupPrefix) || strings.HasPrefix(name, ".import-")) {
+			continue
+		}
+		path := filepath.Join(parent, name)
+		if err := ensureUnderBase(baseDir, path); err != nil {
+			return removed, err
+		}
+		info, err := e.Info()
+		if err != nil {
+			return removed, err
+		}
+		if !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, pathToRelIfUnderBase(baseDir, path))
+	}
+	return removed, nil
+}
@@ -0,0 +1,84 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_CleanupRemovesStaleImportDirs(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(`
+template:
+  dir: "templates"
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`), 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"templates", "templates.bak-20240101000000", ".import-123", ".import-fresh", "other.bak-20240101000000"} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(p, 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if name == ".import-fresh" {
+			continue
+		}
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+
+	rt, err := runtime.LoadFromFile(nil, configPath)
+	if err != nil {
+		t.Fatalf("runtime.LoadFromFile: %v", err)
+	}
+	h := &handler{logger: slog.Default(), configPath: configPath, store: runtime.NewStore(rt)}
+
+	rr := httptest.NewRecorder()
+	h.handleCleanup(rr, httptest.NewRequest(http.MethodPost, "/api/v1/maintenance/cleanup", nil), rt)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			Removed []string `json:"removed"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	sort.Strings(resp.Data.Removed)
+	if len(resp.Data.Removed) != 2 || resp.Data.Removed[0] != ".import-123" || resp.Data.Removed[1] != "templates.bak-20240101000000" {
+		t.Fatalf("removed=%v", resp.Data.Removed)
+	}
+
+	for name, want := range map[string]bool{
+		"templates":                    true,
+		"templates.bak-20240101000000": false,
+		".import-123":                  false,
+		".import-fresh":                true,
+		"other.bak-20240101000000":     true,
+	} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exists := err == nil; exists != want {
+			t.Fatalf("%s exists=%v want %v", name, exists, want)
+		}
+	}
+}
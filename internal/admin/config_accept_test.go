@@ -0,0 +1,108 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"prometheus-dingtalk-hook/internal/config"
+)
+
+const acceptTestConfig = `auth:
+  token: "secret-token"
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid/robot"
+      msg_type: "markdown"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`
+
+func TestHandler_handleConfig_AcceptNegotiation(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(acceptTestConfig), 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	h := &handler{configPath: configPath}
+
+	{
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/config", nil)
+		req.Header.Set("Accept", "text/yaml")
+		rr := httptest.NewRecorder()
+		h.handleConfig(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("yaml status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/yaml") {
+			t.Fatalf("Content-Type=%q want text/yaml", got)
+		}
+		if rr.Body.String() != acceptTestConfig {
+			t.Fatalf("yaml body=%q", rr.Body.String())
+		}
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/config", nil)
+		req.Header.Set("Accept", "application/json;q=0.9, text/plain;q=0.1")
+		rr := httptest.NewRecorder()
+		h.handleConfig(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("json status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get("Content-Type"); got != "application/json" {
+			t.Fatalf("Content-Type=%q want application/json", got)
+		}
+		if strings.Contains(rr.Body.String(), "secret-token") || strings.Contains(rr.Body.String(), "example.invalid") {
+			t.Fatalf("json body leaks secrets: %s", rr.Body.String())
+		}
+		var resp struct {
+			Data struct {
+				Sensitive configSensitiveInfo `json:"sensitive"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("json.Unmarshal: %v", err)
+		}
+		if !resp.Data.Sensitive.AuthTokenSet || !resp.Data.Sensitive.Robots["r1"].WebhookSet {
+			t.Fatalf("sensitive=%+v", resp.Data.Sensitive)
+		}
+	}
+}
+
+func TestRedactConfig_ForwardURLs(t *testing.T) {
+	parsed, err := config.Parse([]byte(acceptTestConfig+`forward:
+  urls: ["https://archive.example.com/in?token=archive-token"]
+server:
+  mirror_url: "https://siem.example.com/ingest?key=siem-key"
+`), "")
+	if err != nil {
+		t.Fatalf("config.Parse: %v", err)
+	}
+	cfg, _ := redactConfig(parsed, "")
+	out, _ := json.Marshal(cfg)
+	for _, secret := range []string{"archive-token", "siem-key"} {
+		if strings.Contains(string(out), secret) {
+			t.Fatalf("redacted config leaks %q: %s", secret, out)
+		}
+	}
+
+	// Saving the redacted config back keeps the real URLs.
+	data, err := mergeConfigJSON(cfg, parsed, configClearSensitive{})
+	if err != nil {
+		t.Fatalf("mergeConfigJSON: %v", err)
+	}
+	merged, err := config.Parse(data, "")
+	if err != nil {
+		t.Fatalf("config.Parse: %v", err)
+	}
+	if got := merged.ForwardURLs(); len(got) != 2 || got[0] != parsed.Forward.URLs[0] || got[1] != parsed.Server.MirrorURL {
+		t.Fatalf("ForwardURLs=%v", got)
+	}
+}
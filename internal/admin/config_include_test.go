@@ -0,0 +1,94 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"prometheus-dingtalk-hook/internal/reload"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_ConfigPutWithIncludes(t *testing.T) {
+	dir := t.TempDir()
+	main := `includes: ["robots.yaml"]
+dingtalk:
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`
+	robots := `dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid/robot"
+      msg_type: "markdown"
+`
+	configPath := filepath.Join(dir, "config.yaml")
+	for name, content := range map[string]string{configPath: main, filepath.Join(dir, "robots.yaml"): robots} {
+		if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+			t.Fatalf("os.WriteFile: %v", err)
+		}
+	}
+	rt, err := runtime.LoadFromFile(nil, configPath)
+	if err != nil {
+		t.Fatalf("runtime.LoadFromFile: %v", err)
+	}
+	store := runtime.NewStore(rt)
+	reloadMgr, err := reload.New(nil, configPath, store, false, reload.ModePoll, 0)
+	if err != nil {
+		t.Fatalf("reload.New: %v", err)
+	}
+	h := &handler{logger: slog.Default(), configPath: configPath, store: store, reload: reloadMgr}
+
+	// The JSON editor sees the merged config, which must not be written
+	// back over the main file.
+	get := httptest.NewRecorder()
+	h.handleConfigJSON(get, httptest.NewRequest(http.MethodGet, "/api/v1/config/json", nil))
+	if get.Code != http.StatusOK {
+		t.Fatalf("get status=%d body=%s", get.Code, get.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			Config json.RawMessage `json:"config"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(get.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	body, _ := json.Marshal(map[string]json.RawMessage{"config": resp.Data.Config})
+	put := httptest.NewRecorder()
+	h.handleConfigJSON(put, httptest.NewRequest(http.MethodPut, "/api/v1/config/json", bytes.NewReader(body)))
+	if put.Code != http.StatusConflict || !strings.Contains(put.Body.String(), "includes") {
+		t.Fatalf("json put status=%d body=%s", put.Code, put.Body.String())
+	}
+	if data, _ := os.ReadFile(configPath); string(data) != main {
+		t.Fatalf("main config changed:\n%s", data)
+	}
+
+	// The YAML editor works on the main file only and keeps the includes.
+	next := main + `    - name: "ops"
+      robots: ["r1"]
+`
+	rr := httptest.NewRecorder()
+	h.handleConfig(rr, httptest.NewRequest(http.MethodPut, "/api/v1/config", strings.NewReader(next)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("yaml put status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if _, ok := store.Load().Robots["r1"]; !ok {
+		t.Fatalf("included robot lost after yaml put")
+	}
+
+	// A config directory cannot be saved as one file.
+	h.configPath = dir
+	rr = httptest.NewRecorder()
+	h.handleConfig(rr, httptest.NewRequest(http.MethodPut, "/api/v1/config", strings.NewReader(next)))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("dir put status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+const (
+	csrfCookieName = "admin_csrf"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+// handleCSRF issues a double-submit CSRF token: it is set as a cookie scoped
+// to the admin prefix and returned in the body, and mutating requests must
+// echo it in the X-CSRF-Token header. A cross-site page can make the browser
+// send the cookie but can neither read it nor set the header.
+func (h *handler) handleCSRF(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, apiResp{Code: 1, Message: "method not allowed"})
+		return
+	}
+
+	// Reuse a valid cookie so that several open tabs share one token.
+	token := csrfCookie(r)
+	if token == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
+		token = hex.EncodeToString(b)
+	}
+	path := strings.TrimSpace(rt.Config.Admin.PathPrefix)
+	if path == "" {
+		path = "/"
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     path,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: map[string]any{
+		"token":  token,
+		"header": csrfHeaderName,
+	}})
+}
+
+// csrfCookie returns the CSRF cookie of r, or "" when it is missing or not
+// a token issued by handleCSRF.
+func csrfCookie(r *http.Request) string {
+	c, err := r.Cookie(csrfCookieName)
+	if err != nil || len(c.Value) != 64 {
+		return ""
+	}
+	if _, err := hex.DecodeString(c.Value); err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+// checkCSRF reports whether r may proceed: GET, HEAD and OPTIONS always
+// may, other methods must carry the CSRF cookie and the same value in the
+// X-CSRF-Token header.
+func checkCSRF(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	cookie := csrfCookie(r)
+	header := strings.TrimSpace(r.Header.Get(csrfHeaderName))
+	return cookie != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
@@ -0,0 +1,96 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_CSRF(t *testing.T) {
+	newHandler := func(csrf *bool) *handler {
+		cfg := &config.Config{
+			Admin: config.AdminConfig{
+				Enabled:    true,
+				PathPrefix: "/admin",
+				BasicAuth:  config.BasicAuthConfig{Username: "admin", Password: "pw"},
+				CSRF:       config.CSRFConfig{Enabled: csrf},
+			},
+			DingTalk: config.DingTalkConfig{
+				Timeout:  config.Duration(2 * time.Second),
+				Robots:   []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "text"}},
+				Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+			},
+		}
+		rt, err := runtime.Build(nil, "", "", cfg)
+		if err != nil {
+			t.Fatalf("runtime.Build: %v", err)
+		}
+		return &handler{store: runtime.NewStore(rt)}
+	}
+	do := func(h *handler, method, path string, cookie *http.Cookie, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		req.SetBasicAuth("admin", "pw")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		if token != "" {
+			req.Header.Set(csrfHeaderName, token)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	h := newHandler(nil)
+	if rr := do(h, http.MethodPost, "/api/v1/reload", nil, ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("POST without token: status=%d want 403", rr.Code)
+	}
+	if rr := do(h, http.MethodGet, "/api/v1/reload", nil, ""); rr.Code == http.StatusForbidden {
+		t.Fatalf("GET must not need a token")
+	}
+
+	rr := do(h, http.MethodGet, "/api/v1/csrf", nil, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET csrf: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != resp.Data.Token || cookies[0].Path != "/admin" || !cookies[0].HttpOnly {
+		t.Fatalf("cookies=%+v token=%q", cookies, resp.Data.Token)
+	}
+	cookie := cookies[0]
+
+	if rr := do(h, http.MethodPost, "/api/v1/reload", cookie, "wrong"); rr.Code != http.StatusForbidden {
+		t.Fatalf("POST with wrong token: status=%d want 403", rr.Code)
+	}
+	if rr := do(h, http.MethodPost, "/api/v1/reload", nil, resp.Data.Token); rr.Code != http.StatusForbidden {
+		t.Fatalf("POST without cookie: status=%d want 403", rr.Code)
+	}
+	if rr := do(h, http.MethodPost, "/api/v1/reload", cookie, resp.Data.Token); rr.Code != http.StatusNotImplemented {
+		t.Fatalf("POST with token: status=%d want 501 body=%s", rr.Code, rr.Body.String())
+	}
+
+	// A second request for a token keeps the existing one.
+	rr = do(h, http.MethodGet, "/api/v1/csrf", cookie, "")
+	if got := rr.Result().Cookies(); len(got) != 1 || got[0].Value != cookie.Value {
+		t.Fatalf("token rotated: %+v", got)
+	}
+
+	disabled := false
+	if rr := do(newHandler(&disabled), http.MethodPost, "/api/v1/reload", nil, ""); rr.Code != http.StatusNotImplemented {
+		t.Fatalf("csrf disabled: status=%d want 501", rr.Code)
+	}
+}
@@ -0,0 +1,186 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/router"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+type dryRunResult struct {
+	Channel  string                `json:"channel"`
+	Template string                `json:"template,omitempty"`
+	Content  string                `json:"content,omitempty"`
+	Mention  *config.MentionConfig `json:"mention,omitempty"`
+	Robots   []string              `json:"robots,omitempty"`
+	Error    string                `json:"error,omitempty"`
+	// Truncated is set when the content was cut to max_message_bytes.
+	Truncated bool `json:"truncated,omitempty"`
+	// Messages is what each robot would be sent.
+	Messages []dryRunMessage `json:"messages,omitempty"`
+	// Skipped explains why the channel would not be notified.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// dryRunMessage is the message one robot would be sent; Content is the body
+// as posted, after the text conversion, text title and mention block.
+type dryRunMessage struct {
+	Robot   string `json:"robot"`
+	MsgType string `json:"msg_type"`
+	Title   string `json:"title,omitempty"`
+	Content string `json:"content,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (h *handler) handleReplayList(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, apiResp{Code: 1, Message: "method not allowed"})
+		return
+	}
+	if h.capture == nil || !rt.Config.Server.Capture.Enabled {
+		writeJSON(w, http.StatusConflict, apiResp{Code: 1, Message: "server.capture is not enabled"})
+		return
+	}
+	writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: map[string]any{
+		"entries": h.capture.List(),
+	}})
+}
+
+func (h *handler) handleReplay(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime, rawID string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, apiResp{Code: 1, Message: "method not allowed"})
+		return
+	}
+	if h.capture == nil || !rt.Config.Server.Capture.Enabled {
+		writeJSON(w, http.StatusConflict, apiResp{Code: 1, Message: "server.capture is not enabled"})
+		return
+	}
+
+	id, err := strconv.ParseUint(rawID, 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: "invalid replay id"})
+		return
+	}
+	entry, ok := h.capture.Get(id)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, apiResp{Code: 1, Message: "replay entry not found"})
+		return
+	}
+
+	// Decode the way the alert endpoint did, so a payload it accepted with
+	// server.tolerant_json replays too.
+	msg, skipped, err := alertmanager.Decode(entry.Body, rt.Config.Server.TolerantJSON, h.logger)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: "invalid json: " + err.Error()})
+		return
+	}
+
+	data := map[string]any{
+		"id":          entry.ID,
+		"received_at": entry.ReceivedAt,
+		"results":     dryRun(rt, msg),
+	}
+	if skipped > 0 {
+		data["skipped_alerts"] = skipped
+	}
+	writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: data})
+}
+
+// handleSimulate runs a payload through routing, mentions and rendering and
+// reports what would be sent to which robots, without sending anything.
+// Quiet hours, deduplication and rate limits depend on earlier traffic and
+// the time of day, so the simulation does not apply them and says so in
+// not_simulated.
+func (h *handler) handleSimulate(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, apiResp{Code: 1, Message: "method not allowed"})
+		return
+	}
+
+	var req struct {
+		Payload alertmanager.WebhookMessage `json:"payload"`
+		Sample  string                      `json:"sample"`
+	}
+	if err := decodeJSONLimited(r.Body, &req, 2<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
+		return
+	}
+	if !h.resolveSample(w, rt, req.Sample, &req.Payload) {
+		return
+	}
+
+	// route is the first of routes; both come from the ordered payload
+	// dryRun routes, like the alert endpoint.
+	routes := router.RouteNames(router.AllMatch(rt.Routes, rt.Priority.Order(req.Payload)))
+	var routeName string
+	if len(routes) > 0 {
+		routeName = routes[0]
+	}
+	writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: map[string]any{
+		"route":         routeName,
+		"routes":        routes,
+		"results":       dryRun(rt, req.Payload),
+		"not_simulated": []string{"quiet_hours", "dedup", "rate_limit"},
+	}})
+}
+
+// dryRun runs msg through routing and builds each robot's message the same
+// way the alert endpoint does, without sending.
+func dryRun(rt *runtime.Runtime, msg alertmanager.WebhookMessage) []dryRunResult {
+	msg = rt.Priority.Order(msg)
+	channelNames := router.UnionChannels(router.AllMatch(rt.Routes, msg))
+	routed := len(channelNames) > 0
+	if !routed {
+		channelNames = []string{"default"}
+	}
+
+	out := make([]dryRunResult, 0, len(channelNames))
+	for _, name := range channelNames {
+		res := dryRunResult{Channel: name}
+		ch, ok := rt.Channels[name]
+		if !ok {
+			res.Error = "unknown channel " + name
+			out = append(out, res)
+			continue
+		}
+		if ch.SkipsResolved(msg) {
+			res.Skipped = "send_resolved is false and all alerts are resolved"
+			out = append(out, res)
+			continue
+		}
+		if len(ch.Robots) == 0 {
+			res.Skipped = "no robot to send to"
+			out = append(out, res)
+			continue
+		}
+		res.Template = rt.ChannelTemplate(ch, msg, routed)
+		for _, robot := range ch.Robots {
+			res.Robots = append(res.Robots, robot.Name)
+		}
+		cm, err := rt.BuildMessage(ch, msg, routed, ch.Robots)
+		if err != nil {
+			res.Error = err.Error()
+			out = append(out, res)
+			continue
+		}
+		res.Content = cm.Output.Content
+		res.Truncated = cm.Truncated
+		res.Mention = &cm.Mention
+		for _, rm := range cm.Robots {
+			m := dryRunMessage{Robot: rm.Robot.Name, MsgType: rm.Msg.MsgType, Title: rm.Msg.Title, Content: rm.Msg.ContentWithMentions()}
+			if rm.Err != nil {
+				m.MsgType = rm.Robot.MsgType
+				m.Error = rm.Err.Error()
+			}
+			res.Messages = append(res.Messages, m)
+		}
+		out = append(out, res)
+	}
+	return out
+}
@@ -0,0 +1,236 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/capture"
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_handleReplay_RendersWithoutSending(t *testing.T) {
+	var sends int32
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&sends, 1)
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			Capture: config.CaptureConfig{Enabled: true, MaxEntries: 5},
+		},
+		DingTalk: config.DingTalkConfig{
+			Timeout:  config.Duration(2 * time.Second),
+			Robots:   []config.RobotConfig{{Name: "r1", Webhook: dt.URL, MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+
+	buf := capture.New()
+	id := buf.Add([]byte(`{"receiver":"default","status":"firing","alerts":[{"status":"firing","annotations":{"summary":"disk full"}}]}`), 5)
+
+	h := &handler{capture: buf}
+
+	{
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/replay", nil)
+		rr := httptest.NewRecorder()
+		h.handleReplayList(rr, req, rt)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("list status=%d body=%s", rr.Code, rr.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/replay/1", nil)
+	rr := httptest.NewRecorder()
+	h.handleReplay(rr, req, rt, "1")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			ID      uint64         `json:"id"`
+			Results []dryRunResult `json:"results"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if resp.Data.ID != id {
+		t.Fatalf("id=%d want %d", resp.Data.ID, id)
+	}
+	if len(resp.Data.Results) != 1 || resp.Data.Results[0].Channel != "default" {
+		t.Fatalf("results=%+v", resp.Data.Results)
+	}
+	if !strings.Contains(resp.Data.Results[0].Content, "disk full") {
+		t.Fatalf("content=%q", resp.Data.Results[0].Content)
+	}
+	if n := atomic.LoadInt32(&sends); n != 0 {
+		t.Fatalf("sends=%d want 0", n)
+	}
+
+	rr = httptest.NewRecorder()
+	h.handleReplay(rr, httptest.NewRequest(http.MethodPost, "/api/v1/replay/99", nil), rt, "99")
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("missing id status=%d want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandler_handleReplay_TolerantJSON(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			Capture:      config.CaptureConfig{Enabled: true, MaxEntries: 5},
+			TolerantJSON: true,
+		},
+		DingTalk: config.DingTalkConfig{
+			Robots:   []config.RobotConfig{{Name: "r1", Webhook: "http://127.0.0.1:1/robot/send", MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+
+	// The second alert's labels are not an object, which fails a strict decode.
+	buf := capture.New()
+	id := buf.Add([]byte(`{"receiver":"default","status":"firing","alerts":[
+		{"status":"firing","annotations":{"summary":"disk full"}},
+		{"status":"firing","labels":"broken"}]}`), 5)
+	h := &handler{capture: buf}
+
+	rr := httptest.NewRecorder()
+	h.handleReplay(rr, httptest.NewRequest(http.MethodPost, "/api/v1/replay/1", nil), rt, strconv.FormatUint(id, 10))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			SkippedAlerts int            `json:"skipped_alerts"`
+			Results       []dryRunResult `json:"results"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if resp.Data.SkippedAlerts != 1 || len(resp.Data.Results) != 1 || !strings.Contains(resp.Data.Results[0].Content, "disk full") {
+		t.Fatalf("data=%+v", resp.Data)
+	}
+
+	rt.Config.Server.TolerantJSON = false
+	rr = httptest.NewRecorder()
+	h.handleReplay(rr, httptest.NewRequest(http.MethodPost, "/api/v1/replay/1", nil), rt, strconv.FormatUint(id, 10))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("strict status=%d want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandler_handleSimulate_MatchesRoute(t *testing.T) {
+	cfg := &config.Config{
+		Template: config.TemplateConfig{TextTitle: "[{{ .Payload.Status | upper }}]"},
+		DingTalk: config.DingTalkConfig{
+			Robots: []config.RobotConfig{
+				{Name: "r1", Webhook: "http://example.invalid/1", MsgType: "markdown"},
+				{Name: "r2", Webhook: "http://example.invalid/2", MsgType: "text"},
+			},
+			Channels: []config.ChannelConfig{
+				{Name: "default", Robots: []string{"r1"}},
+				{
+					Name:    "ops",
+					Robots:  []string{"r1", "r2"},
+					Mention: config.MentionConfig{AtUserIds: []string{"oncall"}},
+				},
+			},
+			Routes: []config.RouteConfig{{
+				Name:     "ops-team",
+				When:     config.WhenConfig{Receiver: []string{"ops"}},
+				Channels: []string{"ops"},
+			}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+
+	body := `{"payload":{"receiver":"ops","status":"firing","alerts":[{"status":"firing","annotations":{"summary":"cpu high"}}]}}`
+	rr := httptest.NewRecorder()
+	(&handler{}).handleSimulate(rr, httptest.NewRequest(http.MethodPost, "/api/v1/simulate", strings.NewReader(body)), rt)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Route        string         `json:"route"`
+			Routes       []string       `json:"routes"`
+			Results      []dryRunResult `json:"results"`
+			NotSimulated []string       `json:"not_simulated"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if resp.Data.Route != "ops-team" || len(resp.Data.Routes) != 1 || resp.Data.Routes[0] != "ops-team" {
+		t.Fatalf("route=%q routes=%v want %q", resp.Data.Route, resp.Data.Routes, "ops-team")
+	}
+	if !slices.Contains(resp.Data.NotSimulated, "quiet_hours") || !slices.Contains(resp.Data.NotSimulated, "dedup") {
+		t.Fatalf("not_simulated=%v", resp.Data.NotSimulated)
+	}
+	if len(resp.Data.Results) != 1 {
+		t.Fatalf("results=%+v", resp.Data.Results)
+	}
+	res := resp.Data.Results[0]
+	if res.Channel != "ops" || res.Template != "default" {
+		t.Fatalf("result=%+v", res)
+	}
+	if len(res.Robots) != 2 || res.Robots[0] != "r1" || res.Robots[1] != "r2" {
+		t.Fatalf("robots=%v", res.Robots)
+	}
+	if res.Mention == nil || len(res.Mention.AtUserIds) != 1 || res.Mention.AtUserIds[0] != "oncall" {
+		t.Fatalf("mention=%+v", res.Mention)
+	}
+	if !strings.Contains(res.Content, "cpu high") {
+		t.Fatalf("content=%q", res.Content)
+	}
+
+	// Each robot gets its own message, as the alert endpoint would send it.
+	if len(res.Messages) != 2 {
+		t.Fatalf("messages=%+v", res.Messages)
+	}
+	md, text := res.Messages[0], res.Messages[1]
+	if md.Robot != "r1" || md.MsgType != "markdown" || !strings.HasPrefix(md.Content, res.Content) || !strings.HasSuffix(md.Content, "@oncall") {
+		t.Fatalf("markdown message=%+v", md)
+	}
+	if text.Robot != "r2" || text.MsgType != "text" || !strings.HasPrefix(text.Content, "[FIRING]\n") || !strings.HasSuffix(text.Content, "@oncall") {
+		t.Fatalf("text message=%+v", text)
+	}
+	if strings.Contains(text.Content, "**") || strings.Contains(text.Content, "#") {
+		t.Fatalf("text message keeps markdown: %q", text.Content)
+	}
+
+	// The content is cut to max_message_bytes like a real send.
+	rt.Config.DingTalk.MaxMessageBytes = 80
+	body = `{"payload":{"receiver":"ops","status":"firing","alerts":[` + strings.Repeat(`{"status":"firing","annotations":{"summary":"cpu high on a busy host"}},`, 20) + `{"status":"firing"}]}}`
+	rr = httptest.NewRecorder()
+	(&handler{}).handleSimulate(rr, httptest.NewRequest(http.MethodPost, "/api/v1/simulate", strings.NewReader(body)), rt)
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if res := resp.Data.Results[0]; !res.Truncated || len(res.Content) > 80 {
+		t.Fatalf("truncated=%v content=%d bytes", res.Truncated, len(res.Content))
+	}
+}
@@ -25,10 +25,13 @@ import (
 	"time"
 
 	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/capture"
 	"prometheus-dingtalk-hook/internal/config"
 	"prometheus-dingtalk-hook/internal/dingtalk"
+	"prometheus-dingtalk-hook/internal/metrics"
 	"prometheus-dingtalk-hook/internal/reload"
 	"prometheus-dingtalk-hook/internal/runtime"
+	"prometheus-dingtalk-hook/internal/sendlog"
 	"prometheus-dingtalk-hook/internal/template"
 
 	"gopkg.in/yaml.v3"
@@ -42,6 +45,9 @@ type Options struct {
 	ConfigPath string
 	Store      *runtime.Store
 	Reload     *reload.Manager
+	Capture    *capture.Buffer
+	SendLog    *sendlog.Log
+	Sends      *sendlog.History
 }
 
 func New(opts Options) http.Handler {
@@ -53,6 +59,9 @@ func New(opts Options) http.Handler {
 		configPath: opts.ConfigPath,
 		store:      opts.Store,
 		reload:     opts.Reload,
+		capture:    opts.Capture,
+		sendLog:    opts.SendLog,
+		sends:      opts.Sends,
 	}
 }
 
@@ -61,6 +70,10 @@ type handler struct {
 	configPath string
 	store      *runtime.Store
 	reload     *reload.Manager
+	capture    *capture.Buffer
+	sendLog    *sendlog.Log
+	sends      *sendlog.History
+	robotTests robotTestLimiter
 }
 
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -81,6 +94,11 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if rt.Config.Admin.CSRFEnabled() && !checkCSRF(r) {
+		writeJSON(w, http.StatusForbidden, apiResp{Code: 1, Message: "missing or invalid csrf token: get one from GET /api/v1/csrf and send it in the " + csrfHeaderName + " header"})
+		return
+	}
+
 	switch {
 	case r.URL.Path == "" || r.URL.Path == "/":
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -88,6 +106,10 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		_, _ = w.Write(indexHTML)
 		return
 
+	case r.URL.Path == "/api/v1/csrf":
+		h.handleCSRF(w, r, rt)
+		return
+
 	case r.URL.Path == "/api/v1/status":
 		h.handleStatus(w, r, rt)
 		return
@@ -104,6 +126,10 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.handleConfigJSON(w, r)
 		return
 
+	case r.URL.Path == "/api/v1/config/validate":
+		h.handleConfigValidate(w, r)
+		return
+
 	case r.URL.Path == "/api/v1/templates":
 		h.handleTemplates(w, r, rt)
 		return
@@ -122,10 +148,51 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.handleRender(w, r, rt)
 		return
 
+	case r.URL.Path == "/api/v1/lint":
+		h.handleLint(w, r, rt)
+		return
+
+	case strings.HasPrefix(r.URL.Path, "/api/v1/robots/") && strings.HasSuffix(r.URL.Path, "/test"):
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/robots/"), "/test")
+		h.handleRobotTest(w, r, rt, name)
+		return
+
 	case r.URL.Path == "/api/v1/send":
 		h.handleSend(w, r, rt)
 		return
 
+	case r.URL.Path == "/api/v1/support-bundle":
+		h.handleSupportBundle(w, r, rt)
+		return
+
+	case r.URL.Path == "/api/v1/maintenance/cleanup":
+		h.handleCleanup(w, r, rt)
+		return
+
+	case r.URL.Path == "/api/v1/sends/recent":
+		h.handleRecentSends(w, r)
+		return
+
+	case r.URL.Path == "/api/v1/samples":
+		h.handleSamples(w, r, rt)
+		return
+
+	case strings.HasPrefix(r.URL.Path, "/api/v1/samples/"):
+		h.handleSample(w, r, rt, strings.TrimPrefix(r.URL.Path, "/api/v1/samples/"))
+		return
+
+	case r.URL.Path == "/api/v1/simulate":
+		h.handleSimulate(w, r, rt)
+		return
+
+	case r.URL.Path == "/api/v1/replay":
+		h.handleReplayList(w, r, rt)
+		return
+
+	case strings.HasPrefix(r.URL.Path, "/api/v1/replay/"):
+		h.handleReplay(w, r, rt, strings.TrimPrefix(r.URL.Path, "/api/v1/replay/"))
+		return
+
 	case r.URL.Path == "/api/v1/export":
 		h.handleExport(w, r, rt)
 		return
@@ -146,6 +213,7 @@ type apiResp struct {
 
 type configSensitiveInfo struct {
 	AuthTokenSet           bool                          `json:"auth_token_set"`
+	AuthHMACSecretSet      bool                          `json:"auth_hmac_secret_set"`
 	AdminPasswordSet       bool                          `json:"admin_password_set"`
 	AdminPasswordSHA256Set bool                          `json:"admin_password_sha256_set"`
 	AdminSaltSet           bool                          `json:"admin_salt_set"`
@@ -159,6 +227,7 @@ type robotSensitiveInfo struct {
 
 type configClearSensitive struct {
 	AuthToken           bool                           `json:"auth_token"`
+	AuthHMACSecret      bool                           `json:"auth_hmac_secret"`
 	AdminPassword       bool                           `json:"admin_password"`
 	AdminPasswordSHA256 bool                           `json:"admin_password_sha256"`
 	AdminSalt           bool                           `json:"admin_salt"`
@@ -176,22 +245,28 @@ func (h *handler) handleStatus(w http.ResponseWriter, r *http.Request, rt *runti
 		writeJSON(w, http.StatusMethodNotAllowed, apiResp{Code: 1, Message: "method not allowed"})
 		return
 	}
+	writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: h.status(rt)})
+}
+
+func (h *handler) status(rt *runtime.Runtime) map[string]any {
 	var reloadStatus any
 	if h.reload != nil {
 		reloadStatus = h.reload.Status()
 	}
-	writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: map[string]any{
+	return map[string]any{
 		"mode":      "channels",
 		"loaded_at": rt.LoadedAt,
 		"reload":    reloadStatus,
+		"throttle":  rt.ChannelLimiter.States(),
 		"templates": rt.Renderer.TemplateNames(),
 		"channels":  sortedKeys(rt.Channels),
-	}})
+		"warnings":  rt.Warnings,
+	}
 }
 
 func (h *handler) handleReload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.Header().Set("Allow", http.MethodPost)
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
 		writeJSON(w, http.StatusMethodNotAllowed, apiResp{Code: 1, Message: "method not allowed"})
 		return
 	}
@@ -199,16 +274,29 @@ func (h *handler) handleReload(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusNotImplemented, apiResp{Code: 1, Message: "reload is not configured"})
 		return
 	}
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: h.reload.Status()})
+		return
+	}
 	if err := h.reload.Reload(r.Context(), true); err != nil {
 		writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
 		return
 	}
+	h.audit(r, "reload", "", nil)
 	writeJSON(w, http.StatusOK, apiResp{Code: 0, Message: "ok"})
 }
 
 func (h *handler) handleConfig(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
+		if acceptsJSON(r) {
+			h.writeRedactedConfig(w)
+			return
+		}
+		if err := h.checkConfigFile(); err != nil {
+			writeJSON(w, http.StatusConflict, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
 		data, err := os.ReadFile(h.configPath)
 		if err != nil {
 			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
@@ -223,6 +311,10 @@ func (h *handler) handleConfig(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusNotImplemented, apiResp{Code: 1, Message: "reload is not configured"})
 			return
 		}
+		if err := h.checkConfigFile(); err != nil {
+			writeJSON(w, http.StatusConflict, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
 		newData, err := readLimited(r.Body, 2<<20)
 		if err != nil {
 			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
@@ -231,28 +323,27 @@ func (h *handler) handleConfig(w http.ResponseWriter, r *http.Request) {
 		oldData, _ := os.ReadFile(h.configPath)
 
 		baseDir := filepath.Dir(h.configPath)
-		parsed, err := config.Parse(newData, baseDir)
+		parsed, err := h.buildConfig(newData)
 		if err != nil {
-			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
-			return
-		}
-		if _, err := runtime.Build(h.logger, h.configPath, baseDir, parsed); err != nil {
-			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
+			writeConfigError(w, err)
 			return
 		}
 
-		if err := writeFileAtomic(h.configPath, newData, 0o600); err != nil {
+		oldParsed, _ := config.Parse(oldData, baseDir)
+		summary := configChangeSummary(oldParsed, parsed)
+		written, err := h.writeAndReload(r.Context(), h.configPath, newData, 0o600)
+		if err != nil && !written {
 			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
 			return
 		}
-
-		if err := h.reload.Reload(r.Context(), true); err != nil {
-			_ = writeFileAtomic(h.configPath, oldData, 0o600)
-			_ = h.reload.Reload(r.Context(), true)
+		if err != nil {
+			_, _ = h.writeAndReload(r.Context(), h.configPath, oldData, 0o600)
+			h.auditContent(r, "config.put", summary, newData, err)
 			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
 			return
 		}
 
+		h.auditContent(r, "config.put", summary, newData, nil)
 		writeJSON(w, http.StatusOK, apiResp{Code: 0, Message: "ok"})
 		return
 	default:
@@ -265,57 +356,7 @@ func (h *handler) handleConfig(w http.ResponseWriter, r *http.Request) {
 func (h *handler) handleConfigJSON(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		data, err := os.ReadFile(h.configPath)
-		if err != nil {
-			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
-			return
-		}
-
-		baseDir := filepath.Dir(h.configPath)
-		parsed, err := config.Parse(data, baseDir)
-		if err != nil {
-			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
-			return
-		}
-
-		sensitive := configSensitiveInfo{
-			AuthTokenSet:           strings.TrimSpace(parsed.Auth.Token) != "",
-			AdminPasswordSet:       strings.TrimSpace(parsed.Admin.BasicAuth.Password) != "",
-			AdminPasswordSHA256Set: strings.TrimSpace(parsed.Admin.BasicAuth.PasswordSHA256) != "",
-			AdminSaltSet:           strings.TrimSpace(parsed.Admin.BasicAuth.Salt) != "",
-			Robots:                 make(map[string]robotSensitiveInfo, len(parsed.DingTalk.Robots)),
-		}
-		for _, robot := range parsed.DingTalk.Robots {
-			name := strings.TrimSpace(robot.Name)
-			if name == "" {
-				continue
-			}
-			sensitive.Robots[name] = robotSensitiveInfo{
-				WebhookSet: strings.TrimSpace(robot.Webhook) != "",
-				SecretSet:  strings.TrimSpace(robot.Secret) != "",
-			}
-		}
-
-		cfg := *parsed
-		cfg.DingTalk.Robots = append([]config.RobotConfig(nil), parsed.DingTalk.Robots...)
-		cfg.DingTalk.Channels = append([]config.ChannelConfig(nil), parsed.DingTalk.Channels...)
-		cfg.DingTalk.Routes = append([]config.RouteConfig(nil), parsed.DingTalk.Routes...)
-
-		cfg.Auth.Token = ""
-		cfg.Admin.BasicAuth.Password = ""
-		cfg.Admin.BasicAuth.PasswordSHA256 = ""
-		cfg.Admin.BasicAuth.Salt = ""
-		for i := range cfg.DingTalk.Robots {
-			cfg.DingTalk.Robots[i].Webhook = ""
-			cfg.DingTalk.Robots[i].Secret = ""
-		}
-
-			cfg.Template.Dir = pathToRelIfUnderBase(baseDir, cfg.Template.Dir)
-
-		writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: map[string]any{
-			"config":    cfg,
-			"sensitive": sensitive,
-		}})
+		h.writeRedactedConfig(w)
 		return
 
 	case http.MethodPut:
@@ -332,6 +373,10 @@ func (h *handler) handleConfigJSON(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
 			return
 		}
+		if err := h.checkConfigFile(); err != nil {
+			writeJSON(w, http.StatusConflict, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
 
 		baseDir := filepath.Dir(h.configPath)
 		oldCfgBytes, err := os.ReadFile(h.configPath)
@@ -344,38 +389,39 @@ func (h *handler) handleConfigJSON(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
 			return
 		}
-
-		merged := req.Config
-		mergeSensitiveConfig(&merged, oldCfg, req.ClearSensitive)
-
-		yamlBytes, err := yaml.Marshal(&merged)
-		if err != nil {
-			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
+		// The JSON config is the merged result of the includes; saving it
+		// would copy their robots and channels into the main file.
+		if len(oldCfg.Includes) > 0 {
+			writeJSON(w, http.StatusConflict, apiResp{Code: 1, Message: "config uses includes: edit the main file as YAML or the included files directly"})
 			return
 		}
 
-		parsed, err := config.Parse(yamlBytes, baseDir)
+		yamlBytes, err := mergeConfigJSON(req.Config, oldCfg, req.ClearSensitive)
 		if err != nil {
 			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
 			return
 		}
-		if _, err := runtime.Build(h.logger, h.configPath, baseDir, parsed); err != nil {
-			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
+
+		parsed, err := h.buildConfig(yamlBytes)
+		if err != nil {
+			writeConfigError(w, err)
 			return
 		}
 
-		if err := writeFileAtomic(h.configPath, yamlBytes, 0o600); err != nil {
+		summary := configChangeSummary(oldCfg, parsed)
+		written, err := h.writeAndReload(r.Context(), h.configPath, yamlBytes, 0o600)
+		if err != nil && !written {
 			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
 			return
 		}
-
-		if err := h.reload.Reload(r.Context(), true); err != nil {
-			_ = writeFileAtomic(h.configPath, oldCfgBytes, 0o600)
-			_ = h.reload.Reload(r.Context(), true)
+		if err != nil {
+			_, _ = h.writeAndReload(r.Context(), h.configPath, oldCfgBytes, 0o600)
+			h.auditContent(r, "config.put", summary, yamlBytes, err)
 			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
 			return
 		}
 
+		h.auditContent(r, "config.put", summary, yamlBytes, nil)
 		writeJSON(w, http.StatusOK, apiResp{Code: 0, Message: "ok"})
 		return
 
@@ -386,6 +432,121 @@ func (h *handler) handleConfigJSON(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// checkConfigFile reports an error when config.file is a directory, whose
+// files the editor cannot write as one.
+func (h *handler) checkConfigFile() error {
+	if st, err := os.Stat(h.configPath); err == nil && st.IsDir() {
+		return errors.New("config.file is a directory: edit its files directly")
+	}
+	return nil
+}
+
+// buildConfig parses data and builds a runtime from it without installing it,
+// the check a config must pass before it is written.
+func (h *handler) buildConfig(data []byte) (*config.Config, error) {
+	baseDir := filepath.Dir(h.configPath)
+	parsed, err := config.Parse(data, baseDir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := runtime.Build(h.logger, h.configPath, baseDir, parsed); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// mergeConfigJSON restores the secrets the UI received redacted from oldCfg
+// and returns the YAML that would be saved.
+func mergeConfigJSON(cfg config.Config, oldCfg *config.Config, clear configClearSensitive) ([]byte, error) {
+	mergeSensitiveConfig(&cfg, oldCfg, clear)
+	return yaml.Marshal(&cfg)
+}
+
+// writeRedactedConfig writes the parsed config as JSON with secrets removed
+// and a summary of which secrets are set.
+func (h *handler) writeRedactedConfig(w http.ResponseWriter) {
+	parsed, err := config.Load(h.configPath)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
+		return
+	}
+
+	cfg, sensitive := redactConfig(parsed, config.BaseDir(h.configPath))
+	writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: map[string]any{
+		"config":    cfg,
+		"sensitive": sensitive,
+	}})
+}
+
+// redactConfig returns a copy of parsed with secrets cleared and paths made
+// relative to baseDir, plus which secrets were set.
+func redactConfig(parsed *config.Config, baseDir string) (config.Config, configSensitiveInfo) {
+	sensitive := configSensitiveInfo{
+		AuthTokenSet:           strings.TrimSpace(parsed.Auth.Token) != "",
+		AuthHMACSecretSet:      strings.TrimSpace(parsed.Auth.HMACSecret) != "",
+		AdminPasswordSet:       strings.TrimSpace(parsed.Admin.BasicAuth.Password) != "",
+		AdminPasswordSHA256Set: strings.TrimSpace(parsed.Admin.BasicAuth.PasswordSHA256) != "",
+		AdminSaltSet:           strings.TrimSpace(parsed.Admin.BasicAuth.Salt) != "",
+		Robots:                 make(map[string]robotSensitiveInfo, len(parsed.DingTalk.Robots)),
+	}
+	for _, robot := range parsed.DingTalk.Robots {
+		name := strings.TrimSpace(robot.Name)
+		if name == "" {
+			continue
+		}
+		sensitive.Robots[name] = robotSensitiveInfo{
+			WebhookSet: strings.TrimSpace(robot.Webhook) != "",
+			SecretSet:  robot.Secret.Set(),
+		}
+	}
+
+	cfg := *parsed
+	cfg.DingTalk.Robots = append([]config.RobotConfig(nil), parsed.DingTalk.Robots...)
+	cfg.DingTalk.Channels = append([]config.ChannelConfig(nil), parsed.DingTalk.Channels...)
+	cfg.DingTalk.Routes = append([]config.RouteConfig(nil), parsed.DingTalk.Routes...)
+
+	cfg.Auth.Token = ""
+	cfg.Auth.HMACSecret = ""
+	cfg.Admin.BasicAuth.Password = ""
+	cfg.Admin.BasicAuth.PasswordSHA256 = ""
+	cfg.Admin.BasicAuth.Salt = ""
+	for i := range cfg.DingTalk.Robots {
+		cfg.DingTalk.Robots[i].Webhook = ""
+		cfg.DingTalk.Robots[i].Secret = nil
+		cfg.DingTalk.Robots[i].WebhookFile = pathToRelIfUnderBase(baseDir, cfg.DingTalk.Robots[i].WebhookFile)
+		cfg.DingTalk.Robots[i].SecretFile = pathToRelIfUnderBase(baseDir, cfg.DingTalk.Robots[i].SecretFile)
+	}
+	// Forward endpoints often carry a token in the query.
+	cfg.Forward.URLs = make([]string, 0, len(parsed.Forward.URLs))
+	for _, u := range parsed.Forward.URLs {
+		cfg.Forward.URLs = append(cfg.Forward.URLs, dingtalk.RedactWebhook(u))
+	}
+	if cfg.Server.MirrorURL != "" {
+		cfg.Server.MirrorURL = dingtalk.RedactWebhook(cfg.Server.MirrorURL)
+	}
+	cfg.Auth.TokenFile = pathToRelIfUnderBase(baseDir, cfg.Auth.TokenFile)
+	cfg.Auth.HMACSecretFile = pathToRelIfUnderBase(baseDir, cfg.Auth.HMACSecretFile)
+
+	cfg.Template.Dir = pathToRelIfUnderBase(baseDir, cfg.Template.Dir)
+	cfg.Server.TLSCertFile = pathToRelIfUnderBase(baseDir, cfg.Server.TLSCertFile)
+	cfg.Server.TLSKeyFile = pathToRelIfUnderBase(baseDir, cfg.Server.TLSKeyFile)
+	cfg.Server.ClientCAFile = pathToRelIfUnderBase(baseDir, cfg.Server.ClientCAFile)
+	cfg.Admin.Audit.File = pathToRelIfUnderBase(baseDir, cfg.Admin.Audit.File)
+	cfg.Admin.SamplesDir = pathToRelIfUnderBase(baseDir, cfg.Admin.SamplesDir)
+	return cfg, sensitive
+}
+
+// acceptsJSON reports whether the client asked for JSON over the default YAML.
+func acceptsJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if strings.EqualFold(mediaType, "application/json") {
+			return true
+		}
+	}
+	return false
+}
+
 func pathToRelIfUnderBase(baseDir, p string) string {
 	baseDir = strings.TrimSpace(baseDir)
 	p = strings.TrimSpace(p)
@@ -408,6 +569,20 @@ func pathToRelIfUnderBase(baseDir, p string) string {
 	return rel
 }
 
+// unredactURL returns the entry of old that redacts to u, or u when none
+// does.
+func unredactURL(u string, old []string) string {
+	if u == "" {
+		return u
+	}
+	for _, o := range old {
+		if o != "" && dingtalk.RedactWebhook(o) == u {
+			return o
+		}
+	}
+	return u
+}
+
 func mergeSensitiveConfig(dst *config.Config, old *config.Config, clear configClearSensitive) {
 	if dst == nil || old == nil {
 		return
@@ -415,10 +590,22 @@ func mergeSensitiveConfig(dst *config.Config, old *config.Config, clear configCl
 
 	if clear.AuthToken {
 		dst.Auth.Token = ""
-	} else if strings.TrimSpace(dst.Auth.Token) == "" {
+	} else if strings.TrimSpace(dst.Auth.Token) == "" && strings.TrimSpace(dst.Auth.TokenFile) == "" {
 		dst.Auth.Token = old.Auth.Token
 	}
 
+	if clear.AuthHMACSecret {
+		dst.Auth.HMACSecret = ""
+	} else if strings.TrimSpace(dst.Auth.HMACSecret) == "" && strings.TrimSpace(dst.Auth.HMACSecretFile) == "" {
+		dst.Auth.HMACSecret = old.Auth.HMACSecret
+	}
+
+	// Forward URLs come back redacted; an unchanged one is restored.
+	for i, u := range dst.Forward.URLs {
+		dst.Forward.URLs[i] = unredactURL(u, old.Forward.URLs)
+	}
+	dst.Server.MirrorURL = unredactURL(dst.Server.MirrorURL, []string{old.Server.MirrorURL})
+
 	userSetAdminPassword := strings.TrimSpace(dst.Admin.BasicAuth.Password) != ""
 	userSetAdminSHA := strings.TrimSpace(dst.Admin.BasicAuth.PasswordSHA256) != ""
 	if clear.AdminPassword {
@@ -458,13 +645,13 @@ func mergeSensitiveConfig(dst *config.Config, old *config.Config, clear configCl
 
 		if clearRobot.Webhook {
 			dst.DingTalk.Robots[i].Webhook = ""
-		} else if strings.TrimSpace(dst.DingTalk.Robots[i].Webhook) == "" {
+		} else if strings.TrimSpace(dst.DingTalk.Robots[i].Webhook) == "" && strings.TrimSpace(dst.DingTalk.Robots[i].WebhookFile) == "" {
 			dst.DingTalk.Robots[i].Webhook = prev.Webhook
 		}
 
 		if clearRobot.Secret {
-			dst.DingTalk.Robots[i].Secret = ""
-		} else if strings.TrimSpace(dst.DingTalk.Robots[i].Secret) == "" {
+			dst.DingTalk.Robots[i].Secret = nil
+		} else if !dst.DingTalk.Robots[i].Secret.Set() && strings.TrimSpace(dst.DingTalk.Robots[i].SecretFile) == "" {
 			dst.DingTalk.Robots[i].Secret = prev.Secret
 		}
 	}
@@ -534,22 +721,28 @@ func (h *handler) handleTemplate(w http.ResponseWriter, r *http.Request, rt *run
 		old, oldErr := os.ReadFile(path)
 		oldExists := oldErr == nil
 
-		if err := writeFileAtomic(path, data, 0o644); err != nil {
+		summary := fmt.Sprintf("template %s created (%d bytes)", name, len(data))
+		if oldExists {
+			summary = fmt.Sprintf("template %s updated (%d -> %d bytes)", name, len(old), len(data))
+		}
+		written, err := h.writeAndReload(r.Context(), path, data, 0o644)
+		if err != nil && !written {
 			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
 			return
 		}
-
-		if err := h.reload.Reload(r.Context(), true); err != nil {
-			if oldExists {
-				_ = writeFileAtomic(path, old, 0o644)
-			} else {
-				_ = os.Remove(path)
-			}
-			_ = h.reload.Reload(r.Context(), true)
+		if err != nil {
+			_ = h.reload.Apply(r.Context(), func() error {
+				if oldExists {
+					return writeFileAtomic(path, old, 0o644)
+				}
+				return os.Remove(path)
+			})
+			h.auditContent(r, "template.put", summary, data, err)
 			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
 			return
 		}
 
+		h.auditContent(r, "template.put", summary, data, nil)
 		writeJSON(w, http.StatusOK, apiResp{Code: 0, Message: "ok"})
 		return
 
@@ -570,7 +763,7 @@ func (h *handler) readTemplate(rt *runtime.Runtime, name string) (string, error)
 	}
 
 	if name == "default" {
-		return template.EmbeddedDefaultText(), nil
+		return template.DefaultText(rt.Config.Template), nil
 	}
 
 	return "", errors.New("template not found")
@@ -588,32 +781,44 @@ func (h *handler) handleRender(w http.ResponseWriter, r *http.Request, rt *runti
 		Template     string                      `json:"template"`
 		TemplateText string                      `json:"template_text"`
 		Payload      alertmanager.WebhookMessage `json:"payload"`
+		Sample       string                      `json:"sample"`
 	}
 	if err := decodeJSONLimited(r.Body, &req, 2<<20); err != nil {
 		writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
 		return
 	}
+	if !h.resolveSample(w, rt, req.Sample, &req.Payload) {
+		return
+	}
 
 	var content string
 	var err error
+	name := strings.TrimSpace(req.Template)
 	if strings.TrimSpace(req.TemplateText) != "" {
-		content, err = template.RenderText(req.TemplateText, req.Payload)
+		content, err = rt.Renderer.RenderText(req.TemplateText, req.Payload)
 	} else if strings.TrimSpace(req.Channel) != "" {
 		ch, ok := rt.Channels[strings.TrimSpace(req.Channel)]
 		if !ok {
 			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: "unknown channel"})
 			return
 		}
+		name = ch.Template
 		content, err = rt.Renderer.Render(ch.Template, req.Payload)
 	} else {
-		content, err = rt.Renderer.Render(strings.TrimSpace(req.Template), req.Payload)
+		if name == "" {
+			name = rt.Renderer.DefaultName()
+		}
+		content, err = rt.Renderer.Render(name, req.Payload)
 	}
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: map[string]any{"content": content}})
+	writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: map[string]any{
+		"content":  content,
+		"warnings": templateWarnings(rt, name, req.Payload),
+	}})
 }
 
 func (h *handler) handleSend(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime) {
@@ -643,17 +848,19 @@ func (h *handler) handleSend(w http.ResponseWriter, r *http.Request, rt *runtime
 		return
 	}
 
-	var content string
+	var out template.Output
 	if strings.TrimSpace(req.RawText) != "" {
-		content = req.RawText
+		out.Content = req.RawText
 	} else {
 		var err error
-		content, err = rt.Renderer.Render(ch.Template, req.Payload)
+		out, err = rt.Renderer.RenderChannel(ch.Template, req.Payload, ch.RenderContext())
 		if err != nil {
+			metrics.RenderErrorsTotal.WithLabelValues(ch.Name).Inc()
 			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
 			return
 		}
 	}
+	content := out.Content
 
 	mention := ch.EffectiveMention(req.Payload)
 	var at *dingtalk.At
@@ -668,19 +875,48 @@ func (h *handler) handleSend(w http.ResponseWriter, r *http.Request, rt *runtime
 			MsgType: msgType,
 			Title:   robot.Title,
 			At:      at,
+
+			MentionFormat: ch.MentionFormat,
 		}
 		switch msgType {
 		case "markdown":
 			dtMsg.Markdown = content
 		case "text":
 			dtMsg.Text = content
+		case "actionCard":
+			if dtMsg.Title == "" {
+				dtMsg.Title = dingtalk.CardTitle(content)
+			}
+			dtMsg.ActionCard = &dingtalk.ActionCard{
+				Text:    content,
+				Buttons: runtime.CardButtons(out, req.Payload),
+			}
+		case "link":
+			if dtMsg.Title == "" {
+				dtMsg.Title = dingtalk.CardTitle(content)
+			}
+			messageURL, picURL := runtime.LinkURLs(out, req.Payload)
+			dtMsg.Link = &dingtalk.Link{Text: dingtalk.MarkdownToText(content), MessageURL: messageURL, PicURL: picURL}
 		default:
 			sendErrs = append(sendErrs, fmt.Errorf("unsupported msg_type %q", msgType))
 			continue
 		}
-		if err := rt.DingTalk.Send(r.Context(), robot.Webhook, robot.Secret, dtMsg); err != nil {
+		start := time.Now()
+		err := rt.DingTalk.SendTo(r.Context(), runtime.Target(robot), dtMsg)
+		metrics.ObserveSend(robot.Name, ch.Name, start, err)
+		sent := sendlog.Send{
+			Source:  "admin",
+			Channel: ch.Name,
+			Robot:   robot.Name,
+			MsgType: msgType,
+			OK:      err == nil,
+			Preview: dtMsg.Content(),
+		}
+		if err != nil {
+			sent.Error = err.Error()
 			sendErrs = append(sendErrs, err)
 		}
+		h.sends.Add(sent, rt.Config.Admin.RecentSends)
 	}
 	if len(sendErrs) > 0 {
 		writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: sendErrs[0].Error()})
@@ -690,6 +926,23 @@ func (h *handler) handleSend(w http.ResponseWriter, r *http.Request, rt *runtime
 	writeJSON(w, http.StatusOK, apiResp{Code: 0, Message: "ok"})
 }
 
+// handleRecentSends lists the most recent sends, newest first, including
+// successful ones, up to admin.recent_sends.
+func (h *handler) handleRecentSends(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, apiResp{Code: 1, Message: "method not allowed"})
+		return
+	}
+	sends := h.sends.List()
+	if sends == nil {
+		sends = []sendlog.Send{}
+	}
+	writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: map[string]any{
+		"sends": sends,
+	}})
+}
+
 func (h *handler) handleExport(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime) {
 	if r.Method != http.MethodGet {
 		w.Header().Set("Allow", http.MethodGet)
@@ -752,7 +1005,7 @@ func (h *handler) zipTemplates(zw *zip.Writer, rt *runtime.Runtime) error {
 		}
 	}
 	if _, err := os.Stat(filepath.Join(dir, "default.tmpl")); err != nil && errors.Is(err, os.ErrNotExist) {
-		if err := zipWriteFile(zw, "templates/default.tmpl", []byte(template.EmbeddedDefaultText())); err != nil {
+		if err := zipWriteFile(zw, "templates/default.tmpl", []byte(template.DefaultText(rt.Config.Template))); err != nil {
 			return err
 		}
 	}
@@ -797,10 +1050,17 @@ func (h *handler) handleImport(w http.ResponseWriter, r *http.Request, rt *runti
 		return
 	}
 
+	var oldParsed *config.Config
+	if oldBytes, err := os.ReadFile(h.configPath); err == nil {
+		oldParsed, _ = config.Parse(oldBytes, baseDir)
+	}
+	summary := fmt.Sprintf("import: %s; templates %s", configChangeSummary(oldParsed, parsed), strings.Join(sortedKeys(templates), ","))
 	if err := applyImport(r.Context(), h.logger, h.reload, h.configPath, parsed, cfgBytes, templates); err != nil {
+		h.auditContent(r, "import", summary, body, err)
 		writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
 		return
 	}
+	h.auditContent(r, "import", summary, body, nil)
 	writeJSON(w, http.StatusOK, apiResp{Code: 0, Message: "ok"})
 }
 
@@ -1004,46 +1264,52 @@ func applyImport(ctx context.Context, logger *slog.Logger, reloadMgr *reload.Man
 		}
 	}
 
-	// Validate by compiling everything in stagingDir first to avoid polluting the live dir.
-	cfgCopy := *cfg
-	cfgCopy.Template.Dir = stagingDir
-	if _, err := runtime.Build(logger, configPath, baseDir, &cfgCopy); err != nil {
+	// Build the runtime that a reload of the imported files would produce,
+	// compiling templates from stagingDir so the live dir is untouched. This
+	// is the slow part and runs before any reload is held up.
+	nextCfg, err := config.Parse(cfgBytes, baseDir)
+	if err != nil {
 		return err
 	}
+	nextCfg.Template.Dir = stagingDir
+	next, err := runtime.Build(logger, configPath, baseDir, nextCfg)
+	if err != nil {
+		return err
+	}
+	nextCfg.Template.Dir = newTemplatesDir
 
 	var backupDir string
-	if st, err := os.Stat(newTemplatesDir); err == nil && st.IsDir() {
-		backupDir = newTemplatesDir + ".bak-" + time.Now().Format("20060102150405")
-		_ = os.RemoveAll(backupDir)
-		if err := os.Rename(newTemplatesDir, backupDir); err != nil {
-			return err
+	commit := func() error {
+		if st, err := os.Stat(newTemplatesDir); err == nil && st.IsDir() {
+			backupDir = newTemplatesDir + ".bak-" + time.Now().Format("20060102150405")
+			_ = os.RemoveAll(backupDir)
+			if err := os.Rename(newTemplatesDir, backupDir); err != nil {
+				backupDir = ""
+				return err
+			}
 		}
-	}
 
-	restoreTemplates := func() {
-		_ = os.RemoveAll(newTemplatesDir)
-		if backupDir != "" {
-			_ = os.Rename(backupDir, newTemplatesDir)
+		if err := os.Rename(stagingDir, newTemplatesDir); err != nil {
+			if backupDir != "" {
+				_ = os.Rename(backupDir, newTemplatesDir)
+			}
+			return err
 		}
-	}
 
-	if err := os.Rename(stagingDir, newTemplatesDir); err != nil {
-		if backupDir != "" {
-			_ = os.Rename(backupDir, newTemplatesDir)
+		if err := writeFileAtomic(configPath, cfgBytes, 0o600); err != nil {
+			restoreConfig()
+			_ = os.RemoveAll(newTemplatesDir)
+			if backupDir != "" {
+				_ = os.Rename(backupDir, newTemplatesDir)
+			}
+			return err
 		}
-		return err
-	}
-
-	if err := writeFileAtomic(configPath, cfgBytes, 0o600); err != nil {
-		restoreConfig()
-		restoreTemplates()
-		return err
+		return nil
 	}
 
-	if err := reloadMgr.Reload(ctx, true); err != nil {
-		restoreConfig()
-		restoreTemplates()
-		_ = reloadMgr.Reload(ctx, true)
+	// Only the renames, the config write and the swap run under the reload
+	// lock; alerts keep being served from the current runtime throughout.
+	if err := reloadMgr.Install(ctx, next, commit); err != nil {
 		return err
 	}
 
@@ -1053,6 +1319,21 @@ func applyImport(ctx context.Context, logger *slog.Logger, reloadMgr *reload.Man
 	return nil
 }
 
+// writeAndReload writes data to path and reloads as a single reload, so a
+// watcher noticing the write does not reload the same files again; see
+// reload.Manager.Apply. written reports whether the file was written, i.e.
+// whether a failed reload needs to be rolled back.
+func (h *handler) writeAndReload(ctx context.Context, path string, data []byte, perm os.FileMode) (written bool, err error) {
+	err = h.reload.Apply(ctx, func() error {
+		if err := writeFileAtomic(path, data, perm); err != nil {
+			return err
+		}
+		written = true
+		return nil
+	})
+	return written, err
+}
+
 func sortedKeys[V any](m map[string]V) []string {
 	out := make([]string, 0, len(m))
 	for k := range m {
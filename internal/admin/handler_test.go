@@ -92,7 +92,7 @@ func TestApplyImport_RollbackDoesNotCorruptMissingConfig(t *testing.T) {
 		t.Fatalf("runtime.Build: %v", err)
 	}
 	store := runtime.NewStore(rt)
-	reloadMgr, err := reload.New(nil, configPath, store, false, 0)
+	reloadMgr, err := reload.New(nil, configPath, store, false, reload.ModePoll, 0)
 	if err != nil {
 		t.Fatalf("reload.New: %v", err)
 	}
@@ -0,0 +1,159 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/reload"
+	"prometheus-dingtalk-hook/internal/runtime"
+	"prometheus-dingtalk-hook/internal/server"
+)
+
+func TestApplyImport_WhileAlertsFlow(t *testing.T) {
+	var sends atomic.Int32
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sends.Add(1)
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	baseDir := t.TempDir()
+	configPath := filepath.Join(baseDir, "config.yaml")
+	templatesDir := filepath.Join(baseDir, "templates")
+	if err := os.MkdirAll(templatesDir, 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(templatesDir, "default.tmpl"), []byte("old {{ .Payload.Status }}"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	cfgText := func(title string) []byte {
+		return []byte(`
+template:
+  dir: "templates"
+  default: "default"
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "` + dt.URL + `"
+      msg_type: "markdown"
+      title: "` + title + `"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`)
+	}
+	if err := os.WriteFile(configPath, cfgText("before"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	rt, err := runtime.LoadFromFile(nil, configPath)
+	if err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	store := runtime.NewStore(rt)
+	mgr, err := reload.New(nil, configPath, store, false, reload.ModePoll, 0)
+	if err != nil {
+		t.Fatalf("reload.New: %v", err)
+	}
+	alerts := server.NewHandler(server.HandlerOptions{
+		State:        store,
+		Reload:       mgr,
+		MaxBodyBytes: 1 << 20,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	var failures atomic.Int32
+	var delivered atomic.Int32
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				body := `{"status":"firing","alerts":[{"status":"firing","labels":{"alertname":"A"}}]}`
+				rr := httptest.NewRecorder()
+				alerts.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(body)))
+				if rr.Code != http.StatusOK {
+					failures.Add(1)
+					t.Errorf("alert status=%d body=%s", rr.Code, rr.Body.String())
+					return
+				}
+				delivered.Add(1)
+			}
+		}()
+	}
+	// A poller racing the import must never load a half-written one.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			if err := mgr.ReloadIfChanged(ctx); err != nil && ctx.Err() == nil {
+				t.Errorf("ReloadIfChanged: %v", err)
+				return
+			}
+		}
+	}()
+
+	for delivered.Load() < 10 && failures.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	newCfg := cfgText("after")
+	parsed, err := config.Parse(newCfg, baseDir)
+	if err != nil {
+		t.Fatalf("config.Parse: %v", err)
+	}
+	before := delivered.Load()
+	err = applyImport(ctx, nil, mgr, configPath, parsed, newCfg, map[string][]byte{
+		"default": []byte("new {{ .Payload.Status }}"),
+	})
+	if err != nil {
+		t.Fatalf("applyImport: %v", err)
+	}
+	for delivered.Load() < before+10 && failures.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+
+	got := store.Load()
+	if got.Config.Template.Dir != templatesDir {
+		t.Fatalf("template dir=%q, want %q", got.Config.Template.Dir, templatesDir)
+	}
+	if got.Robots["r1"].Title != "after" {
+		t.Fatalf("robot title=%q, want after", got.Robots["r1"].Title)
+	}
+	out, err := got.Renderer.Render("default", alertmanager.WebhookMessage{Status: "firing"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if out != "new firing" {
+		t.Fatalf("render=%q, want imported template", out)
+	}
+	if st := mgr.Status(); st.Changed || st.LastError != "" {
+		t.Fatalf("status after import: %+v", st)
+	}
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "templates.bak-") || strings.HasPrefix(e.Name(), ".import-") {
+			t.Fatalf("leftover %s after import", e.Name())
+		}
+	}
+	if sends.Load() == 0 {
+		t.Fatalf("no alerts reached dingtalk")
+	}
+}
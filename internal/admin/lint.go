@@ -0,0 +1,72 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/runtime"
+	"prometheus-dingtalk-hook/internal/template"
+)
+
+// handleLint checks a template against a sample payload without saving it.
+// Syntax and render failures are reported as errors; fields required by
+// template.requirements but absent from the sample are only warnings.
+func (h *handler) handleLint(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, apiResp{Code: 1, Message: "method not allowed"})
+		return
+	}
+
+	var req struct {
+		Template     string                      `json:"template"`
+		TemplateText string                      `json:"template_text"`
+		Payload      alertmanager.WebhookMessage `json:"payload"`
+		Sample       string                      `json:"sample"`
+	}
+	if err := decodeJSONLimited(r.Body, &req, 2<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
+		return
+	}
+	if !h.resolveSample(w, rt, req.Sample, &req.Payload) {
+		return
+	}
+
+	name := strings.TrimSpace(req.Template)
+	text := req.TemplateText
+	if strings.TrimSpace(text) == "" {
+		if name == "" {
+			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: "template or template_text is required"})
+			return
+		}
+		var err error
+		if text, err = h.readTemplate(rt, name); err != nil {
+			writeJSON(w, http.StatusNotFound, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
+	}
+
+	errs := []string{}
+	if err := template.ValidateText(text); err != nil {
+		errs = append(errs, err.Error())
+	} else if _, err := rt.Renderer.RenderText(text, req.Payload); err != nil {
+		errs = append(errs, err.Error())
+	}
+	warnings := templateWarnings(rt, name, req.Payload)
+
+	writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: map[string]any{
+		"errors":   errs,
+		"warnings": warnings,
+	}})
+}
+
+// templateWarnings reports the template.requirements of name that payload
+// does not meet.
+func templateWarnings(rt *runtime.Runtime, name string, payload alertmanager.WebhookMessage) []string {
+	out := []string{}
+	if req, ok := rt.Config.Template.Requirements[name]; ok {
+		out = append(out, template.MissingFields(req, payload)...)
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_handleLint_TemplateRequirements(t *testing.T) {
+	cfg := &config.Config{
+		Template: config.TemplateConfig{
+			Requirements: map[string]config.TemplateRequirement{
+				"default": {Labels: []string{"instance"}, Annotations: []string{"runbook_url"}},
+			},
+		},
+		DingTalk: config.DingTalkConfig{
+			Robots:   []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+
+	lint := func(body string) (errs, warnings []string) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		(&handler{}).handleLint(rr, httptest.NewRequest(http.MethodPost, "/api/v1/lint", strings.NewReader(body)), rt)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		var resp struct {
+			Data struct {
+				Errors   []string `json:"errors"`
+				Warnings []string `json:"warnings"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("json: %v", err)
+		}
+		return resp.Data.Errors, resp.Data.Warnings
+	}
+
+	errs, warnings := lint(`{"template":"default","payload":{"status":"firing","commonAnnotations":{"runbook_url":"http://wiki"},
+		"alerts":[{"status":"firing","labels":{"instance":"a"}},{"status":"firing","labels":{"instance":"b"}}]}}`)
+	if len(errs) != 0 || len(warnings) != 0 {
+		t.Fatalf("satisfied: errors=%v warnings=%v", errs, warnings)
+	}
+
+	errs, warnings = lint(`{"template":"default","payload":{"status":"firing",
+		"alerts":[{"status":"firing","labels":{"instance":"a"}},{"status":"firing","labels":{}}]}}`)
+	if len(errs) != 0 {
+		t.Fatalf("missing: errors=%v", errs)
+	}
+	want := []string{`label "instance" is missing in 1 of 2 alerts`, `annotation "runbook_url" is missing in 2 of 2 alerts`}
+	if strings.Join(warnings, "|") != strings.Join(want, "|") {
+		t.Fatalf("warnings=%v want %v", warnings, want)
+	}
+
+	errs, _ = lint(`{"template_text":"{{ .Nope","payload":{}}`)
+	if len(errs) != 1 {
+		t.Fatalf("syntax error not reported: %v", errs)
+	}
+}
@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/dingtalk"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+// robotTestInterval is the minimum time between connectivity tests of the
+// same robot, so the endpoint cannot be used to flood DingTalk.
+const robotTestInterval = 10 * time.Second
+
+// robotTestLimiter remembers when each robot was last tested.
+type robotTestLimiter struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// allow reports whether name may be tested now and, if so, records the test.
+func (l *robotTestLimiter) allow(name string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.last == nil {
+		l.last = make(map[string]time.Time)
+	}
+	if wait := robotTestInterval - now.Sub(l.last[name]); wait > 0 {
+		return wait, false
+	}
+	l.last[name] = now
+	return 0, true
+}
+
+// handleRobotTest sends a connectivity test message through a robot. The
+// webhook and secret may be supplied in the body to test unsaved values;
+// empty fields fall back to the saved robot, like the redacted config form.
+func (h *handler) handleRobotTest(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime, name string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, apiResp{Code: 1, Message: "method not allowed"})
+		return
+	}
+
+	var req struct {
+		Webhook string `json:"webhook"`
+		Secret  string `json:"secret"`
+	}
+	if r.ContentLength != 0 {
+		if err := decodeJSONLimited(r.Body, &req, 64<<10); err != nil {
+			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
+	}
+
+	robot, ok := rt.Robots[name]
+	if !ok && strings.TrimSpace(req.Webhook) == "" {
+		writeJSON(w, http.StatusNotFound, apiResp{Code: 1, Message: "unknown robot"})
+		return
+	}
+	robot.Name = name
+	if v := strings.TrimSpace(req.Webhook); v != "" {
+		robot.Webhook = v
+	}
+	if v := strings.TrimSpace(req.Secret); v != "" {
+		robot.Secret = config.SecretList{v}
+	}
+
+	if wait, ok := h.robotTests.allow(name, time.Now()); !ok {
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(wait.Seconds()+0.999)))
+		writeJSON(w, http.StatusTooManyRequests, apiResp{Code: 1, Message: "robot was tested recently, retry later"})
+		return
+	}
+
+	content := "#### 连通性测试\n\nprometheus-dingtalk-hook 发送的测试消息，可忽略。"
+	if kw := strings.TrimSpace(robot.Keyword); kw != "" && !strings.Contains(content, kw) {
+		content += "\n\n" + kw
+	}
+	err := rt.DingTalk.SendTo(r.Context(), runtime.Target(robot), dingtalk.Message{
+		MsgType:  "markdown",
+		Title:    "连通性测试",
+		Markdown: content,
+	})
+
+	data := map[string]any{"ok": err == nil}
+	var apiErr *dingtalk.APIError
+	if errors.As(err, &apiErr) {
+		data["errcode"] = apiErr.ErrCode
+		data["errmsg"] = apiErr.ErrMsg
+	} else if err == nil {
+		data["errcode"] = 0
+		data["errmsg"] = "ok"
+	}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	h.audit(r, "robot.test", "robot "+name+" connectivity test", err)
+	writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: data})
+}
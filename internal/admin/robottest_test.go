@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_handleRobotTest(t *testing.T) {
+	var hits atomic.Int32
+	var lastBody atomic.Value
+	saved := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		b, _ := io.ReadAll(r.Body)
+		lastBody.Store(string(b))
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(saved.Close)
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"errcode":300001,"errmsg":"token is not exist"}`))
+	}))
+	t.Cleanup(rejecting.Close)
+
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout: config.Duration(2 * time.Second),
+			Robots: []config.RobotConfig{
+				{Name: "r1", Webhook: saved.URL, MsgType: "markdown", Keyword: "告警"},
+				{Name: "r2", Webhook: saved.URL, MsgType: "markdown"},
+			},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1", "r2"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := &handler{}
+
+	type result struct {
+		OK      bool   `json:"ok"`
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	test := func(name, body string) (int, result) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		h.handleRobotTest(rr, httptest.NewRequest(http.MethodPost, "/api/v1/robots/"+name+"/test", strings.NewReader(body)), rt, name)
+		var resp struct {
+			Data result `json:"data"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp.Data
+	}
+
+	if code, res := test("r1", ""); code != http.StatusOK || !res.OK || res.ErrCode != 0 {
+		t.Fatalf("saved webhook: status=%d result=%+v", code, res)
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("hits=%d want 1", hits.Load())
+	}
+	if body, _ := lastBody.Load().(string); !strings.Contains(body, "告警") {
+		t.Fatalf("test message lacks robot keyword: %s", body)
+	}
+
+	if code, _ := test("r1", ""); code != http.StatusTooManyRequests {
+		t.Fatalf("second test status=%d want 429", code)
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("rate-limited test reached DingTalk")
+	}
+
+	code, res := test("r2", `{"webhook":"`+rejecting.URL+`"}`)
+	if code != http.StatusOK || res.OK || res.ErrCode != 300001 || res.ErrMsg != "token is not exist" {
+		t.Fatalf("supplied webhook: status=%d result=%+v", code, res)
+	}
+
+	if code, _ := test("missing", ""); code != http.StatusNotFound {
+		t.Fatalf("unknown robot status=%d want 404", code)
+	}
+}
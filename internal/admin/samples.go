@@ -0,0 +1,214 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+const (
+	// maxSampleBytes bounds a single stored sample payload.
+	maxSampleBytes = 1 << 20
+	// maxSamples bounds the number of samples kept in the samples dir.
+	maxSamples = 100
+)
+
+var errSampleNotFound = errors.New("sample not found")
+
+// samplesDir returns admin.samples_dir, or "samples" next to the config file.
+func (h *handler) samplesDir(rt *runtime.Runtime) string {
+	if dir := strings.TrimSpace(rt.Config.Admin.SamplesDir); dir != "" {
+		return dir
+	}
+	return filepath.Join(filepath.Dir(h.configPath), "samples")
+}
+
+// sampleNames lists the stored samples, sorted.
+func sampleNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() || !config.ValidTemplateName(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (h *handler) handleSamples(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, apiResp{Code: 1, Message: "method not allowed"})
+		return
+	}
+	names, err := sampleNames(h.samplesDir(rt))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: map[string]any{
+		"samples": names,
+	}})
+}
+
+// handleSample reads, creates (POST), replaces (PUT) or deletes a named
+// sample payload stored as <samples dir>/<name>.json.
+func (h *handler) handleSample(w http.ResponseWriter, r *http.Request, rt *runtime.Runtime, name string) {
+	if !config.ValidTemplateName(name) {
+		writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: "invalid sample name"})
+		return
+	}
+	dir := h.samplesDir(rt)
+	if err := ensureUnderBase(filepath.Dir(h.configPath), dir); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
+		return
+	}
+	path := filepath.Join(dir, name+".json")
+
+	switch r.Method {
+	case http.MethodGet:
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			writeJSON(w, http.StatusNotFound, apiResp{Code: 1, Message: errSampleNotFound.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(data)
+		return
+
+	case http.MethodPost, http.MethodPut:
+		data, err := readLimited(r.Body, maxSampleBytes)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
+		var msg alertmanager.WebhookMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: "invalid json: " + err.Error()})
+			return
+		}
+
+		_, statErr := os.Stat(path)
+		exists := statErr == nil
+		if exists && r.Method == http.MethodPost {
+			writeJSON(w, http.StatusConflict, apiResp{Code: 1, Message: "sample already exists"})
+			return
+		}
+		if !exists {
+			names, err := sampleNames(dir)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
+				return
+			}
+			if len(names) >= maxSamples {
+				writeJSON(w, http.StatusConflict, apiResp{Code: 1, Message: fmt.Sprintf("at most %d samples are allowed", maxSamples)})
+				return
+			}
+		}
+
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
+		summary := fmt.Sprintf("sample %s created (%d bytes)", name, len(data))
+		if exists {
+			summary = fmt.Sprintf("sample %s updated (%d bytes)", name, len(data))
+		}
+		if err := writeFileAtomic(path, data, 0o644); err != nil {
+			h.audit(r, "sample.put", summary, err)
+			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
+		h.audit(r, "sample.put", summary, nil)
+		writeJSON(w, http.StatusOK, apiResp{Code: 0, Message: "ok"})
+		return
+
+	case http.MethodDelete:
+		err := os.Remove(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			writeJSON(w, http.StatusNotFound, apiResp{Code: 1, Message: errSampleNotFound.Error()})
+			return
+		}
+		summary := "sample " + name + " deleted"
+		h.audit(r, "sample.delete", summary, err)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, apiResp{Code: 0, Message: "ok"})
+		return
+
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}, ", "))
+		writeJSON(w, http.StatusMethodNotAllowed, apiResp{Code: 1, Message: "method not allowed"})
+		return
+	}
+}
+
+// loadSample reads the named sample payload.
+func (h *handler) loadSample(rt *runtime.Runtime, name string) (alertmanager.WebhookMessage, error) {
+	var msg alertmanager.WebhookMessage
+	if !config.ValidTemplateName(name) {
+		return msg, errors.New("invalid sample name")
+	}
+	dir := h.samplesDir(rt)
+	if err := ensureUnderBase(filepath.Dir(h.configPath), dir); err != nil {
+		return msg, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return msg, errSampleNotFound
+	}
+	if err != nil {
+		return msg, err
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return msg, fmt.Errorf("sample %s: %w", name, err)
+	}
+	return msg, nil
+}
+
+// resolveSample replaces *payload with the named sample when name is set.
+// It writes the error response and returns false when the sample cannot be
+// loaded.
+func (h *handler) resolveSample(w http.ResponseWriter, rt *runtime.Runtime, name string, payload *alertmanager.WebhookMessage) bool {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return true
+	}
+	msg, err := h.loadSample(rt, name)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errSampleNotFound) {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, apiResp{Code: 1, Message: err.Error()})
+		return false
+	}
+	*payload = msg
+	return true
+}
@@ -0,0 +1,140 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func samplesTestHandler(t *testing.T) (*handler, *runtime.Runtime, string) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Robots:   []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := &handler{logger: slog.Default(), configPath: filepath.Join(dir, "config.yaml"), store: runtime.NewStore(rt)}
+	return h, rt, dir
+}
+
+func TestHandler_SamplesCRUD(t *testing.T) {
+	h, rt, dir := samplesTestHandler(t)
+
+	do := func(method, name, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/api/v1/samples/"+name, strings.NewReader(body))
+		if name == "" {
+			h.handleSamples(rr, req, rt)
+		} else {
+			h.handleSample(rr, req, rt, name)
+		}
+		return rr
+	}
+	list := func() []string {
+		t.Helper()
+		rr := do(http.MethodGet, "", "")
+		var resp struct {
+			Data struct {
+				Samples []string `json:"samples"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("json: %v", err)
+		}
+		return resp.Data.Samples
+	}
+
+	if got := list(); len(got) != 0 {
+		t.Fatalf("samples=%v want none", got)
+	}
+
+	payload := `{"receiver":"ops","status":"firing","alerts":[{"status":"firing","labels":{"alertname":"DiskFull"}}]}`
+	if rr := do(http.MethodPost, "disk", payload); rr.Code != http.StatusOK {
+		t.Fatalf("create status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodPost, "disk", payload); rr.Code != http.StatusConflict {
+		t.Fatalf("duplicate create status=%d", rr.Code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "samples", "disk.json")); err != nil {
+		t.Fatalf("sample not stored under samples dir: %v", err)
+	}
+	if got := list(); len(got) != 1 || got[0] != "disk" {
+		t.Fatalf("samples=%v want [disk]", got)
+	}
+
+	updated := strings.Replace(payload, "DiskFull", "DiskAlmostFull", 1)
+	if rr := do(http.MethodPut, "disk", updated); rr.Code != http.StatusOK {
+		t.Fatalf("update status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodGet, "disk", ""); rr.Code != http.StatusOK || rr.Body.String() != updated {
+		t.Fatalf("get status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	if rr := do(http.MethodPut, "bad", "{not json"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid json status=%d", rr.Code)
+	}
+	if rr := do(http.MethodPut, "..", payload); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid name status=%d", rr.Code)
+	}
+
+	if rr := do(http.MethodDelete, "disk", ""); rr.Code != http.StatusOK {
+		t.Fatalf("delete status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodGet, "disk", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("get after delete status=%d", rr.Code)
+	}
+	if rr := do(http.MethodDelete, "disk", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("second delete status=%d", rr.Code)
+	}
+}
+
+func TestHandler_SamplesOutsideBaseRejected(t *testing.T) {
+	h, rt, _ := samplesTestHandler(t)
+	rt.Config.Admin.SamplesDir = t.TempDir()
+
+	rr := httptest.NewRecorder()
+	h.handleSample(rr, httptest.NewRequest(http.MethodPut, "/api/v1/samples/x", strings.NewReader(`{}`)), rt, "x")
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandler_handleRender_Sample(t *testing.T) {
+	h, rt, dir := samplesTestHandler(t)
+	if err := os.MkdirAll(filepath.Join(dir, "samples"), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	payload := `{"status":"firing","alerts":[{"status":"firing","annotations":{"summary":"disk almost full"}}]}`
+	if err := os.WriteFile(filepath.Join(dir, "samples", "disk.json"), []byte(payload), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	render := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.handleRender(rr, httptest.NewRequest(http.MethodPost, "/api/v1/render", strings.NewReader(body)), rt)
+		return rr
+	}
+
+	rr := render(`{"template":"default","sample":"disk"}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "disk almost full") {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := render(`{"template":"default","sample":"missing"}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("missing sample status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
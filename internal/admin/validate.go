@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"prometheus-dingtalk-hook/internal/config"
+)
+
+// handleConfigValidate checks a candidate config the way PUT /api/v1/config
+// (YAML body) or PUT /api/v1/config/json (JSON body) would, without writing
+// it or reloading.
+func (h *handler) handleConfigValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, apiResp{Code: 1, Message: "method not allowed"})
+		return
+	}
+
+	data, err := readLimited(r.Body, 2<<20)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
+		return
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		var req struct {
+			Config         config.Config        `json:"config"`
+			ClearSensitive configClearSensitive `json:"clear_sensitive"`
+		}
+		if err := decodeJSONLimited(bytes.NewReader(data), &req, 2<<20); err != nil {
+			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
+		oldCfgBytes, err := os.ReadFile(h.configPath)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
+		oldCfg, err := config.Parse(oldCfgBytes, filepath.Dir(h.configPath))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
+		if data, err = mergeConfigJSON(req.Config, oldCfg, req.ClearSensitive); err != nil {
+			writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error()})
+			return
+		}
+	}
+
+	errs := []config.FieldError{}
+	if _, err := h.buildConfig(data); err != nil {
+		errs = configErrors(err)
+	}
+	writeJSON(w, http.StatusOK, apiResp{Code: 0, Data: map[string]any{
+		"valid":  len(errs) == 0,
+		"errors": errs,
+	}})
+}
+
+// configErrors converts a config parse or build failure to field errors;
+// failures not tied to a field, such as YAML syntax errors, have no path.
+func configErrors(err error) []config.FieldError {
+	var fe *config.FieldError
+	if errors.As(err, &fe) {
+		return []config.FieldError{*fe}
+	}
+	return []config.FieldError{{Message: err.Error()}}
+}
+
+// writeConfigError answers a rejected config with its field errors.
+func writeConfigError(w http.ResponseWriter, err error) {
+	writeJSON(w, http.StatusBadRequest, apiResp{Code: 1, Message: err.Error(), Data: map[string]any{
+		"errors": configErrors(err),
+	}})
+}
@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"prometheus-dingtalk-hook/internal/config"
+)
+
+func TestHandler_handleConfigValidate(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(acceptTestConfig), 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	h := &handler{configPath: configPath}
+
+	type result struct {
+		Valid  bool                `json:"valid"`
+		Errors []config.FieldError `json:"errors"`
+	}
+	validate := func(body []byte, contentType string) result {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/config/validate", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		h.handleConfigValidate(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		var resp struct {
+			Data result `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("json.Unmarshal: %v", err)
+		}
+		return resp.Data
+	}
+
+	if res := validate([]byte(acceptTestConfig), "text/yaml"); !res.Valid || len(res.Errors) != 0 {
+		t.Fatalf("valid yaml: %+v", res)
+	}
+
+	bad := strings.Replace(acceptTestConfig, `robots: ["r1"]`, `robots: ["missing"]`, 1)
+	res := validate([]byte(bad), "text/yaml")
+	if res.Valid || len(res.Errors) != 1 || res.Errors[0].Path != "dingtalk.channels[default].robots" {
+		t.Fatalf("invalid yaml: %+v", res)
+	}
+
+	res = validate([]byte("dingtalk: ["), "text/yaml")
+	if res.Valid || len(res.Errors) != 1 || res.Errors[0].Path != "" {
+		t.Fatalf("yaml syntax error: %+v", res)
+	}
+
+	// The JSON form carries redacted secrets; they are merged back from the
+	// saved config exactly as PUT /api/v1/config/json does.
+	cfg, err := config.Parse([]byte(acceptTestConfig), dir)
+	if err != nil {
+		t.Fatalf("config.Parse: %v", err)
+	}
+	cfg.Auth.Token = ""
+	cfg.DingTalk.Robots[0].Webhook = ""
+	body, err := json.Marshal(map[string]any{"config": cfg})
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	if res := validate(body, "application/json"); !res.Valid {
+		t.Fatalf("redacted json: %+v", res)
+	}
+	body, err = json.Marshal(map[string]any{"config": cfg, "clear_sensitive": map[string]any{"robots": map[string]any{"r1": map[string]bool{"webhook": true}}}})
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	res = validate(body, "application/json")
+	if res.Valid || len(res.Errors) != 1 || res.Errors[0].Path != "dingtalk.robots[r1].webhook" {
+		t.Fatalf("cleared webhook: %+v", res)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("os.ReadFile: %v", err)
+	}
+	if string(data) != acceptTestConfig {
+		t.Fatalf("config file modified: %q", data)
+	}
+}
@@ -0,0 +1,121 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Decode decodes a webhook payload. When it does not decode as a whole and
+// tolerant is set (server.tolerant_json), the alerts are decoded one by one
+// and the malformed ones dropped; the number dropped is returned.
+func Decode(data []byte, tolerant bool, logger *slog.Logger) (WebhookMessage, int, error) {
+	var msg WebhookMessage
+	err := json.Unmarshal(data, &msg)
+	if err == nil || !tolerant {
+		return msg, 0, err
+	}
+	return decodeTolerant(data, logger)
+}
+
+// UnmarshalJSON decodes m, tolerating fields that some Alertmanager versions
+// omit or send as null: the label and annotation maps are never nil after
+// decoding.
+func (m *WebhookMessage) UnmarshalJSON(data []byte) error {
+	type plain WebhookMessage
+	if err := json.Unmarshal(data, (*plain)(m)); err != nil {
+		return err
+	}
+	m.GroupLabels = nonNilMap(m.GroupLabels)
+	m.CommonLabels = nonNilMap(m.CommonLabels)
+	m.CommonAnnotations = nonNilMap(m.CommonAnnotations)
+	return nil
+}
+
+// UnmarshalJSON decodes a, accepting second or sub-second RFC 3339
+// timestamps and treating empty or null ones as the zero time.
+func (a *Alert) UnmarshalJSON(data []byte) error {
+	type plain Alert
+	aux := struct {
+		*plain
+		StartsAt timestamp `json:"startsAt"`
+		EndsAt   timestamp `json:"endsAt"`
+	}{plain: (*plain)(a)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	a.StartsAt = time.Time(aux.StartsAt)
+	a.EndsAt = time.Time(aux.EndsAt)
+	a.Labels = nonNilMap(a.Labels)
+	a.Annotations = nonNilMap(a.Annotations)
+	return nil
+}
+
+type timestamp time.Time
+
+func (t *timestamp) UnmarshalJSON(data []byte) error {
+	var s *string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s == nil || strings.TrimSpace(*s) == "" {
+		*t = timestamp{}
+		return nil
+	}
+	// RFC3339Nano also parses timestamps without fractional seconds.
+	parsed, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(*s))
+	if err != nil {
+		return err
+	}
+	*t = timestamp(parsed)
+	return nil
+}
+
+func nonNilMap(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+// decodeTolerant decodes the alerts array element by element, dropping the
+// alerts that fail to decode. It returns the number of dropped alerts.
+func decodeTolerant(data []byte, logger *slog.Logger) (WebhookMessage, int, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	// Decode the envelope without its alerts, which are decoded one by one.
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return WebhookMessage{}, 0, err
+	}
+	var rawAlerts []json.RawMessage
+	if v, ok := fields["alerts"]; ok {
+		if err := json.Unmarshal(v, &rawAlerts); err != nil {
+			return WebhookMessage{}, 0, err
+		}
+		delete(fields, "alerts")
+	}
+	envelope, err := json.Marshal(fields)
+	if err != nil {
+		return WebhookMessage{}, 0, err
+	}
+	var msg WebhookMessage
+	if err := json.Unmarshal(envelope, &msg); err != nil {
+		return WebhookMessage{}, 0, err
+	}
+
+	msg.Alerts = make([]Alert, 0, len(rawAlerts))
+	var skipped int
+	for i, item := range rawAlerts {
+		var a Alert
+		if err := json.Unmarshal(item, &a); err != nil {
+			logger.Warn("skip malformed alert", "index", i, "err", err)
+			skipped++
+			continue
+		}
+		msg.Alerts = append(msg.Alerts, a)
+	}
+	return msg, skipped, nil
+}
@@ -0,0 +1,46 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestUnmarshal_SparsePayloads(t *testing.T) {
+	startsAt := time.Date(2024, 5, 1, 16, 30, 0, 0, time.UTC)
+	for name, tc := range map[string]struct {
+		body     string
+		startsAt time.Time
+		endsAt   time.Time
+	}{
+		"empty object":   {body: `{"alerts":[{}]}`},
+		"null maps":      {body: `{"commonLabels":null,"commonAnnotations":null,"groupLabels":null,"alerts":[{"labels":null,"annotations":null}]}`},
+		"seconds":        {body: `{"alerts":[{"startsAt":"2024-05-01T16:30:00Z"}]}`, startsAt: startsAt},
+		"nanoseconds":    {body: `{"alerts":[{"startsAt":"2024-05-01T16:30:00.000000123Z"}]}`, startsAt: startsAt.Add(123)},
+		"offset":         {body: `{"alerts":[{"startsAt":"2024-05-02T00:30:00+08:00"}]}`, startsAt: startsAt},
+		"empty endsAt":   {body: `{"alerts":[{"startsAt":"2024-05-01T16:30:00Z","endsAt":""}]}`, startsAt: startsAt},
+		"null endsAt":    {body: `{"alerts":[{"endsAt":null}]}`},
+		"zero endsAt":    {body: `{"alerts":[{"endsAt":"0001-01-01T00:00:00Z"}]}`},
+		"resolved times": {body: `{"alerts":[{"startsAt":"2024-05-01T16:30:00Z","endsAt":"2024-05-01T17:00:00.5Z"}]}`, startsAt: startsAt, endsAt: startsAt.Add(30*time.Minute + 500*time.Millisecond)},
+	} {
+		var msg WebhookMessage
+		if err := json.Unmarshal([]byte(tc.body), &msg); err != nil {
+			t.Fatalf("%s: Unmarshal: %v", name, err)
+		}
+		if msg.GroupLabels == nil || msg.CommonLabels == nil || msg.CommonAnnotations == nil {
+			t.Fatalf("%s: nil common maps: %+v", name, msg)
+		}
+		a := msg.Alerts[0]
+		if a.Labels == nil || a.Annotations == nil {
+			t.Fatalf("%s: nil alert maps: %+v", name, a)
+		}
+		if !a.StartsAt.Equal(tc.startsAt) || !a.EndsAt.Equal(tc.endsAt) {
+			t.Fatalf("%s: startsAt=%s endsAt=%s", name, a.StartsAt, a.EndsAt)
+		}
+	}
+
+	var msg WebhookMessage
+	if err := json.Unmarshal([]byte(`{"alerts":[{"startsAt":"yesterday"}]}`), &msg); err == nil {
+		t.Fatalf("expected error for invalid timestamp")
+	}
+}
@@ -0,0 +1,84 @@
+// Package capture keeps a bounded in-memory history of raw alert request bodies for debugging.
+package capture
+
+import (
+	"sync"
+	"time"
+)
+
+type Entry struct {
+	ID         uint64    `json:"id"`
+	ReceivedAt time.Time `json:"received_at"`
+	Body       []byte    `json:"-"`
+}
+
+type Summary struct {
+	ID         uint64    `json:"id"`
+	ReceivedAt time.Time `json:"received_at"`
+	Size       int       `json:"size"`
+}
+
+type Buffer struct {
+	mu      sync.Mutex
+	nextID  uint64
+	entries []Entry
+}
+
+func New() *Buffer {
+	return &Buffer{}
+}
+
+// Add records body and evicts the oldest entries so at most max remain.
+// A non-positive max clears the buffer and records nothing.
+func (b *Buffer) Add(body []byte, max int) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if max <= 0 {
+		b.entries = nil
+		return 0
+	}
+
+	b.nextID++
+	b.entries = append(b.entries, Entry{
+		ID:         b.nextID,
+		ReceivedAt: time.Now(),
+		Body:       append([]byte(nil), body...),
+	})
+	if over := len(b.entries) - max; over > 0 {
+		b.entries = append([]Entry(nil), b.entries[over:]...)
+	}
+	return b.nextID
+}
+
+func (b *Buffer) Get(id uint64) (Entry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, e := range b.entries {
+		if e.ID == id {
+			e.Body = append([]byte(nil), e.Body...)
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// List returns summaries of the captured entries, newest first.
+func (b *Buffer) List() []Summary {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	out := make([]Summary, 0, len(b.entries))
+	for i := len(b.entries) - 1; i >= 0; i-- {
+		e := b.entries[i]
+		out = append(out, Summary{ID: e.ID, ReceivedAt: e.ReceivedAt, Size: len(e.Body)})
+	}
+	return out
+}
+
+func (b *Buffer) Clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = nil
+}
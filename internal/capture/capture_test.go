@@ -0,0 +1,39 @@
+package capture
+
+import "testing"
+
+func TestBuffer_AddEvictsOldest(t *testing.T) {
+	b := New()
+	for i := 0; i < 5; i++ {
+		b.Add([]byte{byte('a' + i)}, 3)
+	}
+
+	list := b.List()
+	if len(list) != 3 {
+		t.Fatalf("len(List)=%d want 3", len(list))
+	}
+	if list[0].ID != 5 || list[2].ID != 3 {
+		t.Fatalf("ids=%d..%d want 5..3", list[0].ID, list[2].ID)
+	}
+	if _, ok := b.Get(2); ok {
+		t.Fatalf("entry 2 should be evicted")
+	}
+	e, ok := b.Get(4)
+	if !ok {
+		t.Fatalf("entry 4 missing")
+	}
+	if string(e.Body) != "d" {
+		t.Fatalf("body=%q want %q", e.Body, "d")
+	}
+}
+
+func TestBuffer_AddNonPositiveMaxClears(t *testing.T) {
+	b := New()
+	b.Add([]byte("x"), 10)
+	if id := b.Add([]byte("y"), 0); id != 0 {
+		t.Fatalf("id=%d want 0", id)
+	}
+	if n := len(b.List()); n != 0 {
+		t.Fatalf("len(List)=%d want 0", n)
+	}
+}
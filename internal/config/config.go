@@ -3,45 +3,179 @@ package config
 
 import (
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 
-	"gopkg.in/yaml.v3"
+	"prometheus-dingtalk-hook/internal/expr"
 )
 
 type Config struct {
+	// Includes lists further config files, directories or glob patterns,
+	// relative to the config file, merged after it; see Parse.
+	Includes []string       `yaml:"includes"`
 	Server   ServerConfig   `yaml:"server"`
 	Auth     AuthConfig     `yaml:"auth"`
 	Admin    AdminConfig    `yaml:"admin"`
 	Reload   ReloadConfig   `yaml:"reload"`
 	Template TemplateConfig `yaml:"template"`
 	DingTalk DingTalkConfig `yaml:"dingtalk"`
+	Forward  ForwardConfig  `yaml:"forward"`
+
+	// includedPaths are the files and directories merged in by Includes or
+	// a config directory.
+	includedPaths []string
+}
+
+// ForwardConfig mirrors the raw Alertmanager payload of every accepted
+// notification to other HTTP endpoints, independently of DingTalk routing.
+// Forwards run in the background and never fail the alert response.
+type ForwardConfig struct {
+	URLs []string `yaml:"urls"`
+	// Timeout bounds each forward request, 5s by default.
+	Timeout Duration `yaml:"timeout"`
+	// MaxPending bounds the forwards in flight, 100 by default. Payloads
+	// arriving while it is reached are dropped for the busy endpoints.
+	MaxPending int `yaml:"max_pending"`
+}
+
+// ForwardURLs returns the endpoints raw payloads are mirrored to:
+// forward.urls plus server.mirror_url, without duplicates.
+func (c *Config) ForwardURLs() []string {
+	urls := make([]string, 0, len(c.Forward.URLs)+1)
+	seen := make(map[string]struct{}, len(c.Forward.URLs)+1)
+	add := func(u string) {
+		u = strings.TrimSpace(u)
+		if _, ok := seen[u]; ok || u == "" {
+			return
+		}
+		seen[u] = struct{}{}
+		urls = append(urls, u)
+	}
+	for _, u := range c.Forward.URLs {
+		add(u)
+	}
+	add(c.Server.MirrorURL)
+	return urls
 }
 
 type ServerConfig struct {
-	Listen       string   `yaml:"listen"`
-	Path         string   `yaml:"path"`
+	Listen string `yaml:"listen"`
+	// TelemetryListen serves /healthz, /readyz and /metrics on a separate
+	// address instead of Listen; empty keeps them on Listen. Like Listen it
+	// is read at startup only.
+	TelemetryListen string `yaml:"telemetry_listen"`
+	Path            string `yaml:"path"`
+	// StrictPath serves alerts only on Path exactly; by default Path with
+	// its trailing slash added or removed ("/alert/" for "/alert") works too.
+	StrictPath   bool     `yaml:"strict_path"`
 	ReadTimeout  Duration `yaml:"read_timeout"`
 	WriteTimeout Duration `yaml:"write_timeout"`
 	IdleTimeout  Duration `yaml:"idle_timeout"`
 	MaxBodyBytes int64    `yaml:"max_body_bytes"`
+	// ShutdownTimeout bounds how long in-flight requests may drain after
+	// SIGINT/SIGTERM before the server is closed.
+	ShutdownTimeout Duration `yaml:"shutdown_timeout"`
+	// TolerantJSON decodes alerts one by one when the payload does not decode
+	// as a whole, so a single malformed alert does not drop the batch.
+	TolerantJSON bool `yaml:"tolerant_json"`
+	// DebugResponse adds the names of the matched routes to /alert responses.
+	DebugResponse bool `yaml:"debug_response"`
+	// AlertResponseMode decides the status of /alert when some sends fail:
+	// "strict" answers 500 on any failure so Alertmanager retries,
+	// "best_effort" answers 200 when at least one send succeeded, so a
+	// single failing robot does not make Alertmanager resend to the others.
+	AlertResponseMode string `yaml:"alert_response_mode"`
+	// MirrorURL is an endpoint, e.g. a SIEM, that receives every accepted
+	// payload as received, like an entry of forward.urls.
+	MirrorURL string `yaml:"mirror_url"`
+
+	// AllowedCIDRs restricts who may POST alerts; empty allows everyone.
+	// Forwarded headers are honored only for peers within TrustedProxies.
+	AllowedCIDRs   []string `yaml:"allowed_cidrs"`
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	// TLS serves HTTPS when both cert and key are set. The files are re-read
+	// on reload, so rotated certificates apply without a restart.
+	TLSCertFile  string `yaml:"tls_cert_file"`
+	TLSKeyFile   string `yaml:"tls_key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+	// TLSMinVersion is "1.2" (default) or "1.3". TLSCipherSuites restricts
+	// the TLS 1.2 cipher suites, by Go name such as
+	// "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"; empty keeps Go's defaults.
+	// TLS 1.3 suites are not configurable.
+	TLSMinVersion   string   `yaml:"tls_min_version"`
+	TLSCipherSuites []string `yaml:"tls_cipher_suites"`
+
+	Capture CaptureConfig `yaml:"capture"`
+}
+
+// CaptureConfig controls in-memory capture of raw alert bodies for admin replay.
+type CaptureConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	MaxEntries int  `yaml:"max_entries"`
 }
 
 type AuthConfig struct {
 	Token string `yaml:"token"`
+	// TokenFile is read into Token at load time; it excludes Token.
+	TokenFile string `yaml:"token_file"`
+	// HMACSecret enables verification of the X-Signature header, a hex
+	// HMAC-SHA256 of the raw request body keyed with this secret.
+	HMACSecret string `yaml:"hmac_secret"`
+	// HMACSecretFile is read into HMACSecret at load time; it excludes HMACSecret.
+	HMACSecretFile string `yaml:"hmac_secret_file"`
+	// RequireAll requires both the token and the signature when both are
+	// configured; otherwise either one is enough.
+	RequireAll bool `yaml:"require_all"`
 }
 
 type AdminConfig struct {
-	Enabled    bool            `yaml:"enabled"`
-	PathPrefix string          `yaml:"path_prefix"`
-	BasicAuth  BasicAuthConfig `yaml:"basic_auth"`
+	Enabled    bool   `yaml:"enabled"`
+	PathPrefix string `yaml:"path_prefix"`
+	// RedirectStatus is the status of the redirect from PathPrefix to
+	// PathPrefix + "/"; 0 means 302, which browsers do not cache, so a
+	// later prefix change does not leave stale redirects behind.
+	RedirectStatus int             `yaml:"redirect_status"`
+	BasicAuth      BasicAuthConfig `yaml:"basic_auth"`
+	Audit          AuditConfig     `yaml:"audit"`
+	// SamplesDir holds the named sample payloads managed through the admin
+	// API; empty means "samples" next to the config file.
+	SamplesDir string `yaml:"samples_dir"`
+	// RecentSends is how many sends GET /api/v1/sends/recent keeps;
+	// 0 means 100.
+	RecentSends int        `yaml:"recent_sends"`
+	CSRF        CSRFConfig `yaml:"csrf"`
+}
+
+// CSRFConfig requires a token on mutating admin requests, since browsers
+// replay Basic Auth credentials on cross-site requests.
+type CSRFConfig struct {
+	// Enabled defaults to true; turn it off only for API clients that
+	// cannot fetch a token first.
+	Enabled *bool `yaml:"enabled"`
+}
+
+// CSRFEnabled reports whether mutating admin requests need a CSRF token,
+// which is the default.
+func (c AdminConfig) CSRFEnabled() bool {
+	return c.CSRF.Enabled == nil || *c.CSRF.Enabled
+}
+
+// AuditConfig records mutating admin actions. File is an append-only JSON
+// lines file; when empty, entries go to the application log.
+type AuditConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	File    string `yaml:"file"`
 }
 
 type BasicAuthConfig struct {
@@ -52,33 +186,309 @@ type BasicAuthConfig struct {
 }
 
 type ReloadConfig struct {
-	Enabled  bool     `yaml:"enabled"`
+	Enabled bool `yaml:"enabled"`
+	// Mode is "poll" (stat files every Interval) or "watch" (filesystem
+	// notifications, falling back to polling when unavailable).
+	Mode     string   `yaml:"mode"`
 	Interval Duration `yaml:"interval"`
 }
 
 type TemplateConfig struct {
 	Dir string `yaml:"dir"`
+	// Inline is the text of the default template, replacing the embedded
+	// one without a template directory. A "default.tmpl" in Dir still takes
+	// precedence over it.
+	Inline string `yaml:"inline"`
+	// BodyAnnotation names an annotation whose value, when present, is sent
+	// as the message body instead of the rendered template.
+	BodyAnnotation string `yaml:"body_annotation"`
+	// ByReceiver renders alerts that match no route with the template named
+	// after the Alertmanager receiver, when such a template exists, instead
+	// of the default channel's template.
+	ByReceiver bool `yaml:"by_receiver"`
+	// Timezone is the IANA zone used by the toLocal template function;
+	// empty means the host's local zone.
+	Timezone string `yaml:"timezone"`
+	// TimeFormat is the Go layout used by the localTime template function,
+	// and so by the default template; empty means "2006-01-02 15:04:05".
+	TimeFormat string `yaml:"time_format"`
+	// TrimOutput strips leading and trailing whitespace from rendered
+	// output. Nil means true; see TrimOutputEnabled.
+	TrimOutput *bool `yaml:"trim_output"`
+	// Footer is a template appended to every message after a blank line,
+	// rendered with the same data as the message (counts, Now).
+	Footer string `yaml:"footer"`
+	// TextTitle is a template rendered with the same data as the message
+	// and prepended as the first line of text robot messages, which have no
+	// title field. Markdown titles are set by dingtalk.robots[].title.
+	TextTitle string `yaml:"text_title"`
+	// Requirements lists, per template name, the labels and annotations the
+	// template expects. They are only checked by the admin lint and render
+	// endpoints against a sample payload, never when sending.
+	Requirements map[string]TemplateRequirement `yaml:"requirements"`
+	// LabelFields and AnnotationFields list, in order, the labels and
+	// annotations the embedded default template shows for each alert.
+	// When both are empty it shows severity, description and summary.
+	LabelFields      []string `yaml:"label_fields"`
+	AnnotationFields []string `yaml:"annotation_fields"`
+	// SourceLink makes the embedded default template link each alert's
+	// generatorURL, the originating expression in Prometheus.
+	SourceLink bool `yaml:"source_link"`
+	// CoalesceFlapping keeps only the latest entry of an alert that appears
+	// both firing and resolved in one notification, before rendering.
+	CoalesceFlapping bool `yaml:"coalesce_flapping"`
+	// OnNameConflict decides what happens when two template files, or a
+	// file and a {{ define }} block, use the same template name: "error"
+	// (default) fails the load naming both files, "last_wins" keeps the one
+	// from the file that sorts last and reports the conflict as a warning.
+	OnNameConflict string `yaml:"on_name_conflict"`
+}
+
+// TemplateRequirement is the fields a template assumes every alert carries,
+// either on the alert itself or in the common labels/annotations.
+type TemplateRequirement struct {
+	Labels      []string `yaml:"labels"`
+	Annotations []string `yaml:"annotations"`
+}
+
+// TrimOutputEnabled reports whether rendered output is trimmed, which is
+// the default when trim_output is not set.
+func (c TemplateConfig) TrimOutputEnabled() bool {
+	return c.TrimOutput == nil || *c.TrimOutput
 }
 
 type DingTalkConfig struct {
 	Timeout  Duration        `yaml:"timeout"`
+	Proxy    ProxyConfig     `yaml:"proxy"`
 	Robots   []RobotConfig   `yaml:"robots"`
 	Channels []ChannelConfig `yaml:"channels"`
 	Routes   []RouteConfig   `yaml:"routes"`
+
+	// MentionFormat is the default mention block format, see ChannelConfig.MentionFormat.
+	MentionFormat string `yaml:"mention_format"`
+	// MaxMentions caps the @ user ids and mobiles per message; 0 disables the cap.
+	MaxMentions int `yaml:"max_mentions"`
+	// AtAllOnCount forces @all when a notification carries more than this
+	// many firing alerts, whatever the channel mentions; 0 disables.
+	AtAllOnCount int `yaml:"at_all_on_count"`
+	// SharedRobotMention decides what happens when several channels matched
+	// by one alert share a robot: "separate" (default) sends each channel's
+	// message, "merge" sends channels rendering the same message once with
+	// the mentions of all of them; different messages are still sent apart.
+	SharedRobotMention string `yaml:"shared_robot_mention"`
+	// EmptyChannel decides what happens to a matched channel that has no
+	// robot to send to when the alert arrives: "skip" (default) reports it
+	// as skipped and counts it, "error" reports it as a failed send.
+	// Channels loaded from the config always list robots; this covers
+	// robots selected at send time.
+	EmptyChannel string `yaml:"empty_channel"`
+
+	QuietHours QuietHoursConfig `yaml:"quiet_hours"`
+	Priority   PriorityConfig   `yaml:"priority"`
+
+	// DedupWindow suppresses a notification identical to one sent less than
+	// this long ago (same receiver, status and common labels); 0 disables it.
+	DedupWindow Duration `yaml:"dedup_window"`
+
+	// StartupDNSCheck resolves every robot webhook host in the background at
+	// startup and logs the ones that fail, to catch typo'd hostnames early.
+	StartupDNSCheck bool `yaml:"startup_dns_check"`
+
+	// MaxConcurrency bounds the robot sends of one alert that run in parallel.
+	MaxConcurrency int `yaml:"max_concurrency"`
+	// RetryBudget caps the robot resends of one alert across all channels:
+	// atomic_retry resends and the keyword and fallback-secret resends of
+	// the client, so many failing robots cannot multiply retries into a
+	// storm; once spent, sends that would retry fail fast. 0 disables it.
+	RetryBudget int `yaml:"retry_budget"`
+	// MaxMessageBytes caps the rendered message body; longer bodies drop
+	// their last alerts, or are cut on a line boundary, to fit. DingTalk
+	// rejects bodies over about 20000 bytes.
+	MaxMessageBytes int `yaml:"max_message_bytes"`
+	// WarnMessageBytes logs a warning for rendered bodies longer than this,
+	// so templates can be tuned before messages get truncated; 0 disables.
+	WarnMessageBytes int `yaml:"warn_message_bytes"`
+	// DryRun runs routing, rendering and mentions as usual but logs the
+	// messages instead of posting them to DingTalk.
+	DryRun bool `yaml:"dry_run"`
+}
+
+// QuietHoursConfig mutes notifications below MinSeverity during the given
+// daily windows. Critical alerts are never muted.
+type QuietHoursConfig struct {
+	// Ranges are "HH:MM-HH:MM" windows, start inclusive and end exclusive; a
+	// window whose end is before its start spans midnight.
+	Ranges   []string `yaml:"ranges"`
+	Timezone string   `yaml:"timezone"`
+	// MinSeverity is the lowest severity still notified during quiet hours.
+	MinSeverity string `yaml:"min_severity"`
+}
+
+// PriorityConfig marks alerts as important by a label value. Firing
+// important alerts escalate the mention to @all and are listed first.
+type PriorityConfig struct {
+	// Label is the alert label holding the priority, "priority" by default.
+	Label string `yaml:"label"`
+	// Important lists the label values treated as important; empty disables it.
+	Important []string `yaml:"important"`
+}
+
+// ParseClockRange parses a "HH:MM-HH:MM" quiet hours window into minutes
+// since midnight.
+func ParseClockRange(s string) (start, end int, err error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid range %q, want HH:MM-HH:MM", s)
+	}
+	if start, err = parseClock(from); err != nil {
+		return 0, 0, fmt.Errorf("invalid range %q: %w", s, err)
+	}
+	if end, err = parseClock(to); err != nil {
+		return 0, 0, fmt.Errorf("invalid range %q: %w", s, err)
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("invalid range %q: start equals end", s)
+	}
+	return start, end, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", strings.TrimSpace(s))
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// SeverityRank orders well-known severity values; anything else ranks 0.
+var SeverityRank = map[string]int{
+	"critical": 5,
+	"error":    4,
+	"warning":  3,
+	"info":     2,
+}
+
+// ProxyConfig routes DingTalk requests through a forward proxy. An empty URL
+// falls back to HTTP_PROXY/HTTPS_PROXY/NO_PROXY.
+type ProxyConfig struct {
+	URL                string `yaml:"url"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
 }
 
 type RobotConfig struct {
 	Name    string `yaml:"name"`
 	Webhook string `yaml:"webhook"`
-	Secret  string `yaml:"secret"`
-	MsgType string `yaml:"msg_type"`
-	Title   string `yaml:"title"`
+	// Secret is a single secret or, while rotating it, a list whose first
+	// entry signs messages and whose others are tried on a sign mismatch.
+	Secret  SecretList `yaml:"secret"`
+	MsgType string     `yaml:"msg_type"`
+	Title   string     `yaml:"title"`
+
+	// WebhookFile and SecretFile are read into Webhook and Secret at load
+	// time, e.g. from a mounted Kubernetes secret. Each excludes its inline
+	// counterpart.
+	WebhookFile string `yaml:"webhook_file"`
+	SecretFile  string `yaml:"secret_file"`
+
+	// Timeout overrides dingtalk.timeout for this robot's sends; 0 keeps it.
+	Timeout Duration `yaml:"timeout"`
+
+	// DedupWindow overrides dingtalk.dedup_window for this robot; 0 turns
+	// deduplication off for it, nil keeps the global window.
+	DedupWindow *Duration `yaml:"dedup_window"`
+
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	// WebhookParams are extra query parameters appended to the webhook URL,
+	// e.g. a route key required by a gateway in front of DingTalk.
+	WebhookParams map[string]string `yaml:"webhook_params"`
+
+	// Keyword is the robot's "custom keyword" security setting. With
+	// KeywordAutoAppend, a send DingTalk rejects for a missing keyword is
+	// retried once with the keyword appended.
+	Keyword           string `yaml:"keyword"`
+	KeywordAutoAppend bool   `yaml:"keyword_auto_append"`
+
+	// Sign adds the timestamp/sign parameters when Secret is set. Nil means
+	// true; set it to false when a gateway in front of DingTalk signs instead.
+	Sign *bool `yaml:"sign"`
+}
+
+// SignEnabled reports whether sends to the robot are signed with its secret.
+func (r RobotConfig) SignEnabled() bool {
+	return r.Sign == nil || *r.Sign
+}
+
+// RateLimitConfig bounds sends per robot webhook or per channel. DingTalk
+// allows 20 messages per minute per robot.
+type RateLimitConfig struct {
+	PerMinute int    `yaml:"per_minute"`
+	Mode      string `yaml:"mode"`
 }
 
 type WhenConfig struct {
 	Receiver []string            `yaml:"receiver"`
 	Status   []string            `yaml:"status"`
 	Labels   map[string][]string `yaml:"labels"`
+	// LabelsRegex matches label values against regular expressions, anchored
+	// at both ends like Prometheus matchers. A label listed in both Labels and
+	// LabelsRegex has to satisfy both.
+	LabelsRegex map[string][]string `yaml:"labels_regex"`
+	// LabelsNot excludes alerts whose label value is one of the listed values;
+	// an absent label does not exclude. All conditions are ANDed, so a key in
+	// both Labels and LabelsNot matches values allowed by Labels minus the
+	// excluded ones.
+	LabelsNot map[string][]string `yaml:"labels_not"`
+	// FiringOnly matches only notifications that still have a firing alert,
+	// so a rule on severity=critical stays quiet when the critical alert
+	// resolves: resolved alerts keep their labels.
+	FiringOnly bool `yaml:"firing_only"`
+	// Expr is a boolean expression over status, receiver, labels and
+	// annotations, see package expr, for conditions the fields above cannot
+	// express. It is ANDed with them.
+	Expr string `yaml:"expr"`
+}
+
+// CompileLabelRegex compiles a labels_regex pattern anchored at both ends.
+func CompileLabelRegex(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+func validateWhen(path string, w WhenConfig) error {
+	if w.FiringOnly && len(w.Status) > 0 {
+		firing := false
+		for _, s := range w.Status {
+			if strings.EqualFold(strings.TrimSpace(s), "firing") {
+				firing = true
+			}
+		}
+		if !firing {
+			return FieldErrorf(path+".firing_only", "can never match with status %v", w.Status)
+		}
+	}
+	for label, values := range w.LabelsNot {
+		if strings.TrimSpace(label) == "" {
+			return FieldErrorf(path+".labels_not", "has empty label name")
+		}
+		if len(values) == 0 {
+			return FieldErrorf(path+".labels_not["+label+"]", "must list at least one value")
+		}
+	}
+	for label, patterns := range w.LabelsRegex {
+		if strings.TrimSpace(label) == "" {
+			return FieldErrorf(path+".labels_regex", "has empty label name")
+		}
+		for _, p := range patterns {
+			if _, err := CompileLabelRegex(strings.TrimSpace(p)); err != nil {
+				return FieldErrorf(path+".labels_regex["+label+"]", "has invalid regex %q: %w", p, err)
+			}
+		}
+	}
+	if strings.TrimSpace(w.Expr) != "" {
+		if _, err := expr.Compile(w.Expr); err != nil {
+			return FieldErrorf(path+".expr", "is invalid: %w", err)
+		}
+	}
+	return nil
 }
 
 type MentionConfig struct {
@@ -91,51 +501,208 @@ type MentionRuleConfig struct {
 	Name    string        `yaml:"name"`
 	When    WhenConfig    `yaml:"when"`
 	Mention MentionConfig `yaml:"mention"`
+	// From adds the user ids and mobiles carried in alert labels or
+	// annotations, e.g. the on-call engineer in an "oncall_userid" label.
+	From MentionFromConfig `yaml:"from"`
+}
+
+// MentionFromConfig names the labels and annotations whose values are
+// mentioned. A value may hold several comma-separated targets; values that
+// do not look like a user id or mobile number are skipped.
+type MentionFromConfig struct {
+	UserIdLabel      string `yaml:"user_id_label"`
+	UserIdAnnotation string `yaml:"user_id_annotation"`
+	MobileLabel      string `yaml:"mobile_label"`
+	MobileAnnotation string `yaml:"mobile_annotation"`
 }
 
 type ChannelConfig struct {
-	Name         string              `yaml:"name"`
-	Robots       []string            `yaml:"robots"`
-	Template     string              `yaml:"template"`
+	Name     string   `yaml:"name"`
+	Robots   []string `yaml:"robots"`
+	Template string   `yaml:"template"`
+	// MsgType overrides the msg_type of every robot of the channel when set.
+	MsgType      string              `yaml:"msg_type"`
 	Mention      MentionConfig       `yaml:"mention"`
 	MentionRules []MentionRuleConfig `yaml:"mention_rules"`
+	// MentionFormat formats the appended @ block, e.g. "cc: {mentions}".
+	MentionFormat string `yaml:"mention_format"`
+
+	// SeverityMentions maps a severity label value to the mention applied when
+	// it is the highest severity among firing alerts.
+	SeverityMentions map[string]MentionConfig `yaml:"severity_mentions"`
+
+	// RateLimit bounds notifications per channel, independent of the limits
+	// of the robots it sends through.
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+
+	// SendResolved sends notifications whose alerts are all resolved. Nil
+	// means true; see SendResolvedEnabled.
+	SendResolved *bool `yaml:"send_resolved"`
+
+	// AtomicRetry resends to every robot of the channel when any of them
+	// fails, so robots that already succeeded get the message again.
+	AtomicRetry AtomicRetryConfig `yaml:"atomic_retry"`
+
+	// GroupBy lists the labels used to split alerts into .Groups for the
+	// template, e.g. ["cluster"] to render one section per cluster.
+	GroupBy []string `yaml:"group_by"`
+
+	// Data is passed to templates as .ChannelData when rendering for this
+	// channel, e.g. {team: "payments"}, so one template can serve channels
+	// that differ only in such context.
+	Data map[string]string `yaml:"data"`
+}
+
+// SendResolvedEnabled reports whether the channel is notified of fully
+// resolved groups, which is the default.
+func (c ChannelConfig) SendResolvedEnabled() bool {
+	return c.SendResolved == nil || *c.SendResolved
+}
+
+// AtomicRetryConfig retries a channel send as a unit.
+type AtomicRetryConfig struct {
+	// Attempts is the number of retries after the first send; 0 disables.
+	Attempts int `yaml:"attempts"`
+	// Backoff is the pause before each retry, 1s by default.
+	Backoff Duration `yaml:"backoff"`
 }
 
 type RouteConfig struct {
 	Name     string     `yaml:"name"`
 	When     WhenConfig `yaml:"when"`
 	Channels []string   `yaml:"channels"`
+	// Continue keeps evaluating later routes after this one matches, like
+	// Alertmanager's continue; the alert goes to the union of their channels.
+	Continue bool `yaml:"continue"`
 }
 
+// Load reads the config file at path. When path is a directory, every
+// "*.yaml" and "*.yml" file in it is merged in lexical order, as for
+// includes.
 func Load(path string) (*Config, error) {
 	cfgPath := strings.TrimSpace(path)
 	if cfgPath == "" {
 		return nil, errors.New("config path is empty")
 	}
+	if st, err := os.Stat(cfgPath); err == nil && st.IsDir() {
+		return loadDir(cfgPath)
+	}
 	data, err := os.ReadFile(cfgPath)
 	if err != nil {
 		return nil, fmt.Errorf("read config: %w", err)
 	}
-	return Parse(data, filepath.Dir(cfgPath))
+	return parse(data, filepath.Dir(cfgPath), cfgPath)
 }
 
+// Parse decodes data and merges the files in its includes list before
+// applying defaults and validating. Later files override the scalars and
+// map entries they set, while robots, channels and routes are appended; a
+// robot or channel name defined in two files is an error.
 func Parse(data []byte, baseDir string) (*Config, error) {
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("parse yaml: %w", err)
+	return parse(data, baseDir, "the main config")
+}
+
+func parse(data []byte, baseDir, name string) (*Config, error) {
+	m := newMerger()
+	if err := m.add(data, name, false); err != nil {
+		return nil, err
+	}
+	if err := m.addIncludes(baseDir); err != nil {
+		return nil, err
 	}
+	return finish(&m.cfg, baseDir)
+}
 
-	applyDefaults(&cfg)
+// finish applies defaults, reads secret files, validates and resolves
+// relative paths against baseDir.
+func finish(cfg *Config, baseDir string) (*Config, error) {
+	applyDefaults(cfg)
 
-	if err := validate(&cfg); err != nil {
+	if err := loadSecretFiles(cfg, baseDir); err != nil {
+		return nil, err
+	}
+
+	if err := validate(cfg); err != nil {
 		return nil, err
 	}
 
 	if strings.TrimSpace(cfg.Template.Dir) != "" && !filepath.IsAbs(cfg.Template.Dir) {
 		cfg.Template.Dir = filepath.Join(baseDir, cfg.Template.Dir)
 	}
+	for _, p := range []*string{&cfg.Server.TLSCertFile, &cfg.Server.TLSKeyFile, &cfg.Server.ClientCAFile, &cfg.Admin.Audit.File, &cfg.Admin.SamplesDir} {
+		if strings.TrimSpace(*p) != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(baseDir, *p)
+		}
+	}
 
-	return &cfg, nil
+	return cfg, nil
+}
+
+// loadSecretFiles resolves the *_file settings against baseDir and reads
+// their trimmed contents into the corresponding inline fields.
+func loadSecretFiles(cfg *Config, baseDir string) error {
+	if err := readSecretFile(&cfg.Auth.Token, &cfg.Auth.TokenFile, baseDir, "auth.token"); err != nil {
+		return err
+	}
+	if err := readSecretFile(&cfg.Auth.HMACSecret, &cfg.Auth.HMACSecretFile, baseDir, "auth.hmac_secret"); err != nil {
+		return err
+	}
+	for i := range cfg.DingTalk.Robots {
+		robot := &cfg.DingTalk.Robots[i]
+		path := fmt.Sprintf("dingtalk.robots[%s]", strings.TrimSpace(robot.Name))
+		if err := readSecretFile(&robot.Webhook, &robot.WebhookFile, baseDir, path+".webhook"); err != nil {
+			return err
+		}
+		// A secret file holds one secret per line, the first signing.
+		if len(robot.Secret) > 0 && strings.TrimSpace(robot.SecretFile) != "" {
+			return FieldErrorf(path+".secret", "and %s.secret_file are mutually exclusive", path)
+		}
+		var secret string
+		if err := readSecretFile(&secret, &robot.SecretFile, baseDir, path+".secret"); err != nil {
+			return err
+		}
+		if robot.SecretFile != "" {
+			robot.Secret = strings.Fields(secret)
+		}
+	}
+	return nil
+}
+
+func readSecretFile(value, file *string, baseDir, key string) error {
+	*file = strings.TrimSpace(*file)
+	if *file == "" {
+		return nil
+	}
+	if strings.TrimSpace(*value) != "" {
+		return FieldErrorf(key, "and %s_file are mutually exclusive", key)
+	}
+	if !filepath.IsAbs(*file) {
+		*file = filepath.Join(baseDir, *file)
+	}
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return FieldErrorf(key+"_file", "cannot be read: %w", err)
+	}
+	*value = strings.TrimSpace(string(data))
+	return nil
+}
+
+// SecretFiles returns the *_file paths in use, so reloads can watch them.
+func (c *Config) SecretFiles() []string {
+	var out []string
+	for _, p := range []string{c.Auth.TokenFile, c.Auth.HMACSecretFile} {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	for _, robot := range c.DingTalk.Robots {
+		for _, p := range []string{robot.WebhookFile, robot.SecretFile} {
+			if p != "" {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
 }
 
 func applyDefaults(cfg *Config) {
@@ -145,6 +712,15 @@ func applyDefaults(cfg *Config) {
 	if cfg.Server.Path == "" {
 		cfg.Server.Path = "/alert"
 	}
+	if cfg.Server.AlertResponseMode == "" {
+		cfg.Server.AlertResponseMode = "strict"
+	}
+	if cfg.Forward.Timeout == 0 {
+		cfg.Forward.Timeout = Duration(5 * time.Second)
+	}
+	if cfg.Forward.MaxPending == 0 {
+		cfg.Forward.MaxPending = 100
+	}
 	if cfg.Server.ReadTimeout == 0 {
 		cfg.Server.ReadTimeout = Duration(5 * time.Second)
 	}
@@ -157,11 +733,23 @@ func applyDefaults(cfg *Config) {
 	if cfg.Server.MaxBodyBytes == 0 {
 		cfg.Server.MaxBodyBytes = 4 << 20
 	}
+	if cfg.Server.ShutdownTimeout == 0 {
+		cfg.Server.ShutdownTimeout = Duration(10 * time.Second)
+	}
+	if cfg.Server.Capture.Enabled && cfg.Server.Capture.MaxEntries == 0 {
+		cfg.Server.Capture.MaxEntries = 20
+	}
 
 	if cfg.Admin.PathPrefix == "" {
 		cfg.Admin.PathPrefix = "/admin"
 	}
+	if cfg.Admin.RecentSends == 0 {
+		cfg.Admin.RecentSends = 100
+	}
 
+	if cfg.Reload.Mode == "" {
+		cfg.Reload.Mode = "poll"
+	}
 	if cfg.Reload.Interval == 0 {
 		cfg.Reload.Interval = Duration(2 * time.Second)
 	}
@@ -169,12 +757,72 @@ func applyDefaults(cfg *Config) {
 	if cfg.DingTalk.Timeout == 0 {
 		cfg.DingTalk.Timeout = Duration(5 * time.Second)
 	}
+	if strings.TrimSpace(cfg.DingTalk.Priority.Label) == "" {
+		cfg.DingTalk.Priority.Label = "priority"
+	}
+	if cfg.DingTalk.MaxConcurrency == 0 {
+		cfg.DingTalk.MaxConcurrency = 4
+	}
+	if cfg.DingTalk.SharedRobotMention == "" {
+		cfg.DingTalk.SharedRobotMention = "separate"
+	}
+	if cfg.Template.OnNameConflict == "" {
+		cfg.Template.OnNameConflict = "error"
+	}
+	if cfg.DingTalk.EmptyChannel == "" {
+		cfg.DingTalk.EmptyChannel = "skip"
+	}
+	if cfg.DingTalk.MaxMessageBytes == 0 {
+		cfg.DingTalk.MaxMessageBytes = 20000
+	}
 
 	for i := range cfg.DingTalk.Robots {
 		if cfg.DingTalk.Robots[i].MsgType == "" {
 			cfg.DingTalk.Robots[i].MsgType = "markdown"
 		}
+		if cfg.DingTalk.Robots[i].RateLimit.PerMinute > 0 && cfg.DingTalk.Robots[i].RateLimit.Mode == "" {
+			cfg.DingTalk.Robots[i].RateLimit.Mode = "drop"
+		}
 	}
+	if len(cfg.DingTalk.QuietHours.Ranges) > 0 && cfg.DingTalk.QuietHours.MinSeverity == "" {
+		cfg.DingTalk.QuietHours.MinSeverity = "critical"
+	}
+
+	for i := range cfg.DingTalk.Channels {
+		if cfg.DingTalk.Channels[i].RateLimit.PerMinute > 0 && cfg.DingTalk.Channels[i].RateLimit.Mode == "" {
+			cfg.DingTalk.Channels[i].RateLimit.Mode = "drop"
+		}
+		if cfg.DingTalk.Channels[i].AtomicRetry.Attempts > 0 && cfg.DingTalk.Channels[i].AtomicRetry.Backoff == 0 {
+			cfg.DingTalk.Channels[i].AtomicRetry.Backoff = Duration(time.Second)
+		}
+	}
+}
+
+// FieldError is a validation failure of a single config field, so callers
+// such as the admin UI can show it next to the field. Error joins Path and
+// Message into the sentence logged and printed by the CLI.
+type FieldError struct {
+	// Path is the field in YAML notation, e.g. "dingtalk.robots[r1].webhook".
+	Path string `json:"path"`
+	// Message describes the problem, e.g. "must not be empty".
+	Message string `json:"message"`
+
+	err error
+}
+
+func (e *FieldError) Error() string {
+	return e.Path + " " + e.Message
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.err
+}
+
+// FieldErrorf returns a *FieldError for path with a fmt.Errorf formatted
+// message; a %w verb is unwrapped as usual.
+func FieldErrorf(path, format string, args ...any) error {
+	err := fmt.Errorf(format, args...)
+	return &FieldError{Path: path, Message: err.Error(), err: errors.Unwrap(err)}
 }
 
 func validate(cfg *Config) error {
@@ -182,101 +830,369 @@ func validate(cfg *Config) error {
 		cfg.Server.Path = "/" + cfg.Server.Path
 	}
 
+	if _, err := ParsePrefixes(cfg.Server.AllowedCIDRs); err != nil {
+		return FieldErrorf("server.allowed_cidrs", "is invalid: %w", err)
+	}
+	if _, err := ParsePrefixes(cfg.Server.TrustedProxies); err != nil {
+		return FieldErrorf("server.trusted_proxies", "is invalid: %w", err)
+	}
+
+	certSet := strings.TrimSpace(cfg.Server.TLSCertFile) != ""
+	keySet := strings.TrimSpace(cfg.Server.TLSKeyFile) != ""
+	if certSet != keySet {
+		return FieldErrorf("server.tls_cert_file", "and server.tls_key_file must be set together")
+	}
+	if strings.TrimSpace(cfg.Server.ClientCAFile) != "" && !certSet {
+		return FieldErrorf("server.client_ca_file", "requires server.tls_cert_file and server.tls_key_file")
+	}
+	minVersion, err := ParseTLSVersion(cfg.Server.TLSMinVersion)
+	if err != nil {
+		return FieldErrorf("server.tls_min_version", "is invalid: %w", err)
+	}
+	if _, err := ParseCipherSuites(cfg.Server.TLSCipherSuites); err != nil {
+		return FieldErrorf("server.tls_cipher_suites", "is invalid: %w", err)
+	}
+	if len(cfg.Server.TLSCipherSuites) > 0 && minVersion == tls.VersionTLS13 {
+		return FieldErrorf("server.tls_cipher_suites", "has no effect with server.tls_min_version 1.3")
+	}
+
+	if t := strings.TrimSpace(cfg.Server.TelemetryListen); t != "" && t == strings.TrimSpace(cfg.Server.Listen) {
+		return FieldErrorf("server.telemetry_listen", "must differ from server.listen")
+	}
+
+	if cfg.Server.ShutdownTimeout < 0 {
+		return FieldErrorf("server.shutdown_timeout", "must not be negative")
+	}
+	switch cfg.Server.AlertResponseMode {
+	case "strict", "best_effort":
+	default:
+		return FieldErrorf("server.alert_response_mode", "must be strict or best_effort")
+	}
+
+	if cfg.Server.Capture.MaxEntries < 0 || cfg.Server.Capture.MaxEntries > 1000 {
+		return FieldErrorf("server.capture.max_entries", "must be between 0 and 1000")
+	}
+
+	if cfg.Auth.RequireAll && (strings.TrimSpace(cfg.Auth.Token) == "" || strings.TrimSpace(cfg.Auth.HMACSecret) == "") {
+		return FieldErrorf("auth.require_all", "requires both auth.token and auth.hmac_secret")
+	}
+
+	if tz := strings.TrimSpace(cfg.Template.Timezone); tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return FieldErrorf("template.timezone", "is invalid: %w", err)
+		}
+	}
+	switch cfg.Template.OnNameConflict {
+	case "error", "last_wins":
+	default:
+		return FieldErrorf("template.on_name_conflict", "must be error or last_wins")
+	}
+	for name, req := range cfg.Template.Requirements {
+		if !ValidTemplateName(name) {
+			return FieldErrorf("template.requirements", "has invalid template name %q", name)
+		}
+		for _, v := range append(append([]string(nil), req.Labels...), req.Annotations...) {
+			if strings.TrimSpace(v) == "" {
+				return FieldErrorf("template.requirements["+name+"]", "must not contain empty names")
+			}
+		}
+	}
+
+	for _, v := range cfg.Template.LabelFields {
+		if strings.TrimSpace(v) == "" {
+			return FieldErrorf("template.label_fields", "must not contain empty names")
+		}
+	}
+	for _, v := range cfg.Template.AnnotationFields {
+		if strings.TrimSpace(v) == "" {
+			return FieldErrorf("template.annotation_fields", "must not contain empty names")
+		}
+	}
+
+	switch cfg.Reload.Mode {
+	case "poll", "watch":
+	default:
+		return FieldErrorf("reload.mode", "must be poll or watch")
+	}
+
 	if cfg.Admin.PathPrefix != "" && !strings.HasPrefix(cfg.Admin.PathPrefix, "/") {
 		cfg.Admin.PathPrefix = "/" + cfg.Admin.PathPrefix
 	}
 
+	switch cfg.Admin.RedirectStatus {
+	case 0, 301, 302, 307, 308:
+	default:
+		return FieldErrorf("admin.redirect_status", "must be 301, 302, 307 or 308")
+	}
+	if cfg.Admin.RecentSends < 0 {
+		return FieldErrorf("admin.recent_sends", "must not be negative")
+	}
+
 	if cfg.Admin.Enabled {
 		if strings.TrimSpace(cfg.Admin.BasicAuth.Username) == "" {
-			return errors.New("admin.basic_auth.username must not be empty")
+			return FieldErrorf("admin.basic_auth.username", "must not be empty")
 		}
 		if strings.TrimSpace(cfg.Admin.BasicAuth.Password) == "" && strings.TrimSpace(cfg.Admin.BasicAuth.PasswordSHA256) == "" {
-			return errors.New("admin.basic_auth.password or admin.basic_auth.password_sha256 is required")
+			return FieldErrorf("admin.basic_auth.password", "or admin.basic_auth.password_sha256 is required")
 		}
 		if strings.TrimSpace(cfg.Admin.BasicAuth.Password) != "" && strings.TrimSpace(cfg.Admin.BasicAuth.PasswordSHA256) != "" {
-			return errors.New("admin.basic_auth.password and admin.basic_auth.password_sha256 are mutually exclusive")
+			return FieldErrorf("admin.basic_auth.password", "and admin.basic_auth.password_sha256 are mutually exclusive")
 		}
 		if strings.TrimSpace(cfg.Admin.BasicAuth.PasswordSHA256) != "" {
 			sha := strings.TrimSpace(cfg.Admin.BasicAuth.PasswordSHA256)
 			if len(sha) != sha256.Size*2 {
-				return fmt.Errorf("admin.basic_auth.password_sha256 must be %d hex chars", sha256.Size*2)
+				return FieldErrorf("admin.basic_auth.password_sha256", "must be %d hex chars", sha256.Size*2)
 			}
 			if _, err := hex.DecodeString(sha); err != nil {
-				return fmt.Errorf("admin.basic_auth.password_sha256 must be hex: %w", err)
+				return FieldErrorf("admin.basic_auth.password_sha256", "must be hex: %w", err)
 			}
 			if strings.TrimSpace(cfg.Admin.BasicAuth.Salt) == "" {
-				return errors.New("admin.basic_auth.salt is required when password_sha256 is set")
+				return FieldErrorf("admin.basic_auth.salt", "is required when password_sha256 is set")
 			}
 			if _, err := base64.StdEncoding.DecodeString(strings.TrimSpace(cfg.Admin.BasicAuth.Salt)); err != nil {
-				return fmt.Errorf("admin.basic_auth.salt must be base64: %w", err)
+				return FieldErrorf("admin.basic_auth.salt", "must be base64: %w", err)
 			}
 		}
 	}
 
+	if raw := strings.TrimSpace(cfg.DingTalk.Proxy.URL); raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return FieldErrorf("dingtalk.proxy.url", "is invalid: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return FieldErrorf("dingtalk.proxy.url", "scheme must be http, https, socks5 or socks5h")
+		}
+		if u.Host == "" {
+			return FieldErrorf("dingtalk.proxy.url", "must include a host")
+		}
+	}
+
+	if cfg.DingTalk.MaxMentions < 0 {
+		return FieldErrorf("dingtalk.max_mentions", "must not be negative")
+	}
+	if cfg.DingTalk.AtAllOnCount < 0 {
+		return FieldErrorf("dingtalk.at_all_on_count", "must not be negative")
+	}
+
 	if len(cfg.DingTalk.Robots) == 0 {
-		return errors.New("dingtalk.robots must not be empty")
+		return FieldErrorf("dingtalk.robots", "must not be empty")
 	}
 
 	robotNames := make(map[string]RobotConfig, len(cfg.DingTalk.Robots))
 	for _, robot := range cfg.DingTalk.Robots {
 		name := strings.TrimSpace(robot.Name)
 		if name == "" {
-			return errors.New("dingtalk.robots[].name must not be empty")
+			return FieldErrorf("dingtalk.robots[].name", "must not be empty")
 		}
 		if _, exists := robotNames[name]; exists {
-			return fmt.Errorf("dingtalk.robots has duplicate name %q", name)
+			return FieldErrorf("dingtalk.robots", "has duplicate name %q", name)
 		}
 		webhook := strings.TrimSpace(robot.Webhook)
 		if webhook == "" {
-			return fmt.Errorf("dingtalk.robots[%s].webhook must not be empty", name)
+			return FieldErrorf("dingtalk.robots["+name+"].webhook", "must not be empty")
 		}
 		msgType := strings.TrimSpace(robot.MsgType)
-		if msgType != "markdown" && msgType != "text" {
-			return fmt.Errorf("dingtalk.robots[%s].msg_type must be markdown or text", name)
+		if !validMsgType(msgType) {
+			return FieldErrorf("dingtalk.robots["+name+"].msg_type", "must be markdown, text, actionCard or link")
+		}
+		for k := range robot.WebhookParams {
+			switch strings.TrimSpace(k) {
+			case "":
+				return FieldErrorf("dingtalk.robots["+name+"].webhook_params", "has empty key")
+			case "timestamp", "sign":
+				return FieldErrorf("dingtalk.robots["+name+"].webhook_params", "must not set %q", k)
+			}
+		}
+		if robot.RateLimit.PerMinute < 0 {
+			return FieldErrorf("dingtalk.robots["+name+"].rate_limit.per_minute", "must not be negative")
+		}
+		if robot.RateLimit.PerMinute > 0 {
+			mode := strings.TrimSpace(robot.RateLimit.Mode)
+			if mode != "drop" && mode != "wait" {
+				return FieldErrorf("dingtalk.robots["+name+"].rate_limit.mode", "must be drop or wait")
+			}
+		}
+		if robot.KeywordAutoAppend && strings.TrimSpace(robot.Keyword) == "" {
+			return FieldErrorf("dingtalk.robots["+name+"].keyword_auto_append", "requires keyword")
+		}
+		if robot.Timeout < 0 {
+			return FieldErrorf("dingtalk.robots["+name+"].timeout", "must not be negative")
+		}
+		if robot.DedupWindow != nil && *robot.DedupWindow < 0 {
+			return FieldErrorf("dingtalk.robots["+name+"].dedup_window", "must not be negative")
+		}
+		secrets := make(map[string]struct{}, len(robot.Secret))
+		for _, s := range robot.Secret {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				return FieldErrorf("dingtalk.robots["+name+"].secret", "must not contain empty secrets")
+			}
+			if _, dup := secrets[s]; dup {
+				return FieldErrorf("dingtalk.robots["+name+"].secret", "lists the same secret twice")
+			}
+			secrets[s] = struct{}{}
 		}
 		robotNames[name] = robot
 	}
 
+	for _, v := range cfg.DingTalk.Priority.Important {
+		if strings.TrimSpace(v) == "" {
+			return FieldErrorf("dingtalk.priority.important", "must not contain empty values")
+		}
+	}
+	if cfg.DingTalk.DedupWindow < 0 {
+		return FieldErrorf("dingtalk.dedup_window", "must not be negative")
+	}
+	if cfg.DingTalk.MaxConcurrency < 0 {
+		return FieldErrorf("dingtalk.max_concurrency", "must not be negative")
+	}
+	if cfg.DingTalk.RetryBudget < 0 {
+		return FieldErrorf("dingtalk.retry_budget", "must not be negative")
+	}
+	for i, raw := range cfg.Forward.URLs {
+		// The URL is left out of the error: it may carry a token.
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return FieldErrorf(fmt.Sprintf("forward.urls[%d]", i), "must be an absolute http or https URL")
+		}
+	}
+	if raw := strings.TrimSpace(cfg.Server.MirrorURL); raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return FieldErrorf("server.mirror_url", "must be an absolute http or https URL")
+		}
+	}
+	if cfg.Forward.Timeout < 0 {
+		return FieldErrorf("forward.timeout", "must not be negative")
+	}
+	if cfg.Forward.MaxPending < 0 {
+		return FieldErrorf("forward.max_pending", "must not be negative")
+	}
+	switch cfg.DingTalk.SharedRobotMention {
+	case "separate", "merge":
+	default:
+		return FieldErrorf("dingtalk.shared_robot_mention", "must be separate or merge")
+	}
+	switch cfg.DingTalk.EmptyChannel {
+	case "skip", "error":
+	default:
+		return FieldErrorf("dingtalk.empty_channel", "must be skip or error")
+	}
+	if cfg.DingTalk.MaxMessageBytes < 0 {
+		return FieldErrorf("dingtalk.max_message_bytes", "must not be negative")
+	}
+	if cfg.DingTalk.WarnMessageBytes < 0 {
+		return FieldErrorf("dingtalk.warn_message_bytes", "must not be negative")
+	}
+	if w, max := cfg.DingTalk.WarnMessageBytes, cfg.DingTalk.MaxMessageBytes; w > 0 && max > 0 && w >= max {
+		return FieldErrorf("dingtalk.warn_message_bytes", "must be less than dingtalk.max_message_bytes (%d)", max)
+	}
+
+	if qh := cfg.DingTalk.QuietHours; len(qh.Ranges) > 0 {
+		for _, r := range qh.Ranges {
+			if _, _, err := ParseClockRange(r); err != nil {
+				return FieldErrorf("dingtalk.quiet_hours.ranges", "is invalid: %w", err)
+			}
+		}
+		if tz := strings.TrimSpace(qh.Timezone); tz != "" {
+			if _, err := time.LoadLocation(tz); err != nil {
+				return FieldErrorf("dingtalk.quiet_hours.timezone", "is invalid: %w", err)
+			}
+		}
+		if _, ok := SeverityRank[strings.ToLower(strings.TrimSpace(qh.MinSeverity))]; !ok {
+			return FieldErrorf("dingtalk.quiet_hours.min_severity", "must be critical, error, warning or info")
+		}
+	}
+
 	if len(cfg.DingTalk.Channels) == 0 {
-		return errors.New("dingtalk.channels must not be empty (must include name \"default\")")
+		return FieldErrorf("dingtalk.channels", "must not be empty (must include name \"default\")")
 	}
 
 	channelNames := make(map[string]ChannelConfig, len(cfg.DingTalk.Channels))
 	for _, ch := range cfg.DingTalk.Channels {
 		name := strings.TrimSpace(ch.Name)
 		if name == "" {
-			return errors.New("dingtalk.channels[].name must not be empty")
+			return FieldErrorf("dingtalk.channels[].name", "must not be empty")
 		}
 		if _, exists := channelNames[name]; exists {
-			return fmt.Errorf("dingtalk.channels has duplicate name %q", name)
+			return FieldErrorf("dingtalk.channels", "has duplicate name %q", name)
 		}
 		if len(ch.Robots) == 0 {
-			return fmt.Errorf("dingtalk.channels[%s].robots must not be empty", name)
+			return FieldErrorf("dingtalk.channels["+name+"].robots", "must not be empty")
 		}
 		for _, r := range ch.Robots {
 			if _, ok := robotNames[r]; !ok {
-				return fmt.Errorf("dingtalk.channels[%s] references unknown robot %q", name, r)
+				return FieldErrorf("dingtalk.channels["+name+"].robots", "references unknown robot %q", r)
+			}
+		}
+		for _, rule := range ch.MentionRules {
+			if err := validateWhen(fmt.Sprintf("dingtalk.channels[%s].mention_rules[%s].when", name, rule.Name), rule.When); err != nil {
+				return err
+			}
+			for key, v := range map[string]string{
+				"user_id_label":      rule.From.UserIdLabel,
+				"user_id_annotation": rule.From.UserIdAnnotation,
+				"mobile_label":       rule.From.MobileLabel,
+				"mobile_annotation":  rule.From.MobileAnnotation,
+			} {
+				if v != "" && strings.TrimSpace(v) == "" {
+					return FieldErrorf(fmt.Sprintf("dingtalk.channels[%s].mention_rules[%s].from.%s", name, rule.Name, key), "must not be blank")
+				}
+			}
+		}
+		for sev := range ch.SeverityMentions {
+			if strings.TrimSpace(sev) == "" {
+				return FieldErrorf("dingtalk.channels["+name+"].severity_mentions", "has empty severity")
+			}
+		}
+		if ch.RateLimit.PerMinute < 0 {
+			return FieldErrorf("dingtalk.channels["+name+"].rate_limit.per_minute", "must not be negative")
+		}
+		if ch.RateLimit.PerMinute > 0 {
+			mode := strings.TrimSpace(ch.RateLimit.Mode)
+			if mode != "drop" && mode != "wait" {
+				return FieldErrorf("dingtalk.channels["+name+"].rate_limit.mode", "must be drop or wait")
+			}
+		}
+		if msgType := strings.TrimSpace(ch.MsgType); msgType != "" && !validMsgType(msgType) {
+			return FieldErrorf("dingtalk.channels["+name+"].msg_type", "must be markdown, text, actionCard or link")
+		}
+		if ch.AtomicRetry.Attempts < 0 || ch.AtomicRetry.Attempts > 10 {
+			return FieldErrorf("dingtalk.channels["+name+"].atomic_retry.attempts", "must be between 0 and 10")
+		}
+		if ch.AtomicRetry.Backoff < 0 {
+			return FieldErrorf("dingtalk.channels["+name+"].atomic_retry.backoff", "must not be negative")
+		}
+		for _, label := range ch.GroupBy {
+			if strings.TrimSpace(label) == "" {
+				return FieldErrorf("dingtalk.channels["+name+"].group_by", "must not contain empty labels")
 			}
 		}
 		channelNames[name] = ch
 	}
 	if _, ok := channelNames["default"]; !ok {
-		return errors.New("dingtalk.channels.default is required")
+		return FieldErrorf("dingtalk.channels.default", "is required")
 	}
 
 	for _, route := range cfg.DingTalk.Routes {
 		routeName := strings.TrimSpace(route.Name)
 		if routeName == "" {
-			return errors.New("dingtalk.routes[].name must not be empty")
+			return FieldErrorf("dingtalk.routes[].name", "must not be empty")
 		}
 		if len(route.Channels) == 0 {
-			return fmt.Errorf("dingtalk.routes[%s].channels must not be empty", routeName)
+			return FieldErrorf("dingtalk.routes["+routeName+"].channels", "must not be empty")
 		}
 		for _, ch := range route.Channels {
 			if _, ok := channelNames[ch]; !ok {
-				return fmt.Errorf("dingtalk.routes[%s] references unknown channel %q", routeName, ch)
+				return FieldErrorf("dingtalk.routes["+routeName+"].channels", "references unknown channel %q", ch)
 			}
 		}
+		if err := validateWhen(fmt.Sprintf("dingtalk.routes[%s].when", routeName), route.When); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -290,8 +1206,78 @@ func (c DingTalkConfig) RobotsByName() map[string]RobotConfig {
 	return out
 }
 
+// ParseTLSVersion maps "1.2" or "1.3" to its tls version constant; empty
+// means TLS 1.2.
+func ParseTLSVersion(v string) (uint16, error) {
+	switch strings.TrimSpace(v) {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported version %q, must be 1.2 or 1.3", v)
+}
+
+// ParseCipherSuites maps cipher suite names to their ids. Only the secure
+// TLS 1.2 suites of crypto/tls are accepted; nil means Go's defaults.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		for _, v := range s.SupportedVersions {
+			if v == tls.VersionTLS12 {
+				known[s.Name] = s.ID
+			}
+		}
+	}
+	out := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure TLS 1.2 cipher suite %q", name)
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+// ParsePrefixes parses CIDR strings; a bare IP is treated as a single-host prefix.
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", v)
+			}
+			out = append(out, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q", v)
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
 var templateNameRE = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,127}$`)
 
 func ValidTemplateName(name string) bool {
 	return templateNameRE.MatchString(name)
 }
+
+func validMsgType(msgType string) bool {
+	switch msgType {
+	case "markdown", "text", "actionCard", "link":
+		return true
+	}
+	return false
+}
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -44,6 +48,9 @@ func TestLoad_DefaultsAndTemplatePath(t *testing.T) {
 	if cfg.DingTalk.Timeout.Duration() != 5*time.Second {
 		t.Fatalf("DingTalk.Timeout=%s", cfg.DingTalk.Timeout.Duration())
 	}
+	if cfg.Server.ShutdownTimeout.Duration() != 10*time.Second {
+		t.Fatalf("Server.ShutdownTimeout=%s", cfg.Server.ShutdownTimeout.Duration())
+	}
 
 	wantDir := filepath.Join(dir, "templates")
 	if cfg.Template.Dir != wantDir {
@@ -70,3 +77,310 @@ dingtalk:
 		t.Fatalf("expected error")
 	}
 }
+
+func TestParse_TLSCertAndKeyTogether(t *testing.T) {
+	base := `
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`
+	if _, err := Parse([]byte("server:\n  tls_cert_file: \"tls.crt\"\n"+base), "/etc/hook"); err == nil {
+		t.Fatalf("expected error for cert without key")
+	}
+	cfg, err := Parse([]byte("server:\n  tls_cert_file: \"tls.crt\"\n  tls_key_file: \"/abs/tls.key\"\n"+base), "/etc/hook")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if cfg.Server.TLSCertFile != filepath.Join("/etc/hook", "tls.crt") || cfg.Server.TLSKeyFile != "/abs/tls.key" {
+		t.Fatalf("tls paths=%q %q", cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+	}
+}
+
+func TestParse_TLSVersionAndCipherSuites(t *testing.T) {
+	base := `
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`
+	for _, server := range []string{
+		"server:\n  tls_min_version: \"1.1\"\n",
+		"server:\n  tls_cipher_suites: [\"TLS_RSA_WITH_RC4_128_SHA\"]\n",
+		"server:\n  tls_cipher_suites: [\"TLS_AES_128_GCM_SHA256\"]\n",
+		"server:\n  tls_min_version: \"1.3\"\n  tls_cipher_suites: [\"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256\"]\n",
+	} {
+		_, err := Parse([]byte(server+base), "/etc/hook")
+		var fe *FieldError
+		if !errors.As(err, &fe) || !strings.HasPrefix(fe.Path, "server.tls_") {
+			t.Fatalf("%q: err=%v, want server.tls_* field error", server, err)
+		}
+	}
+	cfg, err := Parse([]byte("server:\n  tls_min_version: \"1.2\"\n  tls_cipher_suites: [\"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256\"]\n"+base), "/etc/hook")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if ids, err := ParseCipherSuites(cfg.Server.TLSCipherSuites); err != nil || len(ids) != 1 || ids[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Fatalf("ParseCipherSuites=%v err=%v", ids, err)
+	}
+}
+
+func TestParse_LabelsRegexValidation(t *testing.T) {
+	base := `
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+  routes:
+    - name: "web"
+      channels: ["default"]
+      when:
+        labels_regex:
+          instance: ["%s"]
+`
+	if _, err := Parse([]byte(fmt.Sprintf(base, "web-.*")), "/etc/hook"); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	_, err := Parse([]byte(fmt.Sprintf(base, "web-(")), "/etc/hook")
+	if err == nil || !strings.Contains(err.Error(), "dingtalk.routes[web].when.labels_regex[instance]") {
+		t.Fatalf("err=%v want route and label in message", err)
+	}
+}
+
+func TestParse_QuietHours(t *testing.T) {
+	base := `
+dingtalk:
+  quiet_hours:
+    ranges: ["%s"]
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`
+	cfg, err := Parse([]byte(fmt.Sprintf(base, "22:00-08:00")), "/etc/hook")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if cfg.DingTalk.QuietHours.MinSeverity != "critical" {
+		t.Fatalf("min_severity=%q want critical", cfg.DingTalk.QuietHours.MinSeverity)
+	}
+	for _, bad := range []string{"22:00", "25:00-08:00", "08:00-08:00"} {
+		if _, err := Parse([]byte(fmt.Sprintf(base, bad)), "/etc/hook"); err == nil || !strings.Contains(err.Error(), "dingtalk.quiet_hours.ranges") {
+			t.Fatalf("range %q: err=%v", bad, err)
+		}
+	}
+}
+
+func TestParse_TemplateTimezone(t *testing.T) {
+	base := `
+template:
+  timezone: "%s"
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`
+	if _, err := Parse([]byte(fmt.Sprintf(base, "Asia/Shanghai")), "/etc/hook"); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	_, err := Parse([]byte(fmt.Sprintf(base, "Mars/Olympus")), "/etc/hook")
+	if err == nil || !strings.Contains(err.Error(), "template.timezone") {
+		t.Fatalf("err=%v want template.timezone", err)
+	}
+}
+
+func TestParse_SecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"webhook": "https://oapi.dingtalk.com/robot/send?access_token=abc\n",
+		"secret":  "  SEC123 \n",
+		"token":   "tok\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	cfg, err := Parse([]byte(`
+auth:
+  token_file: "token"
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook_file: "webhook"
+      secret_file: "`+filepath.Join(dir, "secret")+`"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`), dir)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	robot := cfg.DingTalk.Robots[0]
+	if robot.Webhook != "https://oapi.dingtalk.com/robot/send?access_token=abc" || robot.Secret.Primary() != "SEC123" || cfg.Auth.Token != "tok" {
+		t.Fatalf("webhook=%q secret=%q token=%q", robot.Webhook, robot.Secret, cfg.Auth.Token)
+	}
+	if robot.WebhookFile != filepath.Join(dir, "webhook") {
+		t.Fatalf("WebhookFile=%q", robot.WebhookFile)
+	}
+	if got := cfg.SecretFiles(); len(got) != 3 {
+		t.Fatalf("SecretFiles=%v", got)
+	}
+
+	_, err = Parse([]byte(`
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+      webhook_file: "webhook"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`), dir)
+	if err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Fatalf("err=%v want mutually exclusive", err)
+	}
+
+	_, err = Parse([]byte(`
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook_file: "missing"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`), dir)
+	if err == nil || !strings.Contains(err.Error(), "dingtalk.robots[r1].webhook_file") {
+		t.Fatalf("err=%v want webhook_file error", err)
+	}
+}
+
+func TestParse_RobotTimeout(t *testing.T) {
+	base := `
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+      timeout: %s
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`
+	cfg, err := Parse([]byte(fmt.Sprintf(base, "30s")), "/etc/hook")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if cfg.DingTalk.Robots[0].Timeout.Duration() != 30*time.Second {
+		t.Fatalf("timeout=%s", cfg.DingTalk.Robots[0].Timeout.Duration())
+	}
+	_, err = Parse([]byte(fmt.Sprintf(base, "-1s")), "/etc/hook")
+	if err == nil || !strings.Contains(err.Error(), "dingtalk.robots[r1].timeout") {
+		t.Fatalf("err=%v want negative timeout error", err)
+	}
+}
+
+func TestParse_AuthRequireAll(t *testing.T) {
+	base := `
+auth:
+  token: "t"
+  hmac_secret: "%s"
+  require_all: true
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`
+	if _, err := Parse([]byte(fmt.Sprintf(base, "s3cret")), "/etc/hook"); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	_, err := Parse([]byte(fmt.Sprintf(base, "")), "/etc/hook")
+	if err == nil || !strings.Contains(err.Error(), "auth.require_all") {
+		t.Fatalf("err=%v want auth.require_all error", err)
+	}
+}
+
+func TestParse_FieldError(t *testing.T) {
+	_, err := Parse([]byte(`
+dingtalk:
+  robots:
+    - name: "r1"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`), "/etc/hook")
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("err=%v (%T) want *FieldError", err, err)
+	}
+	if fe.Path != "dingtalk.robots[r1].webhook" || fe.Message != "must not be empty" {
+		t.Fatalf("field error=%+v", fe)
+	}
+	if err.Error() != "dingtalk.robots[r1].webhook must not be empty" {
+		t.Fatalf("Error()=%q", err.Error())
+	}
+
+	_, err = Parse([]byte(`
+template:
+  timezone: "Mars/Olympus"
+`), "/etc/hook")
+	if !errors.As(err, &fe) || fe.Path != "template.timezone" || errors.Unwrap(err) == nil {
+		t.Fatalf("err=%v want wrapped template.timezone field error", err)
+	}
+}
+
+func TestParse_SecretList(t *testing.T) {
+	base := `
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+      secret: %s
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`
+	cfg, err := Parse([]byte(fmt.Sprintf(base, `["SECNEW", "SECOLD"]`)), "")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	secret := cfg.DingTalk.Robots[0].Secret
+	if secret.Primary() != "SECNEW" || len(secret.Fallbacks()) != 1 || secret.Fallbacks()[0] != "SECOLD" {
+		t.Fatalf("secret=%q", secret)
+	}
+
+	for _, bad := range []string{`["SEC", ""]`, `["SEC", "SEC"]`} {
+		_, err := Parse([]byte(fmt.Sprintf(base, bad)), "")
+		if err == nil || !strings.Contains(err.Error(), "dingtalk.robots[r1].secret") {
+			t.Fatalf("secret %s: err=%v", bad, err)
+		}
+	}
+}
+
+func TestConfig_ForwardURLsLeavesConfigAlone(t *testing.T) {
+	cfg := &Config{}
+	cfg.Forward.URLs = append(make([]string, 0, 4), "https://a.example.com", "https://a.example.com")
+	cfg.Server.MirrorURL = "https://siem.example.com"
+	if got := cfg.ForwardURLs(); len(got) != 2 || got[1] != "https://siem.example.com" {
+		t.Fatalf("ForwardURLs=%v", got)
+	}
+	if spare := cfg.Forward.URLs[:3]; spare[2] != "" {
+		t.Fatalf("ForwardURLs wrote into forward.urls: %v", spare)
+	}
+}
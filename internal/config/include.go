@@ -0,0 +1,184 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BaseDir returns the directory relative paths in the config at path are
+// resolved against: path itself when it is a config directory, otherwise
+// the directory containing the file.
+func BaseDir(path string) string {
+	if st, err := os.Stat(path); err == nil && st.IsDir() {
+		return path
+	}
+	return filepath.Dir(path)
+}
+
+// IncludedPaths returns the files and directories merged into the config,
+// besides the main file, so reloads can watch them.
+func (c *Config) IncludedPaths() []string {
+	return c.includedPaths
+}
+
+// merger assembles a config from several files. Later files override the
+// scalars and map entries they set; robots, channels and routes are
+// appended. It remembers which file defined each robot and channel so that
+// a name defined in two files is reported with both.
+type merger struct {
+	cfg      Config
+	robots   map[string]string
+	channels map[string]string
+}
+
+func newMerger() *merger {
+	return &merger{robots: make(map[string]string), channels: make(map[string]string)}
+}
+
+// add decodes data, read from the file name, over the config assembled so
+// far. Included files may not include others.
+func (m *merger) add(data []byte, name string, included bool) error {
+	cfg := &m.cfg
+	robots, channels, routes := cfg.DingTalk.Robots, cfg.DingTalk.Channels, cfg.DingTalk.Routes
+	includes := cfg.Includes
+	cfg.DingTalk.Robots, cfg.DingTalk.Channels, cfg.DingTalk.Routes = nil, nil, nil
+	cfg.Includes = nil
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		if !included {
+			return fmt.Errorf("parse yaml: %w", err)
+		}
+		return fmt.Errorf("parse yaml %s: %w", name, err)
+	}
+	if included && len(cfg.Includes) > 0 {
+		return FieldErrorf("includes", "is only allowed in the main config file, found in %s", name)
+	}
+	if !included {
+		includes = cfg.Includes
+	}
+	cfg.Includes = includes
+
+	for _, r := range cfg.DingTalk.Robots {
+		if err := m.claim(m.robots, "dingtalk.robots", r.Name, name); err != nil {
+			return err
+		}
+	}
+	for _, c := range cfg.DingTalk.Channels {
+		if err := m.claim(m.channels, "dingtalk.channels", c.Name, name); err != nil {
+			return err
+		}
+	}
+	cfg.DingTalk.Robots = append(robots, cfg.DingTalk.Robots...)
+	cfg.DingTalk.Channels = append(channels, cfg.DingTalk.Channels...)
+	cfg.DingTalk.Routes = append(routes, cfg.DingTalk.Routes...)
+	return nil
+}
+
+// claim records that file defines the named entry. Duplicates within one
+// file are left to validate, which reports them without file names.
+func (m *merger) claim(seen map[string]string, section, entry, file string) error {
+	entry = strings.TrimSpace(entry)
+	if entry == "" {
+		return nil
+	}
+	if prev, ok := seen[entry]; ok && prev != file {
+		return FieldErrorf(section+"["+entry+"]", "is defined in both %s and %s", prev, file)
+	}
+	seen[entry] = file
+	return nil
+}
+
+// addIncludes merges the files named by the includes list, resolved
+// against baseDir. An entry may be a file, a directory, whose "*.yaml" and
+// "*.yml" files are merged in lexical order, or a glob pattern.
+func (m *merger) addIncludes(baseDir string) error {
+	for _, entry := range m.cfg.Includes {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			return FieldErrorf("includes", "must not contain empty paths")
+		}
+		if !filepath.IsAbs(entry) {
+			entry = filepath.Join(baseDir, entry)
+		}
+
+		var files []string
+		st, err := os.Stat(entry)
+		switch {
+		case err == nil && st.IsDir():
+			if files, err = yamlFiles(entry); err != nil {
+				return FieldErrorf("includes", "cannot be read: %w", err)
+			}
+			m.cfg.includedPaths = append(m.cfg.includedPaths, entry)
+		case err == nil:
+			files = []string{entry}
+		case errors.Is(err, os.ErrNotExist) && strings.ContainsAny(entry, "*?["):
+			if files, err = filepath.Glob(entry); err != nil {
+				return FieldErrorf("includes", "has invalid pattern %q: %w", entry, err)
+			}
+			sort.Strings(files)
+		default:
+			return FieldErrorf("includes", "cannot be read: %w", err)
+		}
+
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return FieldErrorf("includes", "cannot be read: %w", err)
+			}
+			if err := m.add(data, file, true); err != nil {
+				return err
+			}
+			m.cfg.includedPaths = append(m.cfg.includedPaths, file)
+		}
+	}
+	return nil
+}
+
+// loadDir assembles the config from every "*.yaml" and "*.yml" file in dir,
+// in lexical order, as if the first file included the others.
+func loadDir(dir string) (*Config, error) {
+	files, err := yamlFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read config dir: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("read config dir: no *.yaml files in %s", dir)
+	}
+	m := newMerger()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+		if err := m.add(data, file, true); err != nil {
+			return nil, err
+		}
+		m.cfg.includedPaths = append(m.cfg.includedPaths, file)
+	}
+	return finish(&m.cfg, dir)
+}
+
+func yamlFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		switch filepath.Ext(e.Name()) {
+		case ".yaml", ".yml":
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
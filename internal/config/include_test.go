@@ -0,0 +1,147 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, body := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+}
+
+func TestLoad_Includes(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"config.yaml": `
+includes: ["robots.yaml", "conf.d"]
+server:
+  listen: "127.0.0.1:9000"
+  path: "/hook"
+dingtalk:
+  robots:
+    - name: "main"
+      webhook: "http://example.invalid/main"
+  channels:
+    - name: "default"
+      robots: ["main"]
+`,
+		"robots.yaml": `
+dingtalk:
+  robots:
+    - name: "ops"
+      webhook: "http://example.invalid/ops"
+`,
+		"conf.d/10-channels.yaml": `
+dingtalk:
+  channels:
+    - name: "ops"
+      robots: ["ops"]
+`,
+		"conf.d/20-server.yml": `
+server:
+  listen: "127.0.0.1:9001"
+`,
+		"conf.d/notes.txt": `not yaml`,
+	})
+
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Listen != "127.0.0.1:9001" || cfg.Server.Path != "/hook" {
+		t.Fatalf("server=%+v, want listen overridden and path kept", cfg.Server)
+	}
+	var robots, channels []string
+	for _, r := range cfg.DingTalk.Robots {
+		robots = append(robots, r.Name)
+	}
+	for _, c := range cfg.DingTalk.Channels {
+		channels = append(channels, c.Name)
+	}
+	if strings.Join(robots, ",") != "main,ops" || strings.Join(channels, ",") != "default,ops" {
+		t.Fatalf("robots=%v channels=%v", robots, channels)
+	}
+	want := []string{
+		filepath.Join(dir, "robots.yaml"),
+		filepath.Join(dir, "conf.d"),
+		filepath.Join(dir, "conf.d", "10-channels.yaml"),
+		filepath.Join(dir, "conf.d", "20-server.yml"),
+	}
+	if got := cfg.IncludedPaths(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("IncludedPaths=%v want %v", got, want)
+	}
+}
+
+func TestLoad_Directory(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"b-robots.yaml": `
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+`,
+		"a-main.yaml": `
+server:
+  listen: "127.0.0.1:9000"
+dingtalk:
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`,
+	})
+
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Listen != "127.0.0.1:9000" || len(cfg.DingTalk.Robots) != 1 || len(cfg.DingTalk.Channels) != 1 {
+		t.Fatalf("cfg=%+v", cfg)
+	}
+	if got := BaseDir(dir); got != dir {
+		t.Fatalf("BaseDir=%q want %q", got, dir)
+	}
+}
+
+func TestLoad_IncludeDuplicateNames(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"config.yaml": `
+includes: ["extra.yaml"]
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid/a"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`,
+		"extra.yaml": `
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid/b"
+`,
+	})
+
+	_, err := Load(filepath.Join(dir, "config.yaml"))
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Path != "dingtalk.robots[r1]" {
+		t.Fatalf("err=%v, want field error on dingtalk.robots[r1]", err)
+	}
+	if !strings.Contains(err.Error(), filepath.Join(dir, "config.yaml")) || !strings.Contains(err.Error(), filepath.Join(dir, "extra.yaml")) {
+		t.Fatalf("err=%v, want both file names", err)
+	}
+}
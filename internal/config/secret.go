@@ -0,0 +1,96 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SecretList holds a robot's signing secrets: a single string, or a list
+// during a rotation, in which case messages are signed with the first and
+// the others are tried when DingTalk rejects the signature.
+type SecretList []string
+
+// Primary returns the secret messages are signed with, or "" when none is
+// set.
+func (s SecretList) Primary() string {
+	if len(s) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(s[0])
+}
+
+// Fallbacks returns the secrets tried after a signature mismatch.
+func (s SecretList) Fallbacks() []string {
+	if len(s) < 2 {
+		return nil
+	}
+	out := make([]string, 0, len(s)-1)
+	for _, v := range s[1:] {
+		out = append(out, strings.TrimSpace(v))
+	}
+	return out
+}
+
+// Set reports whether any secret is configured.
+func (s SecretList) Set() bool {
+	return s.Primary() != ""
+}
+
+func (s SecretList) MarshalYAML() (any, error) {
+	if len(s) == 1 {
+		return s[0], nil
+	}
+	return []string(s), nil
+}
+
+func (s *SecretList) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		if value.Value == "" {
+			*s = nil
+			return nil
+		}
+		*s = SecretList{value.Value}
+		return nil
+	case yaml.SequenceNode:
+		var list []string
+		if err := value.Decode(&list); err != nil {
+			return err
+		}
+		*s = list
+		return nil
+	}
+	return fmt.Errorf("secret must be a string or a list of strings")
+}
+
+func (s SecretList) MarshalJSON() ([]byte, error) {
+	if len(s) <= 1 {
+		return json.Marshal(s.Primary())
+	}
+	return json.Marshal([]string(s))
+}
+
+func (s *SecretList) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || string(data) == "null" {
+		*s = nil
+		return nil
+	}
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		if strings.TrimSpace(one) == "" {
+			*s = nil
+		} else {
+			*s = SecretList{one}
+		}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("secret must be a string or a list of strings")
+	}
+	*s = list
+	return nil
+}
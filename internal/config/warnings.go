@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Warnings reports configuration that is valid but probably unintended:
+// robots no channel sends through, and channels other than "default" that
+// no route sends to. They are logged at load and shown by the admin status,
+// and never fail a load.
+func (c *Config) Warnings() []string {
+	var out []string
+
+	used := make(map[string]bool)
+	for _, ch := range c.DingTalk.Channels {
+		for _, r := range ch.Robots {
+			used[strings.TrimSpace(r)] = true
+		}
+	}
+	for _, r := range c.DingTalk.Robots {
+		name := strings.TrimSpace(r.Name)
+		if !used[name] {
+			out = append(out, fmt.Sprintf("dingtalk.robots[%s]: is not used by any channel", name))
+		}
+	}
+
+	routed := make(map[string]bool)
+	for _, route := range c.DingTalk.Routes {
+		for _, ch := range route.Channels {
+			routed[strings.TrimSpace(ch)] = true
+		}
+	}
+	for _, ch := range c.DingTalk.Channels {
+		name := strings.TrimSpace(ch.Name)
+		if name != "default" && !routed[name] {
+			out = append(out, fmt.Sprintf("dingtalk.channels[%s]: is not used by any route", name))
+		}
+	}
+	return out
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfig_Warnings(t *testing.T) {
+	cfg := &Config{DingTalk: DingTalkConfig{
+		Robots: []RobotConfig{{Name: "r1"}, {Name: "r2"}, {Name: "spare"}},
+		Channels: []ChannelConfig{
+			{Name: "default", Robots: []string{"r1"}},
+			{Name: "ops", Robots: []string{"r2"}},
+			{Name: "orphan", Robots: []string{"r2"}},
+		},
+		Routes: []RouteConfig{{Name: "ops", Channels: []string{"ops"}}},
+	}}
+
+	want := []string{
+		"dingtalk.robots[spare]: is not used by any channel",
+		"dingtalk.channels[orphan]: is not used by any route",
+	}
+	if got := cfg.Warnings(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Warnings()=%q want %q", got, want)
+	}
+}
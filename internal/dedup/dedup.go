@@ -0,0 +1,120 @@
+// Package dedup suppresses identical notifications repeated within a time window.
+package dedup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+)
+
+// Cache remembers when each notification key was last sent. It lives for the
+// whole process, so entries survive config reloads.
+type Cache struct {
+	mu   sync.Mutex
+	sent map[string]time.Time
+
+	// now is time.Now; tests replace it.
+	now func() time.Time
+}
+
+func New() *Cache {
+	return &Cache{sent: make(map[string]time.Time), now: time.Now}
+}
+
+// Key fingerprints a notification by receiver, status and common labels,
+// which stay the same when Alertmanager repeats a group every repeat_interval.
+func Key(msg alertmanager.WebhookMessage) string {
+	keys := make([]string, 0, len(msg.CommonLabels))
+	for k := range msg.CommonLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, part := range []string{msg.Receiver, strings.ToLower(strings.TrimSpace(msg.Status))} {
+		_, _ = h.Write([]byte(part))
+		_, _ = h.Write([]byte{0})
+	}
+	for _, k := range keys {
+		_, _ = h.Write([]byte(k))
+		_, _ = h.Write([]byte{'='})
+		_, _ = h.Write([]byte(msg.CommonLabels[k]))
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// RobotKey scopes a notification key to one robot, for robots with their
+// own dedup_window.
+func RobotKey(robot, key string) string {
+	return robot + "\x00" + key
+}
+
+// Recent reports whether key was recorded less than window ago. A window of
+// zero or less disables deduplication.
+func (c *Cache) Recent(key string, window time.Duration) bool {
+	if c == nil || window <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.sent[key]
+	return ok && c.now().Sub(t) < window
+}
+
+// Record marks key as sent now. Callers record only successful sends so
+// Alertmanager retries of a failed notification are not suppressed.
+func (c *Cache) Record(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent[key] = c.now()
+}
+
+// Sweep drops entries recorded at least maxAge ago.
+func (c *Cache) Sweep(maxAge time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for key, t := range c.sent {
+		if now.Sub(t) >= maxAge {
+			delete(c.sent, key)
+		}
+	}
+}
+
+// Len returns the number of remembered keys.
+func (c *Cache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.sent)
+}
+
+// Run sweeps expired entries every interval until ctx is done. window is
+// called on each sweep so a reloaded dedup_window takes effect.
+func (c *Cache) Run(ctx context.Context, interval time.Duration, window func() time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Sweep(window())
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+)
+
+func TestCache_RecentWithinWindow(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	c := New()
+	c.now = func() time.Time { return now }
+
+	msg := alertmanager.WebhookMessage{Receiver: "ops", Status: "firing", CommonLabels: map[string]string{"alertname": "DiskFull", "instance": "a"}}
+	key := Key(msg)
+
+	if c.Recent(key, time.Hour) {
+		t.Fatalf("unseen key reported recent")
+	}
+	c.Record(key)
+	now = now.Add(30 * time.Minute)
+	if !c.Recent(key, time.Hour) {
+		t.Fatalf("key within window not recent")
+	}
+	if c.Recent(key, 0) {
+		t.Fatalf("zero window must disable dedup")
+	}
+
+	resolved := msg
+	resolved.Status = "resolved"
+	if Key(resolved) == key {
+		t.Fatalf("status must be part of the key")
+	}
+
+	now = now.Add(31 * time.Minute)
+	if c.Recent(key, time.Hour) {
+		t.Fatalf("key past window still recent")
+	}
+	c.Sweep(time.Hour)
+	if c.Len() != 0 {
+		t.Fatalf("Len=%d after sweep, want 0", c.Len())
+	}
+}
+
+func TestKey_IgnoresLabelOrder(t *testing.T) {
+	a := alertmanager.WebhookMessage{Status: "firing", CommonLabels: map[string]string{"a": "1", "b": "2"}}
+	b := alertmanager.WebhookMessage{Status: "firing", CommonLabels: map[string]string{"b": "2", "a": "1"}}
+	if Key(a) != Key(b) {
+		t.Fatalf("keys differ for equal labels")
+	}
+	b.CommonLabels["a"] = "12"
+	b.CommonLabels["b"] = ""
+	if Key(a) == Key(b) {
+		t.Fatalf("keys equal for different labels")
+	}
+}
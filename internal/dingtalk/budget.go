@@ -0,0 +1,50 @@
+package dingtalk
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrRetryBudgetExhausted marks a send whose retry was not made because the
+// request's RetryBudget was spent.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// RetryBudget is the number of resends the sends of one request may make
+// together. A nil budget is unlimited. It is safe for concurrent use.
+type RetryBudget struct {
+	left atomic.Int64
+}
+
+// NewRetryBudget returns a budget of n resends, or nil, unlimited, when n
+// is 0 or less.
+func NewRetryBudget(n int) *RetryBudget {
+	if n <= 0 {
+		return nil
+	}
+	b := &RetryBudget{}
+	b.left.Store(int64(n))
+	return b
+}
+
+// Take spends one resend and reports whether one was left.
+func (b *RetryBudget) Take() bool {
+	if b == nil {
+		return true
+	}
+	for {
+		left := b.left.Load()
+		if left <= 0 {
+			return false
+		}
+		if b.left.CompareAndSwap(left, left-1) {
+			return true
+		}
+	}
+}
+
+// exhausted wraps err, the failure a retry would have answered, to say the
+// retry was not made.
+func exhausted(err error) error {
+	return fmt.Errorf("%w (%w)", err, ErrRetryBudgetExhausted)
+}
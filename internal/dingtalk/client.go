@@ -4,9 +4,11 @@ package dingtalk
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
@@ -15,25 +17,108 @@ import (
 
 type Client struct {
 	httpClient *http.Client
+	limiter    *Limiter
+	logger     *slog.Logger
+	dryRun     bool
+	// timeout bounds each webhook request unless the Target sets its own.
+	timeout time.Duration
+}
+
+type ClientOptions struct {
+	Timeout time.Duration
+	// ProxyURL is an http, https or socks5 proxy. When empty the standard
+	// HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables apply.
+	ProxyURL           string
+	InsecureSkipVerify bool
+	Logger             *slog.Logger
+	// DryRun logs each message instead of posting it and reports success.
+	DryRun bool
 }
 
 func NewClient(timeout time.Duration) *Client {
-	if timeout <= 0 {
-		timeout = 5 * time.Second
+	c, _ := NewClientWithOptions(ClientOptions{Timeout: timeout})
+	return c
+}
+
+func NewClientWithOptions(opts ClientOptions) (*Client, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if raw := strings.TrimSpace(opts.ProxyURL); raw != "" {
+		proxyURL, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if opts.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
+
 	return &Client{
 		httpClient: &http.Client{
-			Timeout: timeout,
+			Transport: transport,
 		},
+		limiter: NewLimiter(),
+		logger:  opts.Logger,
+		dryRun:  opts.DryRun,
+		timeout: opts.Timeout,
+	}, nil
+}
+
+// SetRateLimit configures the token bucket applied to sends to webhook.
+func (c *Client) SetRateLimit(webhook string, rl RateLimit) {
+	c.limiter.Set(webhook, rl)
+}
+
+// InheritRateLimits carries the remaining per-webhook budget over from prev,
+// typically the client of the runtime being replaced on reload.
+func (c *Client) InheritRateLimits(prev *Client) {
+	if prev == nil {
+		return
 	}
+	c.limiter.Inherit(prev.limiter)
 }
 
 type Message struct {
-	MsgType  string
-	Title    string
-	Markdown string
-	Text     string
-	At       *At
+	MsgType    string
+	Title      string
+	Markdown   string
+	Text       string
+	ActionCard *ActionCard
+	Link       *Link
+	At         *At
+	// MentionFormat controls the block appended to the content for mentions.
+	// "{mentions}" is replaced by the space separated @ tokens; when the
+	// placeholder is missing the tokens follow the format text. Empty means
+	// the bare tokens.
+	MentionFormat string
+}
+
+// ActionCard is the body of an actionCard message. A single button is sent as
+// singleTitle/singleURL, several buttons as btns.
+type ActionCard struct {
+	Text    string
+	Buttons []ActionCardButton
+}
+
+type ActionCardButton struct {
+	Title     string
+	ActionURL string
+}
+
+// Link is the body of a link message: a compact card that opens MessageURL.
+// DingTalk does not support mentions in link messages.
+type Link struct {
+	Text       string
+	MessageURL string
+	PicURL     string
 }
 
 type At struct {
@@ -42,17 +127,121 @@ type At struct {
 	IsAtAll   bool
 }
 
+// Target is a robot webhook a message is sent to.
+type Target struct {
+	Webhook string
+	Secret  string
+	// FallbackSecrets are tried in order when DingTalk rejects the signature
+	// made with Secret, so a secret can be rotated without losing messages.
+	FallbackSecrets []string
+	// Params are extra query parameters added to the webhook URL. They never
+	// override the timestamp/sign parameters added for signed robots.
+	Params map[string]string
+	// Keyword is the security keyword configured on the robot. With
+	// AppendKeyword set, a send rejected because the content lacks it is
+	// retried once with the keyword appended.
+	Keyword       string
+	AppendKeyword bool
+	// Timeout overrides the client timeout for requests to this webhook.
+	Timeout time.Duration
+	// SkipSign leaves out the timestamp/sign parameters even when Secret is
+	// set, for gateways that sign the request themselves.
+	SkipSign bool
+	// Budget is spent by the keyword and fallback-secret resends; once it
+	// is empty they are not made and the send fails with the error that
+	// called for them. Nil is unlimited.
+	Budget *RetryBudget
+}
+
+// ErrCodeKeywordNotMatched is the errcode DingTalk answers when a robot's
+// security settings reject a message. The same code covers sign and IP
+// whitelist failures, so the errmsg is checked too.
+const ErrCodeKeywordNotMatched = 310000
+
+// APIError is a send rejected by DingTalk, either at the HTTP level or with a
+// non-zero errcode.
+type APIError struct {
+	StatusCode int
+	ErrCode    int
+	ErrMsg     string
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode/100 != 2 {
+		return fmt.Sprintf("dingtalk http %d: %s", e.StatusCode, e.ErrMsg)
+	}
+	return fmt.Sprintf("dingtalk errcode=%d errmsg=%s", e.ErrCode, e.ErrMsg)
+}
+
+// SignMismatch reports whether the message was rejected because its
+// signature did not verify against the robot's secret.
+func (e *APIError) SignMismatch() bool {
+	return e.ErrCode == ErrCodeKeywordNotMatched && strings.Contains(strings.ToLower(e.ErrMsg), "sign")
+}
+
+// KeywordNotMatched reports whether the message was rejected because it did
+// not contain the robot's security keyword.
+func (e *APIError) KeywordNotMatched() bool {
+	return e.ErrCode == ErrCodeKeywordNotMatched && strings.Contains(strings.ToLower(e.ErrMsg), "keyword")
+}
+
 func (c *Client) Send(ctx context.Context, webhook, secret string, msg Message) error {
-	webhookURL, err := url.Parse(webhook)
+	return c.SendTo(ctx, Target{Webhook: webhook, Secret: secret}, msg)
+}
+
+func (c *Client) SendTo(ctx context.Context, target Target, msg Message) error {
+	target, err := c.sendSigned(ctx, target, msg)
+	keyword := strings.TrimSpace(target.Keyword)
+	if err == nil || !target.AppendKeyword || keyword == "" {
+		return err
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.KeywordNotMatched() {
+		return err
+	}
+	if !target.Budget.Take() {
+		return exhausted(err)
+	}
+	c.logger.Warn("dingtalk keyword not matched, retrying with keyword appended", "keyword", keyword)
+	return c.send(ctx, target, appendKeyword(msg, keyword))
+}
+
+// sendSigned sends msg and, when DingTalk rejects the signature, retries once
+// with each fallback secret the budget allows. It returns target with the secret that was used
+// last, so a follow-up send signs the same way.
+func (c *Client) sendSigned(ctx context.Context, target Target, msg Message) (Target, error) {
+	err := c.send(ctx, target, msg)
+	for i, secret := range target.FallbackSecrets {
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.SignMismatch() || target.SkipSign {
+			break
+		}
+		if !target.Budget.Take() {
+			return target, exhausted(err)
+		}
+		c.logger.Warn("dingtalk sign mismatch, retrying with fallback secret", "webhook", RedactWebhook(target.Webhook), "fallback", i+1)
+		target.Secret = secret
+		err = c.send(ctx, target, msg)
+	}
+	return target, err
+}
+
+func (c *Client) send(ctx context.Context, target Target, msg Message) error {
+	webhookURL, err := url.Parse(target.Webhook)
 	if err != nil {
 		return fmt.Errorf("parse webhook url: %w", err)
 	}
-	if secret != "" {
-		ts := time.Now().UnixMilli()
-		sign := Sign(ts, secret)
+	sign := target.Secret != "" && !target.SkipSign
+	if len(target.Params) > 0 || sign {
 		q := webhookURL.Query()
-		q.Set("timestamp", fmt.Sprintf("%d", ts))
-		q.Set("sign", sign)
+		for k, v := range target.Params {
+			q.Set(k, v)
+		}
+		if sign {
+			ts := time.Now().UnixMilli()
+			q.Set("timestamp", fmt.Sprintf("%d", ts))
+			q.Set("sign", Sign(ts, target.Secret))
+		}
 		webhookURL.RawQuery = q.Encode()
 	}
 
@@ -60,6 +249,22 @@ func (c *Client) Send(ctx context.Context, webhook, secret string, msg Message)
 	if err != nil {
 		return err
 	}
+	// A dry run never reaches DingTalk, so it leaves the rate limit budget
+	// to the real sends.
+	if c.dryRun {
+		c.logger.Info("dry run: dingtalk send skipped", "webhook", RedactWebhook(webhookURL.String()), "msgtype", msg.MsgType, "payload", string(payload))
+		return nil
+	}
+	if err := c.limiter.Acquire(ctx, target.Webhook); err != nil {
+		return err
+	}
+
+	timeout := c.timeout
+	if target.Timeout > 0 {
+		timeout = target.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL.String(), bytes.NewReader(payload))
 	if err != nil {
@@ -69,21 +274,69 @@ func (c *Client) Send(ctx context.Context, webhook, secret string, msg Message)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		// The URL carries the access token and signature; keep them out of
+		// error messages, which end up in logs and API responses.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = RedactWebhook(urlErr.URL)
+		}
 		return fmt.Errorf("post dingtalk: %w", err)
 	}
 	defer resp.Body.Close()
 
 	var apiResp apiResponse
 	_ = json.NewDecoder(resp.Body).Decode(&apiResp)
-	if resp.StatusCode/100 != 2 {
-		return fmt.Errorf("dingtalk http %d: %s", resp.StatusCode, apiResp.ErrMsg)
-	}
-	if apiResp.ErrCode != 0 {
-		return fmt.Errorf("dingtalk errcode=%d errmsg=%s", apiResp.ErrCode, apiResp.ErrMsg)
+	if resp.StatusCode/100 != 2 || apiResp.ErrCode != 0 {
+		return &APIError{StatusCode: resp.StatusCode, ErrCode: apiResp.ErrCode, ErrMsg: apiResp.ErrMsg}
 	}
 	return nil
 }
 
+// DryRun reports whether the client only logs messages.
+func (c *Client) DryRun() bool {
+	return c.dryRun
+}
+
+// RedactWebhook hides query parameter values such as access_token and sign.
+func RedactWebhook(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid webhook>"
+	}
+	u.User = nil
+	if u.RawQuery == "" {
+		return u.String()
+	}
+	q := u.Query()
+	for k := range q {
+		q.Set(k, "REDACTED")
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func appendKeyword(msg Message, keyword string) Message {
+	switch msg.MsgType {
+	case "markdown":
+		msg.Markdown = msg.Markdown + "\n\n" + keyword
+	case "text":
+		msg.Text = msg.Text + "\n" + keyword
+	case "actionCard":
+		if msg.ActionCard != nil {
+			card := *msg.ActionCard
+			card.Text = card.Text + "\n\n" + keyword
+			msg.ActionCard = &card
+		}
+	case "link":
+		if msg.Link != nil {
+			link := *msg.Link
+			link.Text = link.Text + "\n" + keyword
+			msg.Link = &link
+		}
+	}
+	return msg
+}
+
 type apiResponse struct {
 	ErrCode int    `json:"errcode"`
 	ErrMsg  string `json:"errmsg"`
@@ -122,11 +375,102 @@ func buildPayload(msg Message) ([]byte, error) {
 		}
 		addAt(payload, msg.At)
 		return json.Marshal(payload)
+	case "actionCard":
+		if msg.ActionCard == nil || msg.ActionCard.Text == "" {
+			return nil, errors.New("actionCard content is empty")
+		}
+		if len(msg.ActionCard.Buttons) == 0 {
+			return nil, errors.New("actionCard requires at least one button")
+		}
+		title := msg.Title
+		if title == "" {
+			title = "Alertmanager"
+		}
+		card := map[string]any{
+			"title": title,
+			"text":  msg.ActionCard.Text,
+		}
+		if len(msg.ActionCard.Buttons) == 1 {
+			card["singleTitle"] = msg.ActionCard.Buttons[0].Title
+			card["singleURL"] = msg.ActionCard.Buttons[0].ActionURL
+		} else {
+			btns := make([]map[string]any, 0, len(msg.ActionCard.Buttons))
+			for _, b := range msg.ActionCard.Buttons {
+				btns = append(btns, map[string]any{
+					"title":     b.Title,
+					"actionURL": b.ActionURL,
+				})
+			}
+			card["btnOrientation"] = "0"
+			card["btns"] = btns
+		}
+		return json.Marshal(map[string]any{
+			"msgtype":    "actionCard",
+			"actionCard": card,
+		})
+	case "link":
+		if msg.Link == nil || msg.Link.Text == "" {
+			return nil, errors.New("link content is empty")
+		}
+		if msg.Link.MessageURL == "" {
+			return nil, errors.New("link requires a message url")
+		}
+		title := msg.Title
+		if title == "" {
+			title = "Alertmanager"
+		}
+		return json.Marshal(map[string]any{
+			"msgtype": "link",
+			"link": map[string]any{
+				"title":      title,
+				"text":       msg.Link.Text,
+				"messageUrl": msg.Link.MessageURL,
+				"picUrl":     msg.Link.PicURL,
+			},
+		})
 	default:
 		return nil, fmt.Errorf("unsupported msg_type %q", msg.MsgType)
 	}
 }
 
+// Content returns the body text of msg for its msg_type, as rendered before
+// keywords and mentions are appended.
+func (m Message) Content() string {
+	switch m.MsgType {
+	case "markdown":
+		return m.Markdown
+	case "text":
+		return m.Text
+	case "actionCard":
+		if m.ActionCard != nil {
+			return m.ActionCard.Text
+		}
+	case "link":
+		if m.Link != nil {
+			return m.Link.Text
+		}
+	}
+	return ""
+}
+
+// ContentWithMentions returns the body text of msg as it is posted, with the
+// mention block appended.
+func (m Message) ContentWithMentions() string {
+	return applyAtMentions(m).Content()
+}
+
+// CardTitle derives a card title from rendered markdown: the first non-empty
+// line with heading markers removed.
+func CardTitle(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#"))
+		if line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
 func applyAtMentions(msg Message) Message {
 	if msg.At == nil {
 		return msg
@@ -152,10 +496,23 @@ func applyAtMentions(msg Message) Message {
 	if len(tokens) == 0 {
 		return msg
 	}
-	*content = *content + sep + strings.Join(tokens, " ")
+	*content = *content + sep + formatMentions(msg.MentionFormat, tokens)
 	return msg
 }
 
+const mentionsPlaceholder = "{mentions}"
+
+func formatMentions(format string, tokens []string) string {
+	joined := strings.Join(tokens, " ")
+	if strings.TrimSpace(format) == "" {
+		return joined
+	}
+	if strings.Contains(format, mentionsPlaceholder) {
+		return strings.ReplaceAll(format, mentionsPlaceholder, joined)
+	}
+	return strings.TrimRight(format, " ") + " " + joined
+}
+
 func mentionTokens(content string, at *At) []string {
 	if at == nil {
 		return nil
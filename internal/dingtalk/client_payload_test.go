@@ -66,3 +66,126 @@ func TestBuildPayload_EmptyAtOmitted(t *testing.T) {
 		t.Fatalf("unexpected at field: %v", payload["at"])
 	}
 }
+
+func TestBuildPayload_ActionCard(t *testing.T) {
+	single, err := buildPayload(Message{
+		MsgType: "actionCard",
+		Title:   "t",
+		ActionCard: &ActionCard{
+			Text:    "body",
+			Buttons: []ActionCardButton{{Title: "Grafana", ActionURL: "https://grafana.example"}},
+		},
+		At: &At{IsAtAll: true},
+	})
+	if err != nil {
+		t.Fatalf("buildPayload(single): %v", err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(single, &payload); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if payload["msgtype"] != "actionCard" {
+		t.Fatalf("msgtype=%v", payload["msgtype"])
+	}
+	if _, ok := payload["at"]; ok {
+		t.Fatalf("unexpected at field: %v", payload["at"])
+	}
+	card := payload["actionCard"].(map[string]any)
+	if card["singleURL"] != "https://grafana.example" || card["singleTitle"] != "Grafana" || card["text"] != "body" {
+		t.Fatalf("card=%v", card)
+	}
+
+	multi, err := buildPayload(Message{
+		MsgType: "actionCard",
+		ActionCard: &ActionCard{
+			Text: "body",
+			Buttons: []ActionCardButton{
+				{Title: "Grafana", ActionURL: "https://grafana.example"},
+				{Title: "Alertmanager", ActionURL: "https://am.example"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("buildPayload(multi): %v", err)
+	}
+	payload = nil
+	if err := json.Unmarshal(multi, &payload); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	card = payload["actionCard"].(map[string]any)
+	btns, ok := card["btns"].([]any)
+	if !ok || len(btns) != 2 {
+		t.Fatalf("btns=%v", card["btns"])
+	}
+	if _, ok := card["singleURL"]; ok {
+		t.Fatalf("unexpected singleURL with multiple buttons")
+	}
+
+	if _, err := buildPayload(Message{MsgType: "actionCard", ActionCard: &ActionCard{Text: "body"}}); err == nil {
+		t.Fatalf("expected error without buttons")
+	}
+}
+
+func TestBuildPayload_MentionFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: "", want: "hello\n@user123 @13800138000"},
+		{format: "cc: {mentions}", want: "hello\ncc: @user123 @13800138000"},
+		{format: "cc:", want: "hello\ncc: @user123 @13800138000"},
+	}
+	for _, tt := range tests {
+		b, err := buildPayload(Message{
+			MsgType:       "text",
+			Text:          "hello",
+			MentionFormat: tt.format,
+			At: &At{
+				AtMobiles: []string{"13800138000"},
+				AtUserIds: []string{"user123"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("buildPayload: %v", err)
+		}
+		var payload map[string]any
+		if err := json.Unmarshal(b, &payload); err != nil {
+			t.Fatalf("json.Unmarshal: %v", err)
+		}
+		text := payload["text"].(map[string]any)["content"]
+		if text != tt.want {
+			t.Fatalf("format=%q content=%q want %q", tt.format, text, tt.want)
+		}
+		at := payload["at"].(map[string]any)
+		if len(at["atUserIds"].([]any)) != 1 || len(at["atMobiles"].([]any)) != 1 {
+			t.Fatalf("at=%v", at)
+		}
+	}
+}
+
+func TestBuildPayload_Link(t *testing.T) {
+	b, err := buildPayload(Message{
+		MsgType: "link",
+		Title:   "Disk full",
+		Link:    &Link{Text: "disk on host-1", MessageURL: "https://prom.example/graph", PicURL: "https://img.example/p.png"},
+		At:      &At{AtUserIds: []string{"oncall"}},
+	})
+	if err != nil {
+		t.Fatalf("buildPayload: %v", err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(b, &payload); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if payload["msgtype"] != "link" || payload["at"] != nil {
+		t.Fatalf("payload=%v", payload)
+	}
+	link := payload["link"].(map[string]any)
+	if link["title"] != "Disk full" || link["text"] != "disk on host-1" || link["messageUrl"] != "https://prom.example/graph" || link["picUrl"] != "https://img.example/p.png" {
+		t.Fatalf("link=%v", link)
+	}
+
+	if _, err := buildPayload(Message{MsgType: "link", Link: &Link{Text: "body"}}); err == nil {
+		t.Fatalf("expected error without message url")
+	}
+}
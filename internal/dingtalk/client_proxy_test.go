@@ -0,0 +1,34 @@
+package dingtalk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient_SendThroughProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(proxy.Close)
+
+	c, err := NewClientWithOptions(ClientOptions{Timeout: 2 * time.Second, ProxyURL: proxy.URL})
+	if err != nil {
+		t.Fatalf("NewClientWithOptions: %v", err)
+	}
+	err = c.Send(context.Background(), "http://oapi.dingtalk.invalid/robot/send?access_token=x", "", Message{MsgType: "text", Text: "hi"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if proxied != "http://oapi.dingtalk.invalid/robot/send?access_token=x" {
+		t.Fatalf("proxied url=%q", proxied)
+	}
+
+	if _, err := NewClientWithOptions(ClientOptions{ProxyURL: "://bad"}); err == nil {
+		t.Fatalf("expected error for invalid proxy url")
+	}
+}
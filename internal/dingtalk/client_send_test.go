@@ -0,0 +1,226 @@
+package dingtalk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_SendTo_WebhookParams(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(2 * time.Second)
+	err := c.SendTo(context.Background(), Target{
+		Webhook: srv.URL + "/robot/send?access_token=abc",
+		Secret:  "s",
+		Params:  map[string]string{"route_key": "ops", "sign": "bogus"},
+	}, Message{MsgType: "text", Text: "hi"})
+	if err != nil {
+		t.Fatalf("SendTo: %v", err)
+	}
+
+	q := got.URL.Query()
+	if q.Get("route_key") != "ops" {
+		t.Fatalf("route_key=%q want %q", q.Get("route_key"), "ops")
+	}
+	if q.Get("access_token") != "abc" {
+		t.Fatalf("access_token=%q want %q", q.Get("access_token"), "abc")
+	}
+	if q.Get("timestamp") == "" || q.Get("sign") == "" || q.Get("sign") == "bogus" {
+		t.Fatalf("timestamp/sign clobbered: %v", q)
+	}
+}
+
+func TestClient_SendTo_KeywordAutoAppend(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if len(bodies) == 1 {
+			_, _ = w.Write([]byte(`{"errcode":310000,"errmsg":"keywords not in content"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(2 * time.Second)
+	target := Target{Webhook: srv.URL, Keyword: "告警", AppendKeyword: true}
+	if err := c.SendTo(context.Background(), target, Message{MsgType: "text", Text: "hi"}); err != nil {
+		t.Fatalf("SendTo: %v", err)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("requests=%d want 2", len(bodies))
+	}
+	if strings.Contains(bodies[0], "告警") || !strings.Contains(bodies[1], `hi\n告警`) {
+		t.Fatalf("bodies=%q", bodies)
+	}
+
+	bodies = nil
+	target.AppendKeyword = false
+	err := c.SendTo(context.Background(), target, Message{MsgType: "text", Text: "hi"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.KeywordNotMatched() {
+		t.Fatalf("err=%v want keyword APIError", err)
+	}
+	if len(bodies) != 1 {
+		t.Fatalf("requests=%d want 1 without auto append", len(bodies))
+	}
+}
+
+func TestClient_DryRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("dry run must not call DingTalk")
+	}))
+	t.Cleanup(srv.Close)
+
+	var buf bytes.Buffer
+	c, err := NewClientWithOptions(ClientOptions{
+		Timeout: 2 * time.Second,
+		Logger:  slog.New(slog.NewTextHandler(&buf, nil)),
+		DryRun:  true,
+	})
+	if err != nil {
+		t.Fatalf("NewClientWithOptions: %v", err)
+	}
+	err = c.SendTo(context.Background(), Target{Webhook: srv.URL + "/robot/send?access_token=abc", Secret: "s"}, Message{MsgType: "text", Text: "disk full"})
+	if err != nil {
+		t.Fatalf("SendTo: %v", err)
+	}
+
+	logged := buf.String()
+	if !strings.Contains(logged, "msgtype=text") || !strings.Contains(logged, "disk full") {
+		t.Fatalf("log=%s", logged)
+	}
+	if strings.Contains(logged, "access_token=abc") || !strings.Contains(logged, "access_token=REDACTED") {
+		t.Fatalf("webhook not redacted: %s", logged)
+	}
+}
+
+func TestClient_DryRunSkipsRateLimit(t *testing.T) {
+	c, err := NewClientWithOptions(ClientOptions{
+		Timeout: 2 * time.Second,
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		DryRun:  true,
+	})
+	if err != nil {
+		t.Fatalf("NewClientWithOptions: %v", err)
+	}
+	webhook := "http://127.0.0.1:1/robot/send?access_token=abc"
+	c.SetRateLimit(webhook, RateLimit{PerMinute: 1})
+
+	for i := 0; i < 3; i++ {
+		if err := c.SendTo(context.Background(), Target{Webhook: webhook}, Message{MsgType: "text", Text: "hi"}); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+	if st := c.limiter.States()[webhook]; st.Tokens < 1 || st.Dropped != 0 {
+		t.Fatalf("dry run used the rate limit: %+v", st)
+	}
+}
+
+func TestClient_SendTo_TransportErrorRedactsWebhook(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	webhook := srv.URL + "/robot/send?access_token=abc"
+	srv.Close()
+
+	err := NewClient(time.Second).SendTo(context.Background(), Target{Webhook: webhook}, Message{MsgType: "text", Text: "hi"})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if strings.Contains(err.Error(), "access_token=abc") {
+		t.Fatalf("error leaks access token: %v", err)
+	}
+}
+
+func TestClient_SendTo_TargetTimeoutOverridesDefault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(50 * time.Millisecond)
+	msg := Message{MsgType: "text", Text: "hi"}
+	if err := c.SendTo(context.Background(), Target{Webhook: srv.URL}, msg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("default timeout: err=%v want deadline exceeded", err)
+	}
+	if err := c.SendTo(context.Background(), Target{Webhook: srv.URL, Timeout: 2 * time.Second}, msg); err != nil {
+		t.Fatalf("robot timeout: %v", err)
+	}
+}
+
+func TestClient_SendTo_SkipSign(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(2 * time.Second)
+	err := c.SendTo(context.Background(), Target{
+		Webhook:  srv.URL + "/robot/send?access_token=abc",
+		Secret:   "s",
+		SkipSign: true,
+	}, Message{MsgType: "text", Text: "hi"})
+	if err != nil {
+		t.Fatalf("SendTo: %v", err)
+	}
+
+	q := got.URL.Query()
+	if q.Has("timestamp") || q.Has("sign") {
+		t.Fatalf("unexpected sign params: %v", q)
+	}
+	if q.Get("access_token") != "abc" {
+		t.Fatalf("access_token=%q want %q", q.Get("access_token"), "abc")
+	}
+}
+
+func TestClient_SendTo_FallbackSecretOnSignMismatch(t *testing.T) {
+	var signs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		signs = append(signs, q.Get("sign"))
+		ts, _ := strconv.ParseInt(q.Get("timestamp"), 10, 64)
+		if q.Get("sign") != Sign(ts, "new") {
+			_, _ = w.Write([]byte(`{"errcode":310000,"errmsg":"sign not match, more: [https://ding-doc.dingtalk.com/doc#/serverapi2/qf2nxq]"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(2 * time.Second)
+	target := Target{Webhook: srv.URL, Secret: "old", FallbackSecrets: []string{"new"}}
+	if err := c.SendTo(context.Background(), target, Message{MsgType: "text", Text: "hi"}); err != nil {
+		t.Fatalf("SendTo: %v", err)
+	}
+	if len(signs) != 2 {
+		t.Fatalf("requests=%d want 2", len(signs))
+	}
+
+	signs = nil
+	target = Target{Webhook: srv.URL, Secret: "old", FallbackSecrets: []string{"older"}}
+	err := c.SendTo(context.Background(), target, Message{MsgType: "text", Text: "hi"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.SignMismatch() {
+		t.Fatalf("err=%v want sign mismatch", err)
+	}
+	if len(signs) != 2 {
+		t.Fatalf("requests=%d want 2", len(signs))
+	}
+}
@@ -0,0 +1,51 @@
+package dingtalk
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sort"
+)
+
+// Resolver is the part of net.Resolver used by CheckWebhookDNS.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DNSFailure is a robot whose webhook host could not be resolved.
+type DNSFailure struct {
+	Robot string
+	Host  string
+	Err   error
+}
+
+// CheckWebhookDNS resolves the host of each webhook, keyed by robot name, and
+// returns the ones that fail, ordered by robot name. It only catches typo'd
+// hostnames early; nothing is sent. Hosts that are IP literals are skipped.
+func CheckWebhookDNS(ctx context.Context, r Resolver, webhooks map[string]string) []DNSFailure {
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	names := make([]string, 0, len(webhooks))
+	for name := range webhooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var failures []DNSFailure
+	for _, name := range names {
+		u, err := url.Parse(webhooks[name])
+		if err != nil {
+			failures = append(failures, DNSFailure{Robot: name, Err: err})
+			continue
+		}
+		host := u.Hostname()
+		if host == "" || net.ParseIP(host) != nil {
+			continue
+		}
+		if _, err := r.LookupHost(ctx, host); err != nil {
+			failures = append(failures, DNSFailure{Robot: name, Host: host, Err: err})
+		}
+	}
+	return failures
+}
@@ -0,0 +1,35 @@
+package dingtalk
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type stubResolver map[string][]string
+
+func (s stubResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	if addrs, ok := s[host]; ok {
+		return addrs, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func TestCheckWebhookDNS(t *testing.T) {
+	r := stubResolver{"oapi.dingtalk.com": {"203.0.113.10"}}
+	failures := CheckWebhookDNS(context.Background(), r, map[string]string{
+		"ok":    "https://oapi.dingtalk.com/robot/send?access_token=abc",
+		"typo":  "https://oapi.dingtak.com/robot/send?access_token=abc",
+		"ip":    "http://127.0.0.1:8080/robot/send",
+		"other": "https://gateway.example.invalid/send",
+	})
+	if len(failures) != 2 {
+		t.Fatalf("failures=%+v want 2", failures)
+	}
+	if failures[0].Robot != "other" || failures[0].Host != "gateway.example.invalid" {
+		t.Fatalf("failures[0]=%+v", failures[0])
+	}
+	if failures[1].Robot != "typo" || failures[1].Host != "oapi.dingtak.com" || failures[1].Err == nil {
+		t.Fatalf("failures[1]=%+v", failures[1])
+	}
+}
@@ -0,0 +1,181 @@
+package dingtalk
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned by Send when a robot's per-minute budget is exhausted in drop mode.
+var ErrRateLimited = errors.New("dingtalk rate limited")
+
+// RateLimit describes a token bucket. PerMinute <= 0 disables limiting.
+type RateLimit struct {
+	PerMinute int
+	Wait      bool
+}
+
+// Limiter holds token buckets by key. The client keys them by webhook; the
+// runtime reuses it keyed by channel name.
+type Limiter struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	limit   RateLimit
+	tokens  float64
+	last    time.Time
+	dropped uint64
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Set configures the bucket for key; PerMinute <= 0 removes it.
+func (l *Limiter) Set(key string, rl RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if rl.PerMinute <= 0 {
+		delete(l.buckets, key)
+		return
+	}
+	if b, ok := l.buckets[key]; ok {
+		b.limit = rl
+		if b.tokens > float64(rl.PerMinute) {
+			b.tokens = float64(rl.PerMinute)
+		}
+		return
+	}
+	l.buckets[key] = &bucket{
+		limit:  rl,
+		tokens: float64(rl.PerMinute),
+		last:   l.now(),
+	}
+}
+
+// Inherit copies bucket levels and drop counts from prev for keys configured
+// on l, so a rebuilt limiter does not hand out a fresh budget on every reload.
+func (l *Limiter) Inherit(prev *Limiter) {
+	if prev == nil || prev == l {
+		return
+	}
+	prev.mu.Lock()
+	defer prev.mu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, b := range l.buckets {
+		old, ok := prev.buckets[key]
+		if !ok {
+			continue
+		}
+		b.tokens = old.tokens
+		if b.tokens > float64(b.limit.PerMinute) {
+			b.tokens = float64(b.limit.PerMinute)
+		}
+		b.last = old.last
+		b.dropped = old.dropped
+	}
+}
+
+// Acquire takes a token for key, waiting for one in wait mode. Keys without a
+// bucket, and a nil Limiter, are not limited.
+func (l *Limiter) Acquire(ctx context.Context, key string) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		wait, err := l.take(key)
+		if err != nil || wait == 0 {
+			return err
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// take consumes a token when one is available. Otherwise it returns how long
+// to wait for the next token, or ErrRateLimited when the bucket drops.
+func (l *Limiter) take(key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return 0, nil
+	}
+
+	now := l.now()
+	perSecond := float64(b.limit.PerMinute) / 60
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * perSecond
+		if b.tokens > float64(b.limit.PerMinute) {
+			b.tokens = float64(b.limit.PerMinute)
+		}
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, nil
+	}
+	if !b.limit.Wait {
+		b.dropped++
+		return 0, ErrRateLimited
+	}
+	wait := time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	if wait <= 0 {
+		wait = time.Millisecond
+	}
+	return wait, nil
+}
+
+// LimitState is a snapshot of one bucket.
+type LimitState struct {
+	PerMinute int     `json:"per_minute"`
+	Wait      bool    `json:"wait"`
+	Tokens    float64 `json:"tokens"`
+	Dropped   uint64  `json:"dropped"`
+}
+
+// States returns a snapshot of every configured bucket, with tokens refilled
+// up to now.
+func (l *Limiter) States() map[string]LimitState {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	out := make(map[string]LimitState, len(l.buckets))
+	for key, b := range l.buckets {
+		tokens := b.tokens
+		if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+			tokens += elapsed * float64(b.limit.PerMinute) / 60
+		}
+		if tokens > float64(b.limit.PerMinute) {
+			tokens = float64(b.limit.PerMinute)
+		}
+		out[key] = LimitState{
+			PerMinute: b.limit.PerMinute,
+			Wait:      b.limit.Wait,
+			Tokens:    tokens,
+			Dropped:   b.dropped,
+		}
+	}
+	return out
+}
@@ -0,0 +1,72 @@
+package dingtalk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiter_DropWhenExhausted(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	l.Set("w", RateLimit{PerMinute: 20})
+
+	for i := 0; i < 20; i++ {
+		if err := l.Acquire(context.Background(), "w"); err != nil {
+			t.Fatalf("acquire #%d: %v", i, err)
+		}
+	}
+	if err := l.Acquire(context.Background(), "w"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("acquire #21 err=%v want ErrRateLimited", err)
+	}
+
+	now = now.Add(3 * time.Second)
+	if err := l.Acquire(context.Background(), "w"); err != nil {
+		t.Fatalf("acquire after refill: %v", err)
+	}
+
+	if err := l.Acquire(context.Background(), "other"); err != nil {
+		t.Fatalf("unlimited key: %v", err)
+	}
+}
+
+func TestLimiter_WaitMode(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	l.Set("w", RateLimit{PerMinute: 1, Wait: true})
+
+	if wait, err := l.take("w"); err != nil || wait != 0 {
+		t.Fatalf("take #1 wait=%s err=%v", wait, err)
+	}
+	wait, err := l.take("w")
+	if err != nil {
+		t.Fatalf("take #2: %v", err)
+	}
+	if wait != time.Minute {
+		t.Fatalf("wait=%s want %s", wait, time.Minute)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Acquire(ctx, "w"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire err=%v want deadline exceeded", err)
+	}
+}
+
+func TestLimiter_InheritKeepsLevel(t *testing.T) {
+	prev := NewLimiter()
+	prev.Set("w", RateLimit{PerMinute: 2})
+	_ = prev.Acquire(context.Background(), "w")
+	_ = prev.Acquire(context.Background(), "w")
+
+	next := NewLimiter()
+	next.Set("w", RateLimit{PerMinute: 2})
+	next.Inherit(prev)
+
+	if err := next.Acquire(context.Background(), "w"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("acquire err=%v want ErrRateLimited", err)
+	}
+}
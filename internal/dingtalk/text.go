@@ -0,0 +1,40 @@
+package dingtalk
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	mdImage    = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	mdLink     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdStrong   = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	mdEmphasis = regexp.MustCompile(`(^|[^\\*])\*(\S(?:[^*]*?\S)?)\*`)
+	mdCode     = regexp.MustCompile("`([^`]*)`")
+	mdHeading  = regexp.MustCompile(`^#{1,6}\s+`)
+	mdQuote    = regexp.MustCompile(`^>\s?`)
+	mdEscape   = regexp.MustCompile("\\\\([\\\\`*_#\\[\\]()<>~|])")
+)
+
+// MarkdownToText strips markdown formatting so content rendered for
+// markdown robots reads cleanly in a text message: headings, emphasis,
+// inline code and quotes lose their markers, links become "text (url)"
+// and backslash escapes are undone. Single underscores are left alone since
+// label names and values commonly contain them.
+func MarkdownToText(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		body := strings.TrimLeft(line, " \t")
+		body = mdHeading.ReplaceAllString(body, "")
+		body = mdQuote.ReplaceAllString(body, "")
+		body = mdImage.ReplaceAllString(body, "$1 ($2)")
+		body = mdLink.ReplaceAllString(body, "$1 ($2)")
+		body = mdCode.ReplaceAllString(body, "$1")
+		body = mdStrong.ReplaceAllString(body, "$2")
+		body = mdEmphasis.ReplaceAllString(body, "$1$2")
+		body = mdEscape.ReplaceAllString(body, "$1")
+		lines[i] = indent + body
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,24 @@
+package dingtalk
+
+import "testing"
+
+func TestMarkdownToText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"### 🔥 告警触发（1）", "🔥 告警触发（1）"},
+		{"- **严重度**: `critical`", "- 严重度: critical"},
+		{"> quoted *note*", "quoted note"},
+		{"see [Grafana](https://grafana.example/d/x)", "see Grafana (https://grafana.example/d/x)"},
+		{`磁盘 \> 90% on host\_1`, "磁盘 > 90% on host_1"},
+		{"job=node_exporter instance=a_b", "job=node_exporter instance=a_b"},
+		{"3 * 4 = 12", "3 * 4 = 12"},
+		{"line one\n\n---\n\n  indented", "line one\n\n---\n\n  indented"},
+	}
+	for _, tt := range tests {
+		if got := MarkdownToText(tt.in); got != tt.want {
+			t.Fatalf("MarkdownToText(%q)=%q want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+// Package expr implements the boolean expressions of when.expr, for route
+// conditions the structured when fields cannot express, e.g.
+//
+//	labels.severity == "critical" || (labels.env =~ "prod-.*" && annotations.team != "sandbox")
+//
+// Operands are string literals, double-quoted or in backquotes, and the
+// fields status, receiver, labels.<name> and annotations.<name>; a missing
+// label or annotation is "". Comparisons are ==, !=, =~ and !~, whose
+// pattern is a literal anchored at both ends like labels_regex, and
+// "in" / "not in" a bracketed list of literals. Comparisons combine with
+// !, && and || and parentheses, with the usual precedence.
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Env is what an expression is evaluated against.
+type Env struct {
+	Status      string
+	Receiver    string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// Expr is a compiled expression.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Compile parses src. Errors carry the byte offset of the offending token.
+func Compile(src string) (*Expr, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("offset %d: unexpected %s", t.pos, t)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// Eval reports whether the expression holds in env.
+func (e *Expr) Eval(env Env) bool {
+	return e.root.eval(env)
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+type node interface {
+	eval(env Env) bool
+}
+
+type (
+	orNode  struct{ left, right node }
+	andNode struct{ left, right node }
+	notNode struct{ inner node }
+	eqNode  struct {
+		left, right operand
+		negate      bool
+	}
+	matchNode struct {
+		left   operand
+		re     *regexp.Regexp
+		negate bool
+	}
+	inNode struct {
+		left   operand
+		values map[string]struct{}
+		negate bool
+	}
+)
+
+func (n orNode) eval(env Env) bool  { return n.left.eval(env) || n.right.eval(env) }
+func (n andNode) eval(env Env) bool { return n.left.eval(env) && n.right.eval(env) }
+func (n notNode) eval(env Env) bool { return !n.inner.eval(env) }
+
+func (n eqNode) eval(env Env) bool {
+	return (n.left.value(env) == n.right.value(env)) != n.negate
+}
+
+func (n matchNode) eval(env Env) bool {
+	return n.re.MatchString(n.left.value(env)) != n.negate
+}
+
+func (n inNode) eval(env Env) bool {
+	_, ok := n.values[n.left.value(env)]
+	return ok != n.negate
+}
+
+// operand is a literal when field is empty, otherwise a field of Env; key
+// is the label or annotation name.
+type operand struct {
+	field   string
+	key     string
+	literal string
+}
+
+func (o operand) value(env Env) string {
+	switch o.field {
+	case "":
+		return o.literal
+	case "status":
+		return env.Status
+	case "receiver":
+		return env.Receiver
+	case "labels":
+		return env.Labels[o.key]
+	case "annotations":
+		return env.Annotations[o.key]
+	}
+	return ""
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+var operators = []string{"==", "!=", "=~", "!~", "&&", "||", "!", "(", ")", "[", "]", ","}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '`':
+			j := i + 1
+			for j < len(src) && src[j] != src[i] {
+				if c == '"' && src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("offset %d: unterminated string", i)
+			}
+			s, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("offset %d: invalid string: %w", i, err)
+			}
+			toks = append(toks, token{kind: tokString, text: s, pos: i})
+			i = j + 1
+		case c == '_' || c == '.' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			start := i
+			for i < len(src) && (src[i] == '_' || src[i] == '.' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			toks = append(toks, token{kind: tokIdent, text: src[start:i], pos: start})
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("offset %d: unexpected character %q", i, c)
+			}
+			toks = append(toks, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) accept(kind tokenKind, text string) bool {
+	if t := p.peek(); t.kind == kind && t.text == text {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokOp, "||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokOp, "&&") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.accept(tokOp, "!") {
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	if p.accept(tokOp, "(") {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokOp || t.text != ")" {
+			return nil, fmt.Errorf("offset %d: expected \")\", found %s", t.pos, t)
+		}
+		return inner, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.next()
+	switch {
+	case t.kind == tokOp && (t.text == "==" || t.text == "!="):
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return eqNode{left: left, right: right, negate: t.text == "!="}, nil
+	case t.kind == tokOp && (t.text == "=~" || t.text == "!~"):
+		pt := p.next()
+		if pt.kind != tokString {
+			return nil, fmt.Errorf("offset %d: %s needs a string pattern, found %s", pt.pos, t.text, pt)
+		}
+		re, err := regexp.Compile("^(?:" + pt.text + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("offset %d: invalid regex %q: %w", pt.pos, pt.text, err)
+		}
+		return matchNode{left: left, re: re, negate: t.text == "!~"}, nil
+	case t.kind == tokIdent && t.text == "in":
+		return p.in(left, false)
+	case t.kind == tokIdent && t.text == "not":
+		if in := p.next(); in.kind != tokIdent || in.text != "in" {
+			return nil, fmt.Errorf("offset %d: expected \"in\" after \"not\", found %s", in.pos, in)
+		}
+		return p.in(left, true)
+	}
+	return nil, fmt.Errorf("offset %d: expected a comparison operator, found %s", t.pos, t)
+}
+
+func (p *parser) in(left operand, negate bool) (node, error) {
+	if t := p.next(); t.kind != tokOp || t.text != "[" {
+		return nil, fmt.Errorf("offset %d: expected \"[\", found %s", t.pos, t)
+	}
+	values := make(map[string]struct{})
+	for {
+		t := p.next()
+		if t.kind != tokString {
+			return nil, fmt.Errorf("offset %d: expected a string in the list, found %s", t.pos, t)
+		}
+		values[t.text] = struct{}{}
+		if p.accept(tokOp, ",") {
+			continue
+		}
+		if t := p.next(); t.kind != tokOp || t.text != "]" {
+			return nil, fmt.Errorf("offset %d: expected \",\" or \"]\", found %s", t.pos, t)
+		}
+		return inNode{left: left, values: values, negate: negate}, nil
+	}
+}
+
+func (p *parser) operand() (operand, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return operand{literal: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "status", "receiver":
+			return operand{field: t.text}, nil
+		}
+		for _, field := range []string{"labels", "annotations"} {
+			if key, ok := strings.CutPrefix(t.text, field+"."); ok && key != "" && !strings.Contains(key, ".") {
+				return operand{field: field, key: key}, nil
+			}
+		}
+		return operand{}, fmt.Errorf("offset %d: unknown field %s, want status, receiver, labels.<name> or annotations.<name>", t.pos, t)
+	}
+	return operand{}, fmt.Errorf("offset %d: expected a field or string, found %s", t.pos, t)
+}
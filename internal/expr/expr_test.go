@@ -0,0 +1,99 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompile_Errors(t *testing.T) {
+	cases := map[string]string{
+		`labels.severity`:                  "expected a comparison operator",
+		`labels.severity = "critical"`:     "unexpected character",
+		`label.severity == "critical"`:     "unknown field",
+		`labels.env =~ labels.pattern`:     "needs a string pattern",
+		`labels.env =~ "prod-("`:           "invalid regex",
+		`(status == "firing"`:              `expected ")"`,
+		`receiver in ["ops" "dba"]`:        `expected "," or "]"`,
+		`status == "firing`:                "unterminated string",
+		`status == "firing" receiver`:      "unexpected",
+		`receiver not ["ops"]`:             `expected "in" after "not"`,
+		`status == "firing" && || x == ""`: "expected a field or string",
+	}
+	for src, want := range cases {
+		_, err := Compile(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("Compile(%q) err=%v want %q", src, err, want)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	env := Env{
+		Status:      "firing",
+		Receiver:    "ops",
+		Labels:      map[string]string{"severity": "warning", "env": "prod-1"},
+		Annotations: map[string]string{"team": "sandbox"},
+	}
+	cases := []struct {
+		src  string
+		want bool
+	}{
+		// Fields.
+		{`status == "firing"`, true},
+		{`receiver != "ops"`, false},
+		{`labels.severity == "warning"`, true},
+		{`annotations.team == "sandbox"`, true},
+		{`"firing" == status`, true},
+
+		// ! binds tighter than &&, which binds tighter than ||.
+		{`status == "firing" || status == "x" && status == "y"`, true},
+		{`(status == "firing" || status == "x") && status == "y"`, false},
+		{`!status == "firing" || receiver == "ops"`, true},
+		{`!(status == "firing" || receiver == "ops")`, false},
+		{`!status == "resolved" && receiver == "dba"`, false},
+		{`!(status == "resolved" && receiver == "dba")`, true},
+		{`!!status == "firing"`, true},
+
+		// =~ and !~ are anchored at both ends.
+		{`labels.env =~ "prod"`, false},
+		{`labels.env =~ "rod-1"`, false},
+		{`labels.env =~ "prod-.*"`, true},
+		{"labels.env =~ `prod-\\d+`", true},
+		{`labels.env !~ "prod"`, true},
+		{`labels.env !~ "prod-1|dev"`, false},
+
+		// in and not in.
+		{`receiver in ["ops", "dba"]`, true},
+		{`receiver in ["dba"]`, false},
+		{`receiver not in ["ops", "dba"]`, false},
+		{`receiver not in ["dba"]`, true},
+		{`labels.severity in ["critical", "warning"] && !receiver in ["dba"]`, true},
+
+		// A missing label or annotation is "".
+		{`labels.team == ""`, true},
+		{`labels.team != ""`, false},
+		{`labels.team in [""]`, true},
+		{`labels.team not in ["a", "b"]`, true},
+		{`labels.team =~ ".*"`, true},
+		{`labels.team =~ ".+"`, false},
+		{`annotations.severity == ""`, true},
+	}
+	for _, tc := range cases {
+		e, err := Compile(tc.src)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tc.src, err)
+		}
+		if got := e.Eval(env); got != tc.want {
+			t.Errorf("Eval(%q)=%v want %v", tc.src, got, tc.want)
+		}
+	}
+
+	// A nil map behaves like an empty one.
+	e, err := Compile(`labels.severity == "" && annotations.team == ""`)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if !e.Eval(Env{}) {
+		t.Fatalf("Eval(Env{})=false, want true")
+	}
+}
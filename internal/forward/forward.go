@@ -0,0 +1,87 @@
+// Package forward mirrors raw Alertmanager payloads to other HTTP endpoints,
+// e.g. for archival, independently of DingTalk routing.
+package forward
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/dingtalk"
+)
+
+type Client struct {
+	httpClient *http.Client
+	// timeout bounds each forward request.
+	timeout time.Duration
+	// slots holds a token per forward in flight.
+	slots chan struct{}
+}
+
+// NewClient returns a client allowing maxPending forwards in flight; 0 or
+// less means 100.
+func NewClient(timeout time.Duration, maxPending int) *Client {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	if maxPending <= 0 {
+		maxPending = 100
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	return &Client{
+		httpClient: &http.Client{Transport: transport},
+		timeout:    timeout,
+		slots:      make(chan struct{}, maxPending),
+	}
+}
+
+// Reserve takes a slot for one forward and reports whether one was free.
+// Each successful Reserve must be paired with a Release.
+func (c *Client) Reserve() bool {
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release frees a slot taken by Reserve.
+func (c *Client) Release() {
+	<-c.slots
+}
+
+// Post sends body to rawURL as JSON. Any status other than 2xx is an error.
+// Errors carry the URL with its query values redacted, since endpoints often
+// take a token there.
+func (c *Client) Post(ctx context.Context, rawURL string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = dingtalk.RedactWebhook(urlErr.URL)
+		}
+		return fmt.Errorf("forward: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("forward to %s: status %d", dingtalk.RedactWebhook(rawURL), resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Package metrics exposes Prometheus metrics about the hook itself.
+//
+// Labels are limited to configured robot and channel names so cardinality
+// stays bounded regardless of the alerts being forwarded.
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+
+	"prometheus-dingtalk-hook/internal/dingtalk"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	SendsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dingtalk_hook_sends_total",
+		Help: "DingTalk sends by robot, channel and result.",
+	}, []string{"robot", "channel", "result"})
+
+	RenderErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dingtalk_hook_render_errors_total",
+		Help: "Template render failures by channel.",
+	}, []string{"channel"})
+
+	SendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dingtalk_hook_send_duration_seconds",
+		Help:    "Latency of DingTalk webhook calls.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"robot"})
+
+	ChannelThrottledTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dingtalk_hook_channel_throttled_total",
+		Help: "Notifications dropped by a channel rate limit.",
+	}, []string{"channel"})
+
+	QuietHoursSuppressedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "dingtalk_hook_quiet_hours_suppressed_total",
+		Help: "Notifications muted by dingtalk.quiet_hours.",
+	})
+
+	DedupSuppressedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "dingtalk_hook_dedup_suppressed_total",
+		Help: "Notifications suppressed as duplicates within dingtalk.dedup_window.",
+	})
+
+	RobotDedupSuppressedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dingtalk_hook_robot_dedup_suppressed_total",
+		Help: "Sends to a robot suppressed as duplicates when robots have their own dedup_window.",
+	}, []string{"robot"})
+
+	EmptyChannelsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dingtalk_hook_empty_channels_total",
+		Help: "Matched channels with no robot to send to, by channel.",
+	}, []string{"channel"})
+
+	MessagesTruncatedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dingtalk_hook_messages_truncated_total",
+		Help: "Rendered messages truncated to dingtalk.max_message_bytes, by channel.",
+	}, []string{"channel"})
+
+	MessageBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dingtalk_hook_message_bytes",
+		Help:    "Size of rendered message bodies, after truncation, by channel.",
+		Buckets: []float64{1000, 2000, 5000, 10000, 15000, 18000, 20000},
+	}, []string{"channel"})
+
+	ForwardsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dingtalk_hook_forwards_total",
+		Help: "Raw payloads mirrored to forward.urls and server.mirror_url, by result.",
+	}, []string{"result"})
+
+	ConfigReloadSuccessTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "dingtalk_hook_config_reload_success_timestamp",
+		Help: "Unix time of the last successful config reload.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		SendsTotal,
+		RenderErrorsTotal,
+		SendDuration,
+		ChannelThrottledTotal,
+		QuietHoursSuppressedTotal,
+		DedupSuppressedTotal,
+		RobotDedupSuppressedTotal,
+		EmptyChannelsTotal,
+		MessagesTruncatedTotal,
+		MessageBytes,
+		ForwardsTotal,
+		ConfigReloadSuccessTimestamp,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// WriteText writes the hook's own metrics (without Go and process metrics)
+// in the Prometheus text format.
+func WriteText(w io.Writer) error {
+	families, err := registry.Gather()
+	if err != nil {
+		return err
+	}
+	for _, mf := range families {
+		if !strings.HasPrefix(mf.GetName(), "dingtalk_hook_") {
+			continue
+		}
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ObserveSend records the outcome and latency of one send started at start.
+func ObserveSend(robot, channel string, start time.Time, err error) {
+	SendDuration.WithLabelValues(robot).Observe(time.Since(start).Seconds())
+	SendsTotal.WithLabelValues(robot, channel, result(err)).Inc()
+}
+
+// ObserveForward records the outcome of one forward.
+func ObserveForward(err error) {
+	ForwardsTotal.WithLabelValues(result(err)).Inc()
+}
+
+// ObserveForwardDropped records a forward skipped because forward.max_pending
+// were already in flight.
+func ObserveForwardDropped() {
+	ForwardsTotal.WithLabelValues("dropped").Inc()
+}
+
+func result(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, dingtalk.ErrRateLimited):
+		return "rate_limited"
+	default:
+		return "error"
+	}
+}
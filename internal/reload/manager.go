@@ -16,6 +16,7 @@ import (
 	"sync"
 	"time"
 
+	"prometheus-dingtalk-hook/internal/metrics"
 	"prometheus-dingtalk-hook/internal/runtime"
 )
 
@@ -26,20 +27,49 @@ type Manager struct {
 
 	interval time.Duration
 	enabled  bool
+	mode     string
 
 	mu              sync.Mutex
 	lastFingerprint string
 	lastSuccess     time.Time
 	lastError       error
+
+	// flight is the reload in progress, guarded by flightMu. Reloads that
+	// overlap it share its result instead of queueing behind it.
+	flightMu sync.Mutex
+	flight   *reloadCall
+}
+
+type reloadCall struct {
+	done  chan struct{}
+	force bool
+	err   error
 }
 
+// loadRuntime is runtime.LoadFromFile; tests replace it.
+var loadRuntime = runtime.LoadFromFile
+
 type Status struct {
 	Enabled     bool      `json:"enabled"`
+	Mode        string    `json:"mode"`
 	LastSuccess time.Time `json:"last_success"`
 	LastError   string    `json:"last_error"`
+
+	// CurrentFingerprint is computed from the files on disk now and
+	// LoadedFingerprint from those of the last successful load; Changed
+	// reports that they differ, i.e. an edit is waiting to be reloaded.
+	// CurrentFingerprint is empty when the files cannot be read.
+	CurrentFingerprint string `json:"current_fingerprint"`
+	LoadedFingerprint  string `json:"loaded_fingerprint"`
+	Changed            bool   `json:"changed"`
 }
 
-func New(logger *slog.Logger, configPath string, store *runtime.Store, enabled bool, interval time.Duration) (*Manager, error) {
+const (
+	ModePoll  = "poll"
+	ModeWatch = "watch"
+)
+
+func New(logger *slog.Logger, configPath string, store *runtime.Store, enabled bool, mode string, interval time.Duration) (*Manager, error) {
 	if logger == nil {
 		logger = slog.Default()
 	}
@@ -52,12 +82,20 @@ func New(logger *slog.Logger, configPath string, store *runtime.Store, enabled b
 	if interval <= 0 {
 		interval = 2 * time.Second
 	}
+	switch mode {
+	case "":
+		mode = ModePoll
+	case ModePoll, ModeWatch:
+	default:
+		return nil, fmt.Errorf("unknown reload mode %q", mode)
+	}
 
 	m := &Manager{
 		logger:     logger,
 		configPath: configPath,
 		store:      store,
 		enabled:    enabled,
+		mode:       mode,
 		interval:   interval,
 	}
 
@@ -73,6 +111,20 @@ func (m *Manager) Start(ctx context.Context) {
 	if !m.enabled {
 		return
 	}
+	if m.mode == ModeWatch {
+		err := m.startWatch(ctx)
+		if err == nil {
+			return
+		}
+		m.logger.Warn("reload watch unavailable, falling back to polling", "err", err)
+		m.mu.Lock()
+		m.mode = ModePoll
+		m.mu.Unlock()
+	}
+	m.startPoll(ctx)
+}
+
+func (m *Manager) startPoll(ctx context.Context) {
 	ticker := time.NewTicker(m.interval)
 	go func() {
 		defer ticker.Stop()
@@ -88,12 +140,20 @@ func (m *Manager) Start(ctx context.Context) {
 }
 
 func (m *Manager) Status() Status {
+	current, err := m.fingerprintFromCurrent()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	st := Status{
-		Enabled:     m.enabled,
-		LastSuccess: m.lastSuccess,
+		Enabled:           m.enabled,
+		Mode:              m.mode,
+		LastSuccess:       m.lastSuccess,
+		LoadedFingerprint: m.lastFingerprint,
+	}
+	if err == nil {
+		st.CurrentFingerprint = current
+		st.Changed = current != m.lastFingerprint
 	}
 	if m.lastError != nil {
 		st.LastError = m.lastError.Error()
@@ -116,39 +176,137 @@ func (m *Manager) ReloadIfChanged(ctx context.Context) error {
 	return m.Reload(ctx, false)
 }
 
+// Reload loads the config and templates and swaps them in. A call made while
+// another reload is in progress waits for it and returns its result, except
+// that a forced call does not settle for an unforced reload, which may have
+// skipped loading; it runs its own reload afterwards.
 func (m *Manager) Reload(ctx context.Context, force bool) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	return m.exclusive(ctx, force, true, func() error { return m.reload(force) })
+}
 
+// Apply runs write, which changes the config or templates on disk, and then
+// a forced reload, as a single reload. A watcher or poller that notices the
+// write meanwhile waits for it and shares its result instead of loading the
+// same files a second time. If write fails nothing is reloaded.
+func (m *Manager) Apply(ctx context.Context, write func() error) error {
+	return m.exclusive(ctx, true, false, func() error {
+		if err := write(); err != nil {
+			return err
+		}
+		return m.reload(true)
+	})
+}
+
+// Install swaps in next, a runtime the caller has already built from the
+// files that commit writes. commit runs while no reload is in progress, so a
+// reload never observes a half-written change, and only the file writes and
+// the swap happen there; building next, the slow part, does not hold up
+// reloads. If commit fails nothing is swapped and its error is returned.
+func (m *Manager) Install(ctx context.Context, next *runtime.Runtime, commit func() error) error {
+	if next == nil {
+		return errors.New("runtime is nil")
+	}
+	return m.exclusive(ctx, true, false, func() error {
+		if err := commit(); err != nil {
+			return err
+		}
+		// A fingerprint error leaves lastFingerprint empty, so the next
+		// poll reloads from disk instead of trusting next.
+		nextFP, err := fingerprint(m.configPath, next)
+		if err != nil {
+			m.logger.Warn("install: fingerprint failed", "err", err)
+		}
+		m.swap(next, nextFP)
+		m.logger.Info("install ok")
+		return nil
+	})
+}
+
+// exclusive runs fn as the only reload in flight. When another is already in
+// flight it waits for it and, if share is set, returns its result instead of
+// running fn; see Reload for when a forced call settles for it.
+func (m *Manager) exclusive(ctx context.Context, force, share bool, fn func() error) error {
+	for {
+		m.flightMu.Lock()
+		c := m.flight
+		if c == nil {
+			c = &reloadCall{done: make(chan struct{}), force: force}
+			m.flight = c
+			m.flightMu.Unlock()
+
+			c.err = fn()
+
+			m.flightMu.Lock()
+			m.flight = nil
+			m.flightMu.Unlock()
+			close(c.done)
+			return c.err
+		}
+		m.flightMu.Unlock()
+
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if share && (c.force || !force) {
+			return c.err
+		}
+	}
+}
+
+// reload does the work of Reload. Only one runs at a time; m.mu is held just
+// long enough to read and update the status so Status never blocks on a load.
+func (m *Manager) reload(force bool) error {
 	currentFP, err := m.fingerprintFromCurrent()
 	if err != nil {
-		m.lastError = err
+		m.setError(err)
 		return err
 	}
-	if !force && currentFP == m.lastFingerprint {
+	m.mu.Lock()
+	unchanged := currentFP == m.lastFingerprint
+	m.mu.Unlock()
+	if !force && unchanged {
 		return nil
 	}
 
-	next, err := runtime.LoadFromFile(m.logger, m.configPath)
+	next, err := loadRuntime(m.logger, m.configPath)
 	if err != nil {
-		m.lastError = err
+		m.setError(err)
 		m.logger.Error("reload failed", "err", err)
 		return err
 	}
 
 	nextFP, err := fingerprint(m.configPath, next)
 	if err != nil {
-		m.lastError = err
+		m.setError(err)
 		m.logger.Error("reload failed (fingerprint)", "err", err)
 		return err
 	}
 
+	m.swap(next, nextFP)
+	m.logger.Info("reload ok")
+	return nil
+}
+
+// swap stores next, carrying over state from the current runtime, and
+// records the load as successful.
+func (m *Manager) swap(next *runtime.Runtime, fp string) {
+	next.Inherit(m.store.Load())
 	m.store.Store(next)
-	m.lastFingerprint = nextFP
+
+	m.mu.Lock()
+	m.lastFingerprint = fp
 	m.lastSuccess = time.Now()
 	m.lastError = nil
-	m.logger.Info("reload ok")
-	return nil
+	metrics.ConfigReloadSuccessTimestamp.Set(float64(m.lastSuccess.Unix()))
+	m.mu.Unlock()
+}
+
+func (m *Manager) setError(err error) {
+	m.mu.Lock()
+	m.lastError = err
+	m.mu.Unlock()
 }
 
 func (m *Manager) fingerprintFromCurrent() (string, error) {
@@ -164,6 +322,31 @@ func fingerprint(configPath string, rt *runtime.Runtime) (string, error) {
 	var tplDir string
 	if rt != nil && rt.Config != nil {
 		tplDir = strings.TrimSpace(rt.Config.Template.Dir)
+
+		srv := rt.Config.Server
+		for _, p := range []string{srv.TLSCertFile, srv.TLSKeyFile, srv.ClientCAFile} {
+			if strings.TrimSpace(p) == "" {
+				continue
+			}
+			if err := hashFileStat(h, p); err != nil {
+				return "", err
+			}
+		}
+		for _, p := range rt.Config.IncludedPaths() {
+			if err := hashFileStat(h, p); err != nil {
+				return "", err
+			}
+		}
+		// Secret files are small and may be rewritten in place with a value
+		// of the same length within the mtime granularity, so hash contents.
+		for _, p := range rt.Config.SecretFiles() {
+			if err := hashFileStat(h, p); err != nil {
+				return "", err
+			}
+			if err := hashFileContent(h, p); err != nil {
+				return "", err
+			}
+		}
 	}
 
 	if tplDir != "" {
@@ -183,11 +366,30 @@ func hashFileStat(h hash.Hash, path string) error {
 	_, _ = h.Write([]byte("file:"))
 	_, _ = h.Write([]byte(path))
 	_, _ = h.Write([]byte{0})
+	// Kubernetes ConfigMap volumes update by swapping the ..data symlink to a
+	// new timestamped directory; the resolved path changes even when size and
+	// mtime happen to match.
+	if real, err := filepath.EvalSymlinks(path); err == nil && real != path {
+		_, _ = h.Write([]byte(real))
+		_, _ = h.Write([]byte{0})
+	}
 	_, _ = h.Write([]byte(fmt.Sprintf("%d:%d", st.Size(), st.ModTime().UnixNano())))
 	_, _ = h.Write([]byte{0})
 	return nil
 }
 
+func hashFileContent(h hash.Hash, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	sum := sha256.Sum256(data)
+	_, _ = h.Write([]byte("content:"))
+	_, _ = h.Write(sum[:])
+	_, _ = h.Write([]byte{0})
+	return nil
+}
+
 func hashTemplateDir(h hash.Hash, dir string) error {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
@@ -2,11 +2,20 @@ package reload
 
 import (
 	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/dingtalk"
 	"prometheus-dingtalk-hook/internal/runtime"
 )
 
@@ -43,7 +52,7 @@ dingtalk:
 	}
 	store := runtime.NewStore(rt)
 
-	mgr, err := New(nil, cfgPath, store, false, 2*time.Second)
+	mgr, err := New(nil, cfgPath, store, false, ModePoll, 2*time.Second)
 	if err != nil {
 		t.Fatalf("New: %v", err)
 	}
@@ -97,7 +106,7 @@ dingtalk:
 		t.Fatalf("LoadFromFile: %v", err)
 	}
 	store := runtime.NewStore(rt)
-	mgr, err := New(nil, cfgPath, store, false, 2*time.Second)
+	mgr, err := New(nil, cfgPath, store, false, ModePoll, 2*time.Second)
 	if err != nil {
 		t.Fatalf("New: %v", err)
 	}
@@ -127,3 +136,345 @@ dingtalk:
 		t.Fatalf("token=%q want %q", store.Load().Config.Auth.Token, "b")
 	}
 }
+
+func TestReload_EmptiedTemplateDirFallsBackToEmbedded(t *testing.T) {
+	dir := t.TempDir()
+	tplDir := filepath.Join(dir, "templates")
+	if err := os.MkdirAll(tplDir, 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tplDir, "default.tmpl"), []byte("custom"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	cfgPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte(`
+template:
+  dir: "templates"
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+      msg_type: "text"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	rt, err := runtime.LoadFromFile(nil, cfgPath)
+	if err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	store := runtime.NewStore(rt)
+	mgr, err := New(nil, cfgPath, store, false, ModePoll, 2*time.Second)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	payload := alertmanager.WebhookMessage{Status: "firing"}
+	if out, err := store.Load().Renderer.Render("default", payload); err != nil || out != "custom" {
+		t.Fatalf("before: out=%q err=%v", out, err)
+	}
+
+	if err := os.Remove(filepath.Join(tplDir, "default.tmpl")); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := mgr.Reload(context.Background(), true); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	out, err := store.Load().Renderer.Render("default", payload)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(out, "### 🔥 告警触发") {
+		t.Fatalf("out=%q want embedded default", out)
+	}
+}
+
+func TestReload_ConcurrentCallsShareOneLoad(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte(`
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	rt, err := runtime.LoadFromFile(nil, cfgPath)
+	if err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	mgr, err := New(nil, cfgPath, runtime.NewStore(rt), false, ModePoll, 2*time.Second)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	var loads atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loadRuntime = func(logger *slog.Logger, path string) (*runtime.Runtime, error) {
+		if loads.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return runtime.LoadFromFile(logger, path)
+	}
+	t.Cleanup(func() { loadRuntime = runtime.LoadFromFile })
+
+	const callers = 5
+	errs := make(chan error, callers)
+	go func() { errs <- mgr.Reload(context.Background(), true) }()
+	<-started
+	for i := 1; i < callers; i++ {
+		go func() { errs <- mgr.Reload(context.Background(), true) }()
+	}
+
+	// Status must not wait for the load in progress.
+	statusDone := make(chan struct{})
+	go func() {
+		_ = mgr.Status()
+		close(statusDone)
+	}()
+	select {
+	case <-statusDone:
+	case <-time.After(time.Second):
+		t.Fatalf("Status blocked by reload in progress")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < callers; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("Reload: %v", err)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("loads=%d want 1", n)
+	}
+}
+
+// TestApply_WatcherDuringWriteSharesReload simulates an admin config PUT
+// whose write is noticed by the watcher before the PUT's own reload starts.
+func TestApply_WatcherDuringWriteSharesReload(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	cfg := func(title string) []byte {
+		return []byte(`
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+      title: "` + title + `"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`)
+	}
+	if err := os.WriteFile(cfgPath, cfg("before"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	rt, err := runtime.LoadFromFile(nil, cfgPath)
+	if err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	store := runtime.NewStore(rt)
+	mgr, err := New(nil, cfgPath, store, false, ModePoll, 2*time.Second)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	var loads atomic.Int32
+	loadRuntime = func(logger *slog.Logger, path string) (*runtime.Runtime, error) {
+		loads.Add(1)
+		return runtime.LoadFromFile(logger, path)
+	}
+	t.Cleanup(func() { loadRuntime = runtime.LoadFromFile })
+
+	watcher := make(chan error, 1)
+	err = mgr.Apply(context.Background(), func() error {
+		if err := os.WriteFile(cfgPath, cfg("after"), 0o644); err != nil {
+			return err
+		}
+		go func() { watcher <- mgr.ReloadIfChanged(context.Background()) }()
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if err := <-watcher; err != nil {
+		t.Fatalf("watcher reload: %v", err)
+	}
+	if err := mgr.ReloadIfChanged(context.Background()); err != nil {
+		t.Fatalf("ReloadIfChanged: %v", err)
+	}
+
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("loads=%d want 1", n)
+	}
+	if got := store.Load().Robots["r1"].Title; got != "after" {
+		t.Fatalf("title=%q want after", got)
+	}
+}
+
+func TestReloadIfChanged_SecretFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenPath, []byte("a"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	cfgPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte(`
+auth:
+  token_file: "token"
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	rt, err := runtime.LoadFromFile(nil, cfgPath)
+	if err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	store := runtime.NewStore(rt)
+	mgr, err := New(nil, cfgPath, store, false, ModePoll, 2*time.Second)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if err := os.WriteFile(tokenPath, []byte("rotated"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := mgr.ReloadIfChanged(context.Background()); err != nil {
+		t.Fatalf("ReloadIfChanged: %v", err)
+	}
+	if got := store.Load().Config.Auth.Token; got != "rotated" {
+		t.Fatalf("token=%q want rotated", got)
+	}
+}
+
+func TestReloadIfChanged_RobotSecretRotationSameSizeAndMtime(t *testing.T) {
+	var query atomic.Value
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query.Store(r.URL.Query())
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secretPath, []byte("SEC-old"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	st, err := os.Stat(secretPath)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	cfgPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte(`
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "`+dt.URL+`"
+      secret_file: "secret"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	rt, err := runtime.LoadFromFile(nil, cfgPath)
+	if err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	store := runtime.NewStore(rt)
+	mgr, err := New(nil, cfgPath, store, false, ModePoll, 2*time.Second)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// Rotate in place: same length, mtime restored, so only the content differs.
+	if err := os.WriteFile(secretPath, []byte("SEC-new"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.Chtimes(secretPath, st.ModTime(), st.ModTime()); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+	if err := mgr.ReloadIfChanged(context.Background()); err != nil {
+		t.Fatalf("ReloadIfChanged: %v", err)
+	}
+
+	cur := store.Load()
+	if cur == rt {
+		t.Fatalf("secret rotation did not trigger a reload")
+	}
+	robot := cur.Robots["r1"]
+	if err := cur.DingTalk.SendTo(context.Background(), runtime.Target(robot), dingtalk.Message{MsgType: "text", Text: "hi"}); err != nil {
+		t.Fatalf("SendTo: %v", err)
+	}
+	q, _ := query.Load().(url.Values)
+	ts, err := strconv.ParseInt(q.Get("timestamp"), 10, 64)
+	if err != nil {
+		t.Fatalf("timestamp=%q: %v", q.Get("timestamp"), err)
+	}
+	if q.Get("sign") != dingtalk.Sign(ts, "SEC-new") {
+		t.Fatalf("send not signed with the rotated secret: %v", q)
+	}
+}
+
+func TestStatus_ReportsPendingChange(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	cfg := `
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`
+	if err := os.WriteFile(cfgPath, []byte(cfg), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	rt, err := runtime.LoadFromFile(nil, cfgPath)
+	if err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	mgr, err := New(nil, cfgPath, runtime.NewStore(rt), false, ModePoll, 2*time.Second)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	st := mgr.Status()
+	if st.Changed || st.CurrentFingerprint == "" || st.CurrentFingerprint != st.LoadedFingerprint {
+		t.Fatalf("fresh status=%+v", st)
+	}
+
+	if err := os.WriteFile(cfgPath, []byte(cfg+"\n# edited\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	st = mgr.Status()
+	if !st.Changed || st.CurrentFingerprint == st.LoadedFingerprint {
+		t.Fatalf("after edit status=%+v want changed", st)
+	}
+
+	if err := mgr.Reload(context.Background(), false); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if st = mgr.Status(); st.Changed {
+		t.Fatalf("after reload status=%+v want unchanged", st)
+	}
+}
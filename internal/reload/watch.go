@@ -0,0 +1,123 @@
+package reload
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce coalesces the burst of events editors produce on save
+// (truncate+write, or write-temp+rename) into a single reload.
+const watchDebounce = 200 * time.Millisecond
+
+// startWatch reloads on filesystem notifications instead of polling. It
+// watches the directories containing the config file, the template dir, the
+// TLS files and the *_file secrets rather than the files themselves, so
+// atomic rename-based saves keep being observed. That also covers Kubernetes
+// ConfigMap and Secret volumes, where an update renames a new ..data symlink
+// into the mounted directory.
+// Each event only triggers ReloadIfChanged, which still compares
+// fingerprints, so unrelated files in those directories are harmless.
+func (m *Manager) startWatch(ctx context.Context) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	watched := map[string]bool{}
+	if err := m.syncWatches(w, watched); err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	go func() {
+		defer w.Close()
+
+		timer := time.NewTimer(watchDebounce)
+		if !timer.Stop() {
+			<-timer.C
+		}
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+					continue
+				}
+				timer.Reset(watchDebounce)
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				m.logger.Warn("reload watch error", "err", err)
+			case <-timer.C:
+				_ = m.ReloadIfChanged(ctx)
+				if err := m.syncWatches(w, watched); err != nil {
+					m.logger.Warn("reload watch update failed", "err", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// syncWatches adds watches for directories that became relevant after a
+// reload (e.g. a changed template.dir). Directories that no longer matter
+// stay watched; the fingerprint check makes their events no-ops.
+func (m *Manager) syncWatches(w *fsnotify.Watcher, watched map[string]bool) error {
+	for _, dir := range m.watchDirs() {
+		if watched[dir] {
+			continue
+		}
+		if err := w.Add(dir); err != nil {
+			// The config dir must be watchable; the others may not exist yet.
+			if dir == filepath.Dir(m.configPath) {
+				return err
+			}
+			continue
+		}
+		watched[dir] = true
+	}
+	return nil
+}
+
+func (m *Manager) watchDirs() []string {
+	dirs := []string{filepath.Dir(m.configPath)}
+	// A config symlinked from elsewhere changes in its target directory.
+	if real, err := filepath.EvalSymlinks(m.configPath); err == nil {
+		if dir := filepath.Dir(real); dir != dirs[0] {
+			dirs = append(dirs, dir)
+		}
+	}
+	rt := m.store.Load()
+	if rt == nil || rt.Config == nil {
+		return dirs
+	}
+	if dir := strings.TrimSpace(rt.Config.Template.Dir); dir != "" {
+		dirs = append(dirs, filepath.Clean(dir))
+	}
+	// Included directories are watched themselves, for files added to them.
+	for _, p := range rt.Config.IncludedPaths() {
+		if st, err := os.Stat(p); err == nil && st.IsDir() {
+			dirs = append(dirs, filepath.Clean(p))
+		} else {
+			dirs = append(dirs, filepath.Dir(p))
+		}
+	}
+	srv := rt.Config.Server
+	for _, p := range append([]string{srv.TLSCertFile, srv.TLSKeyFile, srv.ClientCAFile}, rt.Config.SecretFiles()...) {
+		if strings.TrimSpace(p) != "" {
+			dirs = append(dirs, filepath.Dir(p))
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,133 @@
+package reload
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+const watchTestConfig = `
+auth:
+  token: "%s"
+dingtalk:
+  robots:
+    - name: "r1"
+      webhook: "http://example.invalid"
+      msg_type: "text"
+  channels:
+    - name: "default"
+      robots: ["r1"]
+`
+
+func TestReload_WatchModeReloadsOnRename(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte(fmt.Sprintf(watchTestConfig, "a")), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	rt, err := runtime.LoadFromFile(nil, cfgPath)
+	if err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	store := runtime.NewStore(rt)
+	// A long poll interval makes sure the change is picked up by the watcher.
+	mgr, err := New(nil, cfgPath, store, true, ModeWatch, time.Hour)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+	if got := mgr.Status().Mode; got != ModeWatch {
+		t.Fatalf("mode=%q want %q", got, ModeWatch)
+	}
+
+	// Editors commonly save by writing a temp file and renaming it over. The
+	// token length differs so the size-based fingerprint changes even when
+	// both writes land within the same mtime tick.
+	tmp := filepath.Join(dir, ".config.yaml.swp")
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf(watchTestConfig, "bb")), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.Rename(tmp, cfgPath); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for store.Load().Config.Auth.Token != "bb" {
+		if time.Now().After(deadline) {
+			t.Fatalf("token=%q want %q", store.Load().Config.Auth.Token, "bb")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// TestReload_WatchModeConfigMapSwap simulates how the kubelet updates a
+// ConfigMap volume: files are symlinks through ..data, which is atomically
+// replaced to point at a new timestamped directory.
+func TestReload_WatchModeConfigMapSwap(t *testing.T) {
+	dir := t.TempDir()
+	writeVersion := func(name, token string, mtime time.Time) {
+		t.Helper()
+		vdir := filepath.Join(dir, name)
+		if err := os.MkdirAll(vdir, 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		p := filepath.Join(vdir, "config.yaml")
+		if err := os.WriteFile(p, []byte(fmt.Sprintf(watchTestConfig, token)), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+
+	// Same size and mtime in both versions: only the symlink target differs.
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeVersion("..2024_01_01_00_00_00.1", "a", mtime)
+	if err := os.Symlink("..2024_01_01_00_00_00.1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+	cfgPath := filepath.Join(dir, "config.yaml")
+	if err := os.Symlink(filepath.Join("..data", "config.yaml"), cfgPath); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+
+	rt, err := runtime.LoadFromFile(nil, cfgPath)
+	if err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	store := runtime.NewStore(rt)
+	mgr, err := New(nil, cfgPath, store, true, ModeWatch, time.Hour)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr.Start(ctx)
+
+	writeVersion("..2024_01_01_00_01_00.2", "b", mtime)
+	if err := os.Symlink("..2024_01_01_00_01_00.2", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "..2024_01_01_00_00_00.1")); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for store.Load().Config.Auth.Token != "b" {
+		if time.Now().After(deadline) {
+			t.Fatalf("token=%q want %q", store.Load().Config.Auth.Token, "b")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -2,16 +2,25 @@
 package router
 
 import (
+	"regexp"
+	"slices"
 	"strings"
 
 	"prometheus-dingtalk-hook/internal/alertmanager"
 	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/expr"
 )
 
 type When struct {
 	receivers map[string]struct{}
 	statuses  map[string]struct{}
 	labels    map[string]map[string]struct{}
+	regexes   map[string][]*regexp.Regexp
+	excluded  map[string]map[string]struct{}
+	// firingOnly requires at least one firing alert.
+	firingOnly bool
+	// expr is the compiled when.expr; nil when not set.
+	expr *expr.Expr
 }
 
 func CompileWhen(c config.WhenConfig) When {
@@ -19,6 +28,10 @@ func CompileWhen(c config.WhenConfig) When {
 		receivers: make(map[string]struct{}, len(c.Receiver)),
 		statuses:  make(map[string]struct{}, len(c.Status)),
 		labels:    make(map[string]map[string]struct{}, len(c.Labels)),
+		regexes:   make(map[string][]*regexp.Regexp, len(c.LabelsRegex)),
+		excluded:  make(map[string]map[string]struct{}, len(c.LabelsNot)),
+
+		firingOnly: c.FiringOnly,
 	}
 
 	for _, v := range c.Receiver {
@@ -37,7 +50,43 @@ func CompileWhen(c config.WhenConfig) When {
 		w.statuses[v] = struct{}{}
 	}
 
-	for k, vs := range c.Labels {
+	compileLabelSets(w.labels, c.Labels)
+	compileLabelSets(w.excluded, c.LabelsNot)
+
+	for k, patterns := range c.LabelsRegex {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		var res []*regexp.Regexp
+		for _, p := range patterns {
+			// Patterns are checked by config validation; anything that still
+			// fails to compile is ignored like other empty conditions.
+			re, err := config.CompileLabelRegex(strings.TrimSpace(p))
+			if err != nil {
+				continue
+			}
+			res = append(res, re)
+		}
+		if len(res) == 0 {
+			continue
+		}
+		w.regexes[k] = res
+	}
+
+	// Like patterns, an expression that fails to compile was already
+	// rejected by config validation.
+	if src := strings.TrimSpace(c.Expr); src != "" {
+		if e, err := expr.Compile(src); err == nil {
+			w.expr = e
+		}
+	}
+
+	return w
+}
+
+func compileLabelSets(dst map[string]map[string]struct{}, src map[string][]string) {
+	for k, vs := range src {
 		k = strings.TrimSpace(k)
 		if k == "" {
 			continue
@@ -53,10 +102,8 @@ func CompileWhen(c config.WhenConfig) When {
 		if len(set) == 0 {
 			continue
 		}
-		w.labels[k] = set
+		dst[k] = set
 	}
-
-	return w
 }
 
 func (w When) Match(msg alertmanager.WebhookMessage) bool {
@@ -67,18 +114,17 @@ func (w When) Match(msg alertmanager.WebhookMessage) bool {
 	}
 
 	if len(w.statuses) > 0 {
-		status := strings.TrimSpace(strings.ToLower(msg.Status))
-		if _, ok := w.statuses[status]; !ok {
+		if _, ok := w.statuses[messageStatus(msg)]; !ok {
 			return false
 		}
 	}
+	if w.firingOnly && messageStatus(msg) != "firing" {
+		return false
+	}
 
 	if len(w.labels) > 0 {
 		for k, allowed := range w.labels {
-			v, ok := msg.CommonLabels[k]
-			if !ok {
-				v, ok = msg.GroupLabels[k]
-			}
+			v, ok := labelValue(msg, k)
 			if !ok {
 				return false
 			}
@@ -88,13 +134,91 @@ func (w When) Match(msg alertmanager.WebhookMessage) bool {
 		}
 	}
 
+	for k, res := range w.regexes {
+		v, ok := labelValue(msg, k)
+		if !ok || !matchAny(res, v) {
+			return false
+		}
+	}
+
+	for k, denied := range w.excluded {
+		if v, ok := labelValue(msg, k); ok {
+			if _, hit := denied[v]; hit {
+				return false
+			}
+		}
+	}
+
+	if w.expr != nil && !w.expr.Eval(exprEnv(msg)) {
+		return false
+	}
+
 	return true
 }
 
+// exprEnv exposes msg to when.expr. Labels are looked up like labelValue
+// does: common labels first, then group labels.
+func exprEnv(msg alertmanager.WebhookMessage) expr.Env {
+	labels := make(map[string]string, len(msg.GroupLabels)+len(msg.CommonLabels))
+	for k, v := range msg.GroupLabels {
+		labels[k] = v
+	}
+	for k, v := range msg.CommonLabels {
+		labels[k] = v
+	}
+	return expr.Env{
+		Status:      messageStatus(msg),
+		Receiver:    msg.Receiver,
+		Labels:      labels,
+		Annotations: msg.CommonAnnotations,
+	}
+}
+
+// messageStatus returns the status of msg, lower-cased. A payload without
+// a status takes it from its alerts like Alertmanager does: firing when any
+// alert is firing, resolved when all of them are.
+func messageStatus(msg alertmanager.WebhookMessage) string {
+	status := strings.TrimSpace(strings.ToLower(msg.Status))
+	if status != "" || len(msg.Alerts) == 0 {
+		return status
+	}
+	resolved := 0
+	for _, a := range msg.Alerts {
+		switch strings.TrimSpace(strings.ToLower(a.Status)) {
+		case "firing":
+			return "firing"
+		case "resolved":
+			resolved++
+		}
+	}
+	if resolved == len(msg.Alerts) {
+		return "resolved"
+	}
+	return ""
+}
+
+func labelValue(msg alertmanager.WebhookMessage, name string) (string, bool) {
+	v, ok := msg.CommonLabels[name]
+	if !ok {
+		v, ok = msg.GroupLabels[name]
+	}
+	return v, ok
+}
+
+func matchAny(res []*regexp.Regexp, v string) bool {
+	for _, re := range res {
+		if re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
 type Route struct {
 	Name     string
 	When     When
 	Channels []string
+	Continue bool
 }
 
 func CompileRoutes(routes []config.RouteConfig) []Route {
@@ -104,24 +228,76 @@ func CompileRoutes(routes []config.RouteConfig) []Route {
 			Name:     r.Name,
 			When:     CompileWhen(r.When),
 			Channels: append([]string(nil), r.Channels...),
+			Continue: r.Continue,
 		})
 	}
 	return out
 }
 
 func FirstMatch(routes []Route, msg alertmanager.WebhookMessage) []string {
+	if r, ok := MatchRoute(routes, msg); ok {
+		return r.Channels
+	}
+	return nil
+}
+
+// MatchRoute returns the first route whose conditions match msg.
+func MatchRoute(routes []Route, msg alertmanager.WebhookMessage) (Route, bool) {
 	for _, r := range routes {
 		if r.When.Match(msg) {
-			return r.Channels
+			return r, true
 		}
 	}
-	return nil
+	return Route{}, false
+}
+
+// AllMatch returns the matching routes in order, stopping after the first
+// match that does not set Continue.
+func AllMatch(routes []Route, msg alertmanager.WebhookMessage) []Route {
+	var out []Route
+	for _, r := range routes {
+		if !r.When.Match(msg) {
+			continue
+		}
+		out = append(out, r)
+		if !r.Continue {
+			break
+		}
+	}
+	return out
+}
+
+// RouteNames returns the names of routes in order.
+func RouteNames(routes []Route) []string {
+	out := make([]string, 0, len(routes))
+	for _, r := range routes {
+		out = append(out, r.Name)
+	}
+	return out
+}
+
+// UnionChannels returns the channels of routes without duplicates, in first
+// seen order.
+func UnionChannels(routes []Route) []string {
+	var out []string
+	seen := make(map[string]struct{})
+	for _, r := range routes {
+		for _, ch := range r.Channels {
+			if _, ok := seen[ch]; ok {
+				continue
+			}
+			seen[ch] = struct{}{}
+			out = append(out, ch)
+		}
+	}
+	return out
 }
 
 type MentionRule struct {
 	Name    string
 	When    When
 	Mention config.MentionConfig
+	From    config.MentionFromConfig
 }
 
 func CompileMentionRules(rules []config.MentionRuleConfig) []MentionRule {
@@ -131,19 +307,74 @@ func CompileMentionRules(rules []config.MentionRuleConfig) []MentionRule {
 			Name:    r.Name,
 			When:    CompileWhen(r.When),
 			Mention: r.Mention,
+			From: config.MentionFromConfig{
+				UserIdLabel:      strings.TrimSpace(r.From.UserIdLabel),
+				UserIdAnnotation: strings.TrimSpace(r.From.UserIdAnnotation),
+				MobileLabel:      strings.TrimSpace(r.From.MobileLabel),
+				MobileAnnotation: strings.TrimSpace(r.From.MobileAnnotation),
+			},
 		})
 	}
 	return out
 }
 
+var (
+	mentionUserIdRE = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+	mentionMobileRE = regexp.MustCompile(`^\+?[0-9][0-9-]{4,19}$`)
+)
+
+// FromAlerts returns the user ids and mobiles found in the labels and
+// annotations named by r.From across the alerts of msg, or in its common
+// labels and annotations when it carries no alerts. Invalid lists the
+// values that were skipped because they do not look like a user id or a
+// mobile number.
+func (r MentionRule) FromAlerts(msg alertmanager.WebhookMessage) (m config.MentionConfig, invalid []string) {
+	sources := make([][2]map[string]string, 0, len(msg.Alerts))
+	for _, a := range msg.Alerts {
+		sources = append(sources, [2]map[string]string{a.Labels, a.Annotations})
+	}
+	if len(sources) == 0 {
+		sources = append(sources, [2]map[string]string{msg.CommonLabels, msg.CommonAnnotations})
+	}
+
+	collect := func(dst []string, key string, kv map[string]string, re *regexp.Regexp) []string {
+		if key == "" {
+			return dst
+		}
+		for _, v := range strings.Split(kv[key], ",") {
+			v = strings.TrimPrefix(strings.TrimSpace(v), "@")
+			if v == "" {
+				continue
+			}
+			if !re.MatchString(v) {
+				invalid = append(invalid, v)
+				continue
+			}
+			dst = append(dst, v)
+		}
+		return dst
+	}
+	for _, src := range sources {
+		labels, annotations := src[0], src[1]
+		m.AtUserIds = collect(m.AtUserIds, r.From.UserIdLabel, labels, mentionUserIdRE)
+		m.AtUserIds = collect(m.AtUserIds, r.From.UserIdAnnotation, annotations, mentionUserIdRE)
+		m.AtMobiles = collect(m.AtMobiles, r.From.MobileLabel, labels, mentionMobileRE)
+		m.AtMobiles = collect(m.AtMobiles, r.From.MobileAnnotation, annotations, mentionMobileRE)
+	}
+	return m, invalid
+}
+
+// MergeMention returns base with the targets of extra added. base often
+// belongs to a shared channel, so its slices are copied, never appended to
+// in place.
 func MergeMention(base config.MentionConfig, extra config.MentionConfig) config.MentionConfig {
 	out := base
 	out.AtAll = out.AtAll || extra.AtAll
 	if len(extra.AtMobiles) > 0 {
-		out.AtMobiles = append(out.AtMobiles, extra.AtMobiles...)
+		out.AtMobiles = append(slices.Clip(out.AtMobiles), extra.AtMobiles...)
 	}
 	if len(extra.AtUserIds) > 0 {
-		out.AtUserIds = append(out.AtUserIds, extra.AtUserIds...)
+		out.AtUserIds = append(slices.Clip(out.AtUserIds), extra.AtUserIds...)
 	}
 	return out
 }
@@ -0,0 +1,174 @@
+package router
+
+import (
+	"strings"
+	"testing"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/config"
+)
+
+func TestWhen_LabelsRegex(t *testing.T) {
+	w := CompileWhen(config.WhenConfig{
+		Labels:      map[string][]string{"env": {"prod"}},
+		LabelsRegex: map[string][]string{"instance": {"web-.*", "api-[0-9]+"}},
+	})
+
+	cases := []struct {
+		labels map[string]string
+		want   bool
+	}{
+		{map[string]string{"env": "prod", "instance": "web-01"}, true},
+		{map[string]string{"env": "prod", "instance": "api-7"}, true},
+		// Patterns are anchored: a partial match is not enough.
+		{map[string]string{"env": "prod", "instance": "old-web-01"}, false},
+		{map[string]string{"env": "prod", "instance": "api-x"}, false},
+		{map[string]string{"env": "dev", "instance": "web-01"}, false},
+		{map[string]string{"env": "prod"}, false},
+	}
+	for _, tc := range cases {
+		got := w.Match(alertmanager.WebhookMessage{CommonLabels: tc.labels})
+		if got != tc.want {
+			t.Fatalf("Match(%v)=%v want %v", tc.labels, got, tc.want)
+		}
+	}
+}
+
+func TestWhen_LabelsNot(t *testing.T) {
+	w := CompileWhen(config.WhenConfig{
+		Labels:    map[string][]string{"severity": {"critical", "warning", "info"}},
+		LabelsNot: map[string][]string{"severity": {"info"}, "team": {"sandbox"}},
+	})
+
+	cases := []struct {
+		labels map[string]string
+		want   bool
+	}{
+		{map[string]string{"severity": "critical"}, true},
+		{map[string]string{"severity": "info"}, false},
+		{map[string]string{"severity": "warning", "team": "sandbox"}, false},
+		{map[string]string{"severity": "warning", "team": "ops"}, true},
+	}
+	for _, tc := range cases {
+		got := w.Match(alertmanager.WebhookMessage{CommonLabels: tc.labels})
+		if got != tc.want {
+			t.Fatalf("Match(%v)=%v want %v", tc.labels, got, tc.want)
+		}
+	}
+}
+
+func TestWhen_FiringOnly(t *testing.T) {
+	w := CompileWhen(config.WhenConfig{
+		Labels:     map[string][]string{"severity": {"critical"}},
+		FiringOnly: true,
+	})
+	critical := map[string]string{"severity": "critical"}
+
+	cases := []struct {
+		name string
+		msg  alertmanager.WebhookMessage
+		want bool
+	}{
+		{"firing", alertmanager.WebhookMessage{Status: "firing", CommonLabels: critical}, true},
+		{"resolved", alertmanager.WebhookMessage{Status: "resolved", CommonLabels: critical}, false},
+		{"no status, resolved alerts", alertmanager.WebhookMessage{CommonLabels: critical, Alerts: []alertmanager.Alert{{Status: "resolved"}}}, false},
+		{"no status, firing alert", alertmanager.WebhookMessage{CommonLabels: critical, Alerts: []alertmanager.Alert{{Status: "resolved"}, {Status: "firing"}}}, true},
+		{"firing warning", alertmanager.WebhookMessage{Status: "firing", CommonLabels: map[string]string{"severity": "warning"}}, false},
+	}
+	for _, tc := range cases {
+		if got := w.Match(tc.msg); got != tc.want {
+			t.Fatalf("%s: Match=%v want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAllMatch_Continue(t *testing.T) {
+	routes := CompileRoutes([]config.RouteConfig{
+		{Name: "audit", When: config.WhenConfig{Status: []string{"firing"}}, Channels: []string{"audit", "ops"}, Continue: true},
+		{Name: "ops", When: config.WhenConfig{Receiver: []string{"ops"}}, Channels: []string{"ops"}},
+		{Name: "never", When: config.WhenConfig{Receiver: []string{"ops"}}, Channels: []string{"late"}},
+	})
+
+	msg := alertmanager.WebhookMessage{Receiver: "ops", Status: "firing"}
+	matched := AllMatch(routes, msg)
+	if len(matched) != 2 || matched[0].Name != "audit" || matched[1].Name != "ops" {
+		t.Fatalf("matched=%+v", matched)
+	}
+	if got := UnionChannels(matched); len(got) != 2 || got[0] != "audit" || got[1] != "ops" {
+		t.Fatalf("channels=%v want [audit ops]", got)
+	}
+
+	// Without continue the first match wins, as FirstMatch does.
+	routes[0].Continue = false
+	if got := UnionChannels(AllMatch(routes, msg)); len(got) != 2 || got[0] != "audit" {
+		t.Fatalf("channels=%v want [audit ops] from first route only", got)
+	}
+	if got := AllMatch(routes, msg); len(got) != 1 {
+		t.Fatalf("matched=%d want 1", len(got))
+	}
+}
+
+func TestMentionRule_FromAlerts(t *testing.T) {
+	rule := CompileMentionRules([]config.MentionRuleConfig{{
+		Name: "oncall",
+		From: config.MentionFromConfig{UserIdLabel: "oncall_userid", MobileAnnotation: "oncall_mobile"},
+	}})[0]
+
+	msg := alertmanager.WebhookMessage{Alerts: []alertmanager.Alert{
+		{Labels: map[string]string{"oncall_userid": "alice, @bob"}, Annotations: map[string]string{"oncall_mobile": "13800000000"}},
+		{Labels: map[string]string{"oncall_userid": "carol;drop table"}, Annotations: map[string]string{"oncall_mobile": "not-a-phone,+86-13900000000"}},
+		{Labels: map[string]string{"other": "x"}},
+	}}
+	m, invalid := rule.FromAlerts(msg)
+	if got := strings.Join(m.AtUserIds, ","); got != "alice,bob" {
+		t.Fatalf("user ids=%q", got)
+	}
+	if got := strings.Join(m.AtMobiles, ","); got != "13800000000,+86-13900000000" {
+		t.Fatalf("mobiles=%q", got)
+	}
+	if got := strings.Join(invalid, ","); got != "carol;drop table,not-a-phone" {
+		t.Fatalf("invalid=%q", got)
+	}
+
+	m, _ = rule.FromAlerts(alertmanager.WebhookMessage{CommonLabels: map[string]string{"oncall_userid": "dave"}})
+	if got := strings.Join(m.AtUserIds, ","); got != "dave" {
+		t.Fatalf("common label user ids=%q", got)
+	}
+}
+
+func TestWhen_Expr(t *testing.T) {
+	msg := alertmanager.WebhookMessage{
+		Receiver:          "ops",
+		Status:            "firing",
+		GroupLabels:       map[string]string{"cluster": "prod-eu"},
+		CommonLabels:      map[string]string{"severity": "warning", "env": "prod-1"},
+		CommonAnnotations: map[string]string{"team": "db"},
+	}
+
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{`labels.severity == "critical" || (labels.env =~ "prod-.*" && annotations.team != "sandbox")`, true},
+		{`labels.severity == "critical"`, false},
+		{`labels.cluster =~ "prod-.*" && status == "firing"`, true},
+		{`labels.env =~ "prod"`, false},
+		{"labels.env !~ `dev-\\d+`", true},
+		{`receiver in ["ops", "dba"] && labels.severity not in ["info"]`, true},
+		{`!(annotations.team in ["db"])`, false},
+		{`labels.missing == ""`, true},
+		{`labels.severity == "warning" && labels.severity == "critical" || receiver == "ops"`, true},
+	}
+	for _, tc := range cases {
+		w := CompileWhen(config.WhenConfig{Expr: tc.expr})
+		if got := w.Match(msg); got != tc.want {
+			t.Fatalf("%s: Match=%v want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	// The expression is ANDed with the structured conditions.
+	w := CompileWhen(config.WhenConfig{Receiver: []string{"dba"}, Expr: `status == "firing"`})
+	if w.Match(msg) {
+		t.Fatalf("expr overrode receiver")
+	}
+}
@@ -0,0 +1,232 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/dingtalk"
+	"prometheus-dingtalk-hook/internal/template"
+)
+
+// ChannelMessage is what a channel sends for one notification: the rendered
+// template output and the message built from it for each robot.
+type ChannelMessage struct {
+	Output template.Output
+	// Truncated is set when the content was cut to dingtalk.max_message_bytes.
+	Truncated bool
+	Mention   config.MentionConfig
+	Robots    []RobotMessage
+}
+
+// RobotMessage is the message for one robot of a channel. Err is set, and
+// Msg empty, when the robot's msg_type cannot be built.
+type RobotMessage struct {
+	Robot config.RobotConfig
+	Msg   dingtalk.Message
+	Err   error
+}
+
+// BuildMessage renders msg for ch within dingtalk.max_message_bytes and
+// builds the message each of robots is sent, as the alert endpoint sends
+// it. routed tells whether a route matched, see ChannelTemplate. It fails
+// when the template or template.text_title does not render.
+func (rt *Runtime) BuildMessage(ch Channel, msg alertmanager.WebhookMessage, routed bool, robots []config.RobotConfig) (ChannelMessage, error) {
+	out, truncated, err := rt.renderWithinLimit(rt.ChannelTemplate(ch, msg, routed), ch.RenderContext(), msg, rt.Config.DingTalk.MaxMessageBytes)
+	if err != nil {
+		return ChannelMessage{}, err
+	}
+	cm := ChannelMessage{Output: out, Truncated: truncated, Mention: ch.EffectiveMention(msg)}
+
+	var at *dingtalk.At
+	if m := cm.Mention; m.AtAll || len(m.AtMobiles) > 0 || len(m.AtUserIds) > 0 {
+		at = &dingtalk.At{
+			AtMobiles: m.AtMobiles,
+			AtUserIds: m.AtUserIds,
+			IsAtAll:   m.AtAll,
+		}
+	}
+
+	// In a channel that mixes markdown and text robots the template
+	// renders markdown; text robots get it with the formatting stripped.
+	text := out.Content
+	if ch.HasMarkdownRobot() {
+		text = dingtalk.MarkdownToText(out.Content)
+	}
+	if hasTextRobot(robots) {
+		textTitle, err := rt.Renderer.RenderTextTitle(msg, ch.RenderContext())
+		if err != nil {
+			return ChannelMessage{}, fmt.Errorf("text title: %w", err)
+		}
+		if textTitle != "" {
+			text = textTitle + "\n" + text
+		}
+	}
+
+	for _, robot := range robots {
+		msgType := strings.TrimSpace(robot.MsgType)
+		dtMsg := dingtalk.Message{
+			MsgType: msgType,
+			Title:   strings.TrimSpace(robot.Title),
+			At:      at,
+
+			MentionFormat: ch.MentionFormat,
+		}
+		switch msgType {
+		case "markdown":
+			if dtMsg.Title == "" {
+				dtMsg.Title = defaultMarkdownTitle(msg)
+			}
+			dtMsg.Markdown = out.Content
+		case "text":
+			dtMsg.Text = text
+		case "actionCard":
+			if dtMsg.Title == "" {
+				dtMsg.Title = dingtalk.CardTitle(out.Content)
+			}
+			if dtMsg.Title == "" {
+				dtMsg.Title = defaultMarkdownTitle(msg)
+			}
+			dtMsg.ActionCard = &dingtalk.ActionCard{
+				Text:    out.Content,
+				Buttons: CardButtons(out, msg),
+			}
+		case "link":
+			if dtMsg.Title == "" {
+				dtMsg.Title = defaultMarkdownTitle(msg)
+			}
+			messageURL, picURL := LinkURLs(out, msg)
+			dtMsg.Link = &dingtalk.Link{Text: dingtalk.MarkdownToText(out.Content), MessageURL: messageURL, PicURL: picURL}
+		default:
+			cm.Robots = append(cm.Robots, RobotMessage{Robot: robot, Err: errors.New("unsupported msg_type " + msgType)})
+			continue
+		}
+		cm.Robots = append(cm.Robots, RobotMessage{Robot: robot, Msg: dtMsg})
+	}
+	return cm, nil
+}
+
+// hasTextRobot reports whether any of robots sends text messages, the only
+// type that carries template.text_title.
+func hasTextRobot(robots []config.RobotConfig) bool {
+	for _, robot := range robots {
+		if strings.TrimSpace(robot.MsgType) == "text" {
+			return true
+		}
+	}
+	return false
+}
+
+func defaultMarkdownTitle(msg alertmanager.WebhookMessage) string {
+	if msg.CommonAnnotations != nil {
+		if v := strings.TrimSpace(msg.CommonAnnotations["summary"]); v != "" {
+			return v
+		}
+	}
+	if len(msg.Alerts) > 0 && msg.Alerts[0].Annotations != nil {
+		if v := strings.TrimSpace(msg.Alerts[0].Annotations["summary"]); v != "" {
+			return v
+		}
+	}
+	if msg.CommonLabels != nil {
+		if v := strings.TrimSpace(msg.CommonLabels["alertname"]); v != "" {
+			return v
+		}
+	}
+	if len(msg.Alerts) > 0 && msg.Alerts[0].Labels != nil {
+		if v := strings.TrimSpace(msg.Alerts[0].Labels["alertname"]); v != "" {
+			return v
+		}
+	}
+	return "Alertmanager"
+}
+
+// renderWithinLimit renders msg with the named template for channel ch, and
+// keeps the content within maxBytes (0 means no limit). It first drops
+// alerts from the end, re-rendering so the message stays well formed, and
+// only cuts the content on a line boundary when a single alert is still
+// too long. truncated reports whether either happened.
+func (rt *Runtime) renderWithinLimit(name string, ch template.Channel, msg alertmanager.WebhookMessage, maxBytes int) (out template.Output, truncated bool, err error) {
+	out, err = rt.Renderer.RenderChannel(name, msg, ch)
+	if err != nil || maxBytes <= 0 || len(out.Content) <= maxBytes {
+		return out, false, err
+	}
+
+	total := len(msg.Alerts)
+	render := func(n int) (template.Output, error) {
+		part := msg
+		part.Alerts = msg.Alerts[:n]
+		o, err := rt.Renderer.RenderChannel(name, part, ch)
+		if err != nil {
+			return o, err
+		}
+		o.Content += truncationNotice(total - n)
+		return o, nil
+	}
+
+	// Find the most alerts that still fit; n = 0 means none do.
+	var renderErr error
+	n := sort.Search(total, func(i int) bool {
+		if renderErr != nil {
+			return true
+		}
+		o, err := render(i + 1)
+		if err != nil {
+			renderErr = err
+			return true
+		}
+		return len(o.Content) > maxBytes
+	})
+	if renderErr != nil {
+		return template.Output{}, false, renderErr
+	}
+	if n > 0 {
+		out, err = render(n)
+		return out, true, err
+	}
+
+	// Even the first alert alone is too long: keep it and cut its content.
+	notice := "\n\n… (truncated)"
+	if total > 0 {
+		part := msg
+		part.Alerts = msg.Alerts[:1]
+		if out, err = rt.Renderer.RenderChannel(name, part, ch); err != nil {
+			return out, false, err
+		}
+		if total > 1 {
+			notice = truncationNotice(total - 1)
+		}
+	}
+	out.Content = cutContent(out.Content, maxBytes-len(notice)) + notice
+	return out, true, nil
+}
+
+func truncationNotice(omitted int) string {
+	if omitted <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\n… (truncated, %d alerts omitted)", omitted)
+}
+
+// cutContent shortens s to at most maxBytes, at the last line break that
+// fits or, failing that, at a UTF-8 character boundary.
+func cutContent(s string, maxBytes int) string {
+	if maxBytes <= 0 {
+		return ""
+	}
+	if len(s) <= maxBytes {
+		return s
+	}
+	if i := strings.LastIndexByte(s[:maxBytes], '\n'); i > 0 {
+		return strings.TrimRight(s[:i], "\n")
+	}
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end]
+}
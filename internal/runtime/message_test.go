@@ -0,0 +1,30 @@
+package runtime
+
+import (
+	"testing"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+)
+
+func TestCutContent(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"line one\nline two", 12, "line one"},
+		{"告警告警", 7, "告警"},
+		{"abc", 0, ""},
+	} {
+		if got := cutContent(tc.in, tc.max); got != tc.want {
+			t.Fatalf("cutContent(%q, %d)=%q want %q", tc.in, tc.max, got, tc.want)
+		}
+	}
+}
+
+func TestDefaultMarkdownTitle_Fallback(t *testing.T) {
+	if got := defaultMarkdownTitle(alertmanager.WebhookMessage{Alerts: []alertmanager.Alert{{}}}); got != "Alertmanager" {
+		t.Fatalf("title=%q", got)
+	}
+}
@@ -0,0 +1,72 @@
+package runtime
+
+import (
+	"sort"
+	"strings"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/config"
+)
+
+// Priority marks alerts as important by the value of a label. A nil Priority
+// treats no alert as important.
+type Priority struct {
+	label     string
+	important map[string]struct{}
+}
+
+func compilePriority(cfg config.PriorityConfig) *Priority {
+	if len(cfg.Important) == 0 {
+		return nil
+	}
+	p := &Priority{
+		label:     strings.TrimSpace(cfg.Label),
+		important: make(map[string]struct{}, len(cfg.Important)),
+	}
+	for _, v := range cfg.Important {
+		p.important[strings.ToLower(strings.TrimSpace(v))] = struct{}{}
+	}
+	return p
+}
+
+// Important reports whether a carries an important priority, falling back
+// to the common labels of its message.
+func (p *Priority) Important(a alertmanager.Alert, common map[string]string) bool {
+	if p == nil {
+		return false
+	}
+	v := strings.TrimSpace(a.Labels[p.label])
+	if v == "" {
+		v = strings.TrimSpace(common[p.label])
+	}
+	_, ok := p.important[strings.ToLower(v)]
+	return ok
+}
+
+// Escalate reports whether any firing alert in msg is important.
+func (p *Priority) Escalate(msg alertmanager.WebhookMessage) bool {
+	if p == nil {
+		return false
+	}
+	for _, a := range msg.Alerts {
+		if strings.EqualFold(strings.TrimSpace(a.Status), "firing") && p.Important(a, msg.CommonLabels) {
+			return true
+		}
+	}
+	return false
+}
+
+// Order returns msg with important alerts moved to the front, keeping the
+// original order otherwise. msg itself is not modified.
+func (p *Priority) Order(msg alertmanager.WebhookMessage) alertmanager.WebhookMessage {
+	if p == nil || len(msg.Alerts) < 2 {
+		return msg
+	}
+	alerts := make([]alertmanager.Alert, len(msg.Alerts))
+	copy(alerts, msg.Alerts)
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return p.Important(alerts[i], msg.CommonLabels) && !p.Important(alerts[j], msg.CommonLabels)
+	})
+	msg.Alerts = alerts
+	return msg
+}
@@ -0,0 +1,64 @@
+package runtime
+
+import (
+	"testing"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/config"
+)
+
+func TestPriority_EscalatesAndOrders(t *testing.T) {
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Robots:   []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+			Priority: config.PriorityConfig{Label: "priority", Important: []string{"P0"}},
+		},
+	}
+	rt, err := Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	ch := rt.Channels["default"]
+
+	low := alertmanager.Alert{Status: "firing", Labels: map[string]string{"alertname": "low", "priority": "p2"}}
+	high := alertmanager.Alert{Status: "firing", Labels: map[string]string{"alertname": "high", "priority": "p0"}}
+	resolvedHigh := high
+	resolvedHigh.Status = "resolved"
+
+	if ch.EffectiveMention(alertmanager.WebhookMessage{Alerts: []alertmanager.Alert{low}}).AtAll {
+		t.Fatalf("low priority should not @all")
+	}
+	if !ch.EffectiveMention(alertmanager.WebhookMessage{Alerts: []alertmanager.Alert{low, high}}).AtAll {
+		t.Fatalf("firing p0 should @all")
+	}
+	if ch.EffectiveMention(alertmanager.WebhookMessage{Alerts: []alertmanager.Alert{resolvedHigh}}).AtAll {
+		t.Fatalf("resolved p0 should not @all")
+	}
+	common := alertmanager.WebhookMessage{
+		CommonLabels: map[string]string{"priority": "P0"},
+		Alerts:       []alertmanager.Alert{{Status: "firing"}},
+	}
+	if !ch.EffectiveMention(common).AtAll {
+		t.Fatalf("common label p0 should @all")
+	}
+
+	msg := alertmanager.WebhookMessage{Alerts: []alertmanager.Alert{low, high}}
+	ordered := rt.Priority.Order(msg)
+	if ordered.Alerts[0].Labels["alertname"] != "high" || ordered.Alerts[1].Labels["alertname"] != "low" {
+		t.Fatalf("order=%v", ordered.Alerts)
+	}
+	if msg.Alerts[0].Labels["alertname"] != "low" {
+		t.Fatalf("Order modified its input")
+	}
+}
+
+func TestPriority_DisabledWithoutImportantValues(t *testing.T) {
+	if p := compilePriority(config.PriorityConfig{Label: "priority"}); p != nil {
+		t.Fatalf("priority=%+v want nil", p)
+	}
+	var p *Priority
+	if p.Escalate(alertmanager.WebhookMessage{Alerts: []alertmanager.Alert{{Status: "firing", Labels: map[string]string{"priority": "p0"}}}}) {
+		t.Fatalf("nil priority should not escalate")
+	}
+}
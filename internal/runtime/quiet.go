@@ -0,0 +1,110 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/config"
+)
+
+// QuietHours mutes notifications below a severity threshold during daily
+// windows. A nil QuietHours never mutes.
+type QuietHours struct {
+	windows []clockWindow
+	loc     *time.Location
+	minRank int
+
+	// now is time.Now; tests replace it.
+	now func() time.Time
+}
+
+type clockWindow struct {
+	start, end int // minutes since midnight, end exclusive
+}
+
+func (w clockWindow) contains(minute int) bool {
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end
+	}
+	// Spans midnight.
+	return minute >= w.start || minute < w.end
+}
+
+func compileQuietHours(cfg config.QuietHoursConfig) (*QuietHours, error) {
+	if len(cfg.Ranges) == 0 {
+		return nil, nil
+	}
+	q := &QuietHours{
+		loc:     time.Local,
+		minRank: config.SeverityRank[strings.ToLower(strings.TrimSpace(cfg.MinSeverity))],
+		now:     time.Now,
+	}
+	if tz := strings.TrimSpace(cfg.Timezone); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("dingtalk.quiet_hours.timezone: %w", err)
+		}
+		q.loc = loc
+	}
+	for _, r := range cfg.Ranges {
+		start, end, err := config.ParseClockRange(r)
+		if err != nil {
+			return nil, fmt.Errorf("dingtalk.quiet_hours.ranges: %w", err)
+		}
+		q.windows = append(q.windows, clockWindow{start: start, end: end})
+	}
+	return q, nil
+}
+
+// Active reports whether t falls in a quiet window.
+func (q *QuietHours) Active(t time.Time) bool {
+	if q == nil {
+		return false
+	}
+	t = t.In(q.loc)
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range q.windows {
+		if w.contains(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// Suppress reports whether msg should be muted now: quiet hours are active
+// and its highest alert severity is below the threshold. Critical alerts
+// always pass.
+func (q *QuietHours) Suppress(msg alertmanager.WebhookMessage) bool {
+	if q == nil || !q.Active(q.now()) {
+		return false
+	}
+	rank := messageSeverityRank(msg)
+	return rank < q.minRank && rank < config.SeverityRank["critical"]
+}
+
+// messageSeverityRank is the highest severity rank among firing alerts, or
+// among all alerts when none is firing.
+func messageSeverityRank(msg alertmanager.WebhookMessage) int {
+	best := 0
+	anyFiring := false
+	for _, a := range msg.Alerts {
+		if strings.EqualFold(strings.TrimSpace(a.Status), "firing") {
+			anyFiring = true
+			break
+		}
+	}
+	for _, a := range msg.Alerts {
+		if anyFiring && !strings.EqualFold(strings.TrimSpace(a.Status), "firing") {
+			continue
+		}
+		if rank := config.SeverityRank[alertSeverity(a, msg.CommonLabels)]; rank > best {
+			best = rank
+		}
+	}
+	if len(msg.Alerts) == 0 {
+		best = config.SeverityRank[alertSeverity(alertmanager.Alert{}, msg.CommonLabels)]
+	}
+	return best
+}
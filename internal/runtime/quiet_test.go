@@ -0,0 +1,95 @@
+package runtime
+
+import (
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/config"
+)
+
+func TestQuietHours_Boundaries(t *testing.T) {
+	q, err := compileQuietHours(config.QuietHoursConfig{
+		Ranges:      []string{"22:00-08:00", "12:00-12:30"},
+		Timezone:    "Asia/Shanghai",
+		MinSeverity: "error",
+	})
+	if err != nil {
+		t.Fatalf("compileQuietHours: %v", err)
+	}
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+
+	tests := []struct {
+		clock string
+		want  bool
+	}{
+		{"21:59", false},
+		{"22:00", true},
+		{"00:00", true},
+		{"07:59", true},
+		{"08:00", false},
+		{"11:59", false},
+		{"12:00", true},
+		{"12:29", true},
+		{"12:30", false},
+	}
+	for _, tt := range tests {
+		c, _ := time.Parse("15:04", tt.clock)
+		at := time.Date(2024, 3, 1, c.Hour(), c.Minute(), 0, 0, loc)
+		if got := q.Active(at); got != tt.want {
+			t.Fatalf("Active(%s)=%v want %v", tt.clock, got, tt.want)
+		}
+		// The same instant seen from another zone is evaluated in the configured one.
+		if got := q.Active(at.UTC()); got != tt.want {
+			t.Fatalf("Active(%s UTC)=%v want %v", tt.clock, got, tt.want)
+		}
+	}
+}
+
+func TestQuietHours_Suppress(t *testing.T) {
+	q, err := compileQuietHours(config.QuietHoursConfig{
+		Ranges:      []string{"22:00-08:00"},
+		Timezone:    "UTC",
+		MinSeverity: "error",
+	})
+	if err != nil {
+		t.Fatalf("compileQuietHours: %v", err)
+	}
+	night := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	day := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	msg := func(sevs ...string) alertmanager.WebhookMessage {
+		var m alertmanager.WebhookMessage
+		for _, s := range sevs {
+			m.Alerts = append(m.Alerts, alertWithSeverity("firing", s))
+		}
+		return m
+	}
+
+	q.now = func() time.Time { return night }
+	if !q.Suppress(msg("warning")) {
+		t.Fatalf("warning should be muted at night")
+	}
+	if q.Suppress(msg("warning", "error")) {
+		t.Fatalf("error meets min_severity and should pass")
+	}
+	if q.Suppress(msg("critical")) {
+		t.Fatalf("critical should always pass")
+	}
+	if !q.Suppress(msg("")) {
+		t.Fatalf("alerts without severity should be muted")
+	}
+
+	q.now = func() time.Time { return day }
+	if q.Suppress(msg("info")) {
+		t.Fatalf("nothing should be muted outside quiet hours")
+	}
+
+	var off *QuietHours
+	if off.Suppress(msg("info")) {
+		t.Fatalf("nil QuietHours should not mute")
+	}
+}
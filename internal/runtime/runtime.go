@@ -2,25 +2,50 @@
 package runtime
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log/slog"
-	"path/filepath"
+	"net/netip"
+	"os"
 	"strings"
 	"time"
 
 	"prometheus-dingtalk-hook/internal/alertmanager"
 	"prometheus-dingtalk-hook/internal/config"
 	"prometheus-dingtalk-hook/internal/dingtalk"
+	"prometheus-dingtalk-hook/internal/forward"
 	"prometheus-dingtalk-hook/internal/router"
 	"prometheus-dingtalk-hook/internal/template"
 )
 
 type Channel struct {
-	Name         string
-	Robots       []config.RobotConfig
-	Template     string
-	Mention      config.MentionConfig
-	MentionRules []router.MentionRule
+	Name             string
+	Robots           []config.RobotConfig
+	Template         string
+	Mention          config.MentionConfig
+	MentionRules     []router.MentionRule
+	SeverityMentions map[string]config.MentionConfig
+	MentionFormat    string
+	// MaxMentions caps the number of user ids and mobiles mentioned; 0 means no cap.
+	MaxMentions int
+	// AtAllOnCount forces @all above this many firing alerts; 0 disables.
+	AtAllOnCount int
+	AtomicRetry  config.AtomicRetryConfig
+	// SendResolved is false when the channel only wants firing alerts.
+	SendResolved bool
+	// GroupBy splits the alerts into template groups by these labels.
+	GroupBy []string
+	// Data is exposed to templates as .ChannelData.
+	Data map[string]string
+
+	priority *Priority
+	logger   *slog.Logger
+}
+
+// RenderContext returns the channel settings templates are rendered with.
+func (c Channel) RenderContext() template.Channel {
+	return template.Channel{GroupBy: c.GroupBy, Data: c.Data}
 }
 
 func (c Channel) EffectiveMention(msg alertmanager.WebhookMessage) config.MentionConfig {
@@ -28,9 +53,120 @@ func (c Channel) EffectiveMention(msg alertmanager.WebhookMessage) config.Mentio
 	for _, rule := range c.MentionRules {
 		if rule.When.Match(msg) {
 			out = router.MergeMention(out, rule.Mention)
+			from, invalid := rule.FromAlerts(msg)
+			if len(invalid) > 0 && c.logger != nil {
+				c.logger.Warn("invalid mention values skipped", "channel", c.Name, "rule", rule.Name, "values", invalid)
+			}
+			out = router.MergeMention(out, from)
+		}
+	}
+	if m, ok := c.severityMention(msg); ok {
+		out = router.MergeMention(out, m)
+	}
+	if c.priority.Escalate(msg) {
+		out.AtAll = true
+	}
+	if c.AtAllOnCount > 0 && firingCount(msg) > c.AtAllOnCount {
+		out.AtAll = true
+	}
+	return c.capMentions(normalizeMention(out))
+}
+
+func firingCount(msg alertmanager.WebhookMessage) int {
+	n := 0
+	for _, a := range msg.Alerts {
+		if strings.EqualFold(a.Status, "firing") {
+			n++
+		}
+	}
+	return n
+}
+
+// SkipsResolved reports whether c, with send_resolved off, ignores msg
+// because none of its alerts is firing. A group that mixes firing and
+// resolved alerts is still sent.
+func (c Channel) SkipsResolved(msg alertmanager.WebhookMessage) bool {
+	if c.SendResolved {
+		return false
+	}
+	if len(msg.Alerts) == 0 {
+		return strings.EqualFold(msg.Status, "resolved")
+	}
+	for _, a := range msg.Alerts {
+		if !strings.EqualFold(a.Status, "resolved") {
+			return false
 		}
 	}
-	return normalizeMention(out)
+	return true
+}
+
+// HasMarkdownRobot reports whether any robot of c renders markdown, in which
+// case the channel's template is taken to produce markdown.
+func (c Channel) HasMarkdownRobot() bool {
+	for _, robot := range c.Robots {
+		switch strings.TrimSpace(robot.MsgType) {
+		case "markdown", "actionCard":
+			return true
+		}
+	}
+	return false
+}
+
+// capMentions keeps at most MaxMentions targets, user ids first, matching the
+// order the @ tokens are rendered in.
+func (c Channel) capMentions(m config.MentionConfig) config.MentionConfig {
+	total := len(m.AtUserIds) + len(m.AtMobiles)
+	if c.MaxMentions <= 0 || m.AtAll || total <= c.MaxMentions {
+		return m
+	}
+	if c.logger != nil {
+		c.logger.Warn("mentions capped", "channel", c.Name, "max", c.MaxMentions, "dropped", total-c.MaxMentions)
+	}
+	if len(m.AtUserIds) >= c.MaxMentions {
+		m.AtUserIds = m.AtUserIds[:c.MaxMentions]
+		m.AtMobiles = nil
+		return m
+	}
+	m.AtMobiles = m.AtMobiles[:c.MaxMentions-len(m.AtUserIds)]
+	return m
+}
+
+// severityMention returns the mention mapped to the highest severity among
+// firing alerts that has an entry in SeverityMentions.
+func (c Channel) severityMention(msg alertmanager.WebhookMessage) (config.MentionConfig, bool) {
+	if len(c.SeverityMentions) == 0 {
+		return config.MentionConfig{}, false
+	}
+
+	best := -1
+	var out config.MentionConfig
+	for _, a := range msg.Alerts {
+		if !strings.EqualFold(strings.TrimSpace(a.Status), "firing") {
+			continue
+		}
+		sev := alertSeverity(a, msg.CommonLabels)
+		m, ok := c.SeverityMentions[sev]
+		if !ok {
+			continue
+		}
+		if rank := config.SeverityRank[sev]; rank > best {
+			best = rank
+			out = m
+		}
+	}
+	return out, best >= 0
+}
+
+func alertSeverity(a alertmanager.Alert, common map[string]string) string {
+	for _, key := range []string{"severity", "level"} {
+		if v := strings.TrimSpace(a.Labels[key]); v != "" {
+			return strings.ToLower(v)
+		}
+		if v := strings.TrimSpace(common[key]); v != "" {
+			return strings.ToLower(v)
+		}
+	}
+	return ""
 }
 
 type Runtime struct {
@@ -40,25 +176,63 @@ type Runtime struct {
 	Config   *config.Config
 	Renderer *template.Renderer
 	DingTalk *dingtalk.Client
+	// Forward posts raw payloads to forward.urls and server.mirror_url; nil
+	// when none are set.
+	Forward *forward.Client
+	// ChannelLimiter holds the per-channel rate limits, keyed by channel name.
+	ChannelLimiter *dingtalk.Limiter
+	// QuietHours is nil when dingtalk.quiet_hours has no ranges.
+	QuietHours *QuietHours
+	// Priority is nil when dingtalk.priority.important is empty.
+	Priority *Priority
 
 	Robots   map[string]config.RobotConfig
 	Channels map[string]Channel
 	Routes   []router.Route
 
+	AllowedCIDRs   []netip.Prefix
+	TrustedProxies []netip.Prefix
+
+	// TLSCertificate and ClientCAs are loaded from server.tls_* files; nil when TLS is off.
+	TLSCertificate *tls.Certificate
+	ClientCAs      *x509.CertPool
+	// TLSMinVersion and TLSCipherSuites are server.tls_min_version and
+	// tls_cipher_suites; nil suites means Go's defaults.
+	TLSMinVersion   uint16
+	TLSCipherSuites []uint16
+
+	// RobotDedup is set when a robot has its own dedup_window, in which case
+	// notifications are deduplicated per robot instead of as a whole.
+	RobotDedup bool
+
+	// Warnings lists robots no channel uses and channels no route sends
+	// to, see config.Config.Warnings, and template name conflicts resolved
+	// by template.on_name_conflict last_wins. They never fail a load.
+	Warnings []string
+
 	LoadedAt time.Time
 }
 
+// ForceDryRun turns on dingtalk.dry_run for every runtime built, including on
+// reload. It is set once at startup from the -dry-run flag.
+var ForceDryRun bool
+
 func LoadFromFile(logger *slog.Logger, configPath string) (*Runtime, error) {
 	cfg, err := config.Load(configPath)
 	if err != nil {
 		return nil, err
 	}
 
-	baseDir := filepath.Dir(configPath)
-	rt, err := Build(logger, configPath, baseDir, cfg)
+	rt, err := Build(logger, configPath, config.BaseDir(configPath), cfg)
 	if err != nil {
 		return nil, err
 	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	for _, w := range rt.Warnings {
+		logger.Warn("config warning", "warning", w)
+	}
 	return rt, nil
 }
 
@@ -72,10 +246,26 @@ func Build(logger *slog.Logger, configPath, baseDir string, cfg *config.Config)
 		return nil, err
 	}
 
-	dt := dingtalk.NewClient(cfg.DingTalk.Timeout.Duration())
+	dt, err := dingtalk.NewClientWithOptions(dingtalk.ClientOptions{
+		Timeout:            cfg.DingTalk.Timeout.Duration(),
+		ProxyURL:           cfg.DingTalk.Proxy.URL,
+		InsecureSkipVerify: cfg.DingTalk.Proxy.InsecureSkipVerify,
+		Logger:             logger,
+		DryRun:             cfg.DingTalk.DryRun || ForceDryRun,
+	})
+	if err != nil {
+		return nil, err
+	}
 	robots := cfg.DingTalk.RobotsByName()
+	for _, robot := range robots {
+		dt.SetRateLimit(robot.Webhook, dingtalk.RateLimit{
+			PerMinute: robot.RateLimit.PerMinute,
+			Wait:      strings.TrimSpace(robot.RateLimit.Mode) == "wait",
+		})
+	}
 
-	channels, err := compileChannels(cfg, robots, cfg.DingTalk.Channels)
+	priority := compilePriority(cfg.DingTalk.Priority)
+	channels, err := compileChannels(logger, cfg, priority, robots, cfg.DingTalk.Channels)
 	if err != nil {
 		return nil, err
 	}
@@ -85,14 +275,54 @@ func Build(logger *slog.Logger, configPath, baseDir string, cfg *config.Config)
 			tplName = renderer.DefaultName()
 		}
 		if !renderer.HasTemplate(tplName) {
-			return nil, fmt.Errorf("channel %q references unknown template %q", name, tplName)
+			return nil, config.FieldErrorf("dingtalk.channels["+name+"].template", "references unknown template %q", tplName)
 		}
 	}
 
+	channelLimiter := dingtalk.NewLimiter()
+	for _, ch := range cfg.DingTalk.Channels {
+		channelLimiter.Set(strings.TrimSpace(ch.Name), dingtalk.RateLimit{
+			PerMinute: ch.RateLimit.PerMinute,
+			Wait:      strings.TrimSpace(ch.RateLimit.Mode) == "wait",
+		})
+	}
+
+	quietHours, err := compileQuietHours(cfg.DingTalk.QuietHours)
+	if err != nil {
+		return nil, err
+	}
+
 	routes := router.CompileRoutes(cfg.DingTalk.Routes)
 
+	var fwd *forward.Client
+	if len(cfg.ForwardURLs()) > 0 {
+		fwd = forward.NewClient(cfg.Forward.Timeout.Duration(), cfg.Forward.MaxPending)
+	}
+
+	allowed, err := config.ParsePrefixes(cfg.Server.AllowedCIDRs)
+	if err != nil {
+		return nil, config.FieldErrorf("server.allowed_cidrs", "is invalid: %w", err)
+	}
+	trusted, err := config.ParsePrefixes(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, config.FieldErrorf("server.trusted_proxies", "is invalid: %w", err)
+	}
+
+	cert, clientCAs, err := loadTLS(cfg.Server)
+	if err != nil {
+		return nil, err
+	}
+	tlsMinVersion, err := config.ParseTLSVersion(cfg.Server.TLSMinVersion)
+	if err != nil {
+		return nil, config.FieldErrorf("server.tls_min_version", "is invalid: %w", err)
+	}
+	tlsCipherSuites, err := config.ParseCipherSuites(cfg.Server.TLSCipherSuites)
+	if err != nil {
+		return nil, config.FieldErrorf("server.tls_cipher_suites", "is invalid: %w", err)
+	}
+
 	if _, ok := channels["default"]; !ok {
-		return nil, fmt.Errorf("default channel is required")
+		return nil, config.FieldErrorf("dingtalk.channels.default", "is required")
 	}
 
 	return &Runtime{
@@ -101,19 +331,99 @@ func Build(logger *slog.Logger, configPath, baseDir string, cfg *config.Config)
 		Config:     cfg,
 		Renderer:   renderer,
 		DingTalk:   dt,
+		Forward:    fwd,
 		Robots:     robots,
 		Channels:   channels,
 		Routes:     routes,
 		LoadedAt:   time.Now(),
+
+		ChannelLimiter: channelLimiter,
+		QuietHours:     quietHours,
+		Priority:       priority,
+
+		AllowedCIDRs:   allowed,
+		TrustedProxies: trusted,
+
+		TLSCertificate:  cert,
+		ClientCAs:       clientCAs,
+		TLSMinVersion:   tlsMinVersion,
+		TLSCipherSuites: tlsCipherSuites,
+
+		RobotDedup: robotDedup(cfg.DingTalk.Robots),
+		Warnings:   append(cfg.Warnings(), renderer.NameConflicts()...),
 	}, nil
 }
 
-func compileChannels(cfg *config.Config, robots map[string]config.RobotConfig, channelsCfg []config.ChannelConfig) (map[string]Channel, error) {
+func robotDedup(robots []config.RobotConfig) bool {
+	for _, r := range robots {
+		if r.DedupWindow != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// DedupWindow returns the dedup window of robot: its own dedup_window when
+// set, otherwise dingtalk.dedup_window.
+func (rt *Runtime) DedupWindow(robot config.RobotConfig) time.Duration {
+	if robot.DedupWindow != nil {
+		return robot.DedupWindow.Duration()
+	}
+	return rt.Config.DingTalk.DedupWindow.Duration()
+}
+
+// MaxDedupWindow returns the longest dedup window of any robot, which is how
+// long the dedup cache has to remember a notification.
+func (rt *Runtime) MaxDedupWindow() time.Duration {
+	max := rt.Config.DingTalk.DedupWindow.Duration()
+	for _, r := range rt.Config.DingTalk.Robots {
+		if w := rt.DedupWindow(r); w > max {
+			max = w
+		}
+	}
+	return max
+}
+
+func loadTLS(cfg config.ServerConfig) (*tls.Certificate, *x509.CertPool, error) {
+	if strings.TrimSpace(cfg.TLSCertFile) == "" {
+		return nil, nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load tls certificate: %w", err)
+	}
+	if strings.TrimSpace(cfg.ClientCAFile) == "" {
+		return &cert, nil, nil
+	}
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read client ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, nil, fmt.Errorf("client ca %s contains no certificates", cfg.ClientCAFile)
+	}
+	return &cert, pool, nil
+}
+
+// Inherit carries long-lived state such as rate limit budgets over from prev,
+// the runtime this one replaces.
+func (rt *Runtime) Inherit(prev *Runtime) {
+	if rt == nil || prev == nil {
+		return
+	}
+	rt.DingTalk.InheritRateLimits(prev.DingTalk)
+	if rt.ChannelLimiter != nil {
+		rt.ChannelLimiter.Inherit(prev.ChannelLimiter)
+	}
+}
+
+func compileChannels(logger *slog.Logger, cfg *config.Config, priority *Priority, robots map[string]config.RobotConfig, channelsCfg []config.ChannelConfig) (map[string]Channel, error) {
 	out := make(map[string]Channel, len(channelsCfg))
 	for _, ch := range channelsCfg {
 		name := strings.TrimSpace(ch.Name)
 		if name == "" {
-			return nil, fmt.Errorf("channel name is empty")
+			return nil, config.FieldErrorf("dingtalk.channels[].name", "must not be empty")
 		}
 
 		tplName := strings.TrimSpace(ch.Template)
@@ -121,14 +431,18 @@ func compileChannels(cfg *config.Config, robots map[string]config.RobotConfig, c
 			tplName = "default"
 		}
 		if tplName != "" && !config.ValidTemplateName(tplName) {
-			return nil, fmt.Errorf("channel %q has invalid template name %q", name, tplName)
+			return nil, config.FieldErrorf("dingtalk.channels["+name+"].template", "has invalid template name %q", tplName)
 		}
 
 		robotCfgs := make([]config.RobotConfig, 0, len(ch.Robots))
 		for _, r := range ch.Robots {
 			robot, ok := robots[r]
 			if !ok {
-				return nil, fmt.Errorf("channel %q references unknown robot %q", name, r)
+				return nil, config.FieldErrorf("dingtalk.channels["+name+"].robots", "references unknown robot %q", r)
+			}
+			// The channel's msg_type applies to its copy of the robot only.
+			if msgType := strings.TrimSpace(ch.MsgType); msgType != "" {
+				robot.MsgType = msgType
 			}
 			robotCfgs = append(robotCfgs, robot)
 		}
@@ -139,17 +453,98 @@ func compileChannels(cfg *config.Config, robots map[string]config.RobotConfig, c
 			rules[i].Mention = normalizeMention(rules[i].Mention)
 		}
 
+		var severityMentions map[string]config.MentionConfig
+		if len(ch.SeverityMentions) > 0 {
+			severityMentions = make(map[string]config.MentionConfig, len(ch.SeverityMentions))
+			for sev, m := range ch.SeverityMentions {
+				severityMentions[strings.ToLower(strings.TrimSpace(sev))] = normalizeMention(m)
+			}
+		}
+
+		mentionFormat := ch.MentionFormat
+		if strings.TrimSpace(mentionFormat) == "" {
+			mentionFormat = cfg.DingTalk.MentionFormat
+		}
+
 		out[name] = Channel{
-			Name:         name,
-			Robots:       robotCfgs,
-			Template:     tplName,
-			Mention:      mention,
-			MentionRules: rules,
+			Name:             name,
+			Robots:           robotCfgs,
+			Template:         tplName,
+			Mention:          mention,
+			MentionRules:     rules,
+			SeverityMentions: severityMentions,
+			MentionFormat:    mentionFormat,
+			MaxMentions:      cfg.DingTalk.MaxMentions,
+			AtAllOnCount:     cfg.DingTalk.AtAllOnCount,
+			AtomicRetry:      ch.AtomicRetry,
+			SendResolved:     ch.SendResolvedEnabled(),
+			GroupBy:          ch.GroupBy,
+			Data:             ch.Data,
+			priority:         priority,
+			logger:           logger,
 		}
 	}
 	return out, nil
 }
 
+// ChannelTemplate returns the template to render ch with. A channel selected
+// by a route always uses its own template; for the fallback channel,
+// template.by_receiver prefers a template named after the receiver.
+func (rt *Runtime) ChannelTemplate(ch Channel, msg alertmanager.WebhookMessage, routed bool) string {
+	if routed || !rt.Config.Template.ByReceiver {
+		return ch.Template
+	}
+	name := strings.TrimSpace(msg.Receiver)
+	if config.ValidTemplateName(name) && rt.Renderer.HasTemplate(name) {
+		return name
+	}
+	return ch.Template
+}
+
+// Target returns the send target for a configured robot.
+func Target(robot config.RobotConfig) dingtalk.Target {
+	return dingtalk.Target{
+		Webhook:         robot.Webhook,
+		Secret:          robot.Secret.Primary(),
+		FallbackSecrets: robot.Secret.Fallbacks(),
+		Params:          robot.WebhookParams,
+		Keyword:         robot.Keyword,
+		AppendKeyword:   robot.KeywordAutoAppend,
+		Timeout:         robot.Timeout.Duration(),
+		SkipSign:        !robot.SignEnabled(),
+	}
+}
+
+// CardButtons converts template buttons for an actionCard message, falling
+// back to a link to the Alertmanager UI when the template declares none.
+func CardButtons(out template.Output, msg alertmanager.WebhookMessage) []dingtalk.ActionCardButton {
+	buttons := make([]dingtalk.ActionCardButton, 0, len(out.Buttons)+1)
+	for _, b := range out.Buttons {
+		buttons = append(buttons, dingtalk.ActionCardButton{Title: b.Title, ActionURL: b.URL})
+	}
+	if len(buttons) == 0 && strings.TrimSpace(msg.ExternalURL) != "" {
+		buttons = append(buttons, dingtalk.ActionCardButton{Title: "Alertmanager", ActionURL: strings.TrimSpace(msg.ExternalURL)})
+	}
+	return buttons
+}
+
+// LinkURLs returns the message and picture URLs of a link message: the
+// template's link directive, else the first generatorURL among the alerts, else the
+// Alertmanager externalURL.
+func LinkURLs(out template.Output, msg alertmanager.WebhookMessage) (messageURL, picURL string) {
+	messageURL = out.LinkURL
+	for _, a := range msg.Alerts {
+		if messageURL != "" {
+			break
+		}
+		messageURL = strings.TrimSpace(a.GeneratorURL)
+	}
+	if messageURL == "" {
+		messageURL = strings.TrimSpace(msg.ExternalURL)
+	}
+	return messageURL, out.PicURL
+}
+
 func normalizeMention(m config.MentionConfig) config.MentionConfig {
 	if m.AtAll {
 		m.AtMobiles = nil
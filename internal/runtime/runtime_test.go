@@ -0,0 +1,368 @@
+package runtime
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/config"
+)
+
+func severityChannel(t *testing.T) Channel {
+	t.Helper()
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Robots: []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{
+				Name:    "default",
+				Robots:  []string{"r1"},
+				Mention: config.MentionConfig{AtUserIds: []string{"owner"}},
+				SeverityMentions: map[string]config.MentionConfig{
+					"warning":  {AtUserIds: []string{"oncall"}},
+					"Critical": {AtAll: true},
+				},
+			}},
+		},
+	}
+	rt, err := Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	return rt.Channels["default"]
+}
+
+func alertWithSeverity(status, severity string) alertmanager.Alert {
+	return alertmanager.Alert{Status: status, Labels: map[string]string{"severity": severity}}
+}
+
+func TestEffectiveMention_SeverityMentions(t *testing.T) {
+	ch := severityChannel(t)
+
+	tests := []struct {
+		name      string
+		alerts    []alertmanager.Alert
+		wantAtAll bool
+		wantUsers []string
+	}{
+		{
+			name:      "info is unmapped",
+			alerts:    []alertmanager.Alert{alertWithSeverity("firing", "info")},
+			wantUsers: []string{"owner"},
+		},
+		{
+			name:      "warning",
+			alerts:    []alertmanager.Alert{alertWithSeverity("firing", "warning")},
+			wantUsers: []string{"owner", "oncall"},
+		},
+		{
+			name: "critical wins over warning",
+			alerts: []alertmanager.Alert{
+				alertWithSeverity("firing", "warning"),
+				alertWithSeverity("firing", "critical"),
+			},
+			wantAtAll: true,
+		},
+		{
+			name: "resolved critical is ignored",
+			alerts: []alertmanager.Alert{
+				alertWithSeverity("resolved", "critical"),
+				alertWithSeverity("firing", "warning"),
+			},
+			wantUsers: []string{"owner", "oncall"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ch.EffectiveMention(alertmanager.WebhookMessage{Status: "firing", Alerts: tt.alerts})
+			if got.AtAll != tt.wantAtAll {
+				t.Fatalf("AtAll=%v want %v", got.AtAll, tt.wantAtAll)
+			}
+			if tt.wantAtAll {
+				return
+			}
+			if len(got.AtUserIds) != len(tt.wantUsers) {
+				t.Fatalf("AtUserIds=%v want %v", got.AtUserIds, tt.wantUsers)
+			}
+			for i := range tt.wantUsers {
+				if got.AtUserIds[i] != tt.wantUsers[i] {
+					t.Fatalf("AtUserIds=%v want %v", got.AtUserIds, tt.wantUsers)
+				}
+			}
+		})
+	}
+}
+
+func TestEffectiveMention_MaxMentions(t *testing.T) {
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			MaxMentions: 3,
+			Robots:      []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{
+				Name:   "default",
+				Robots: []string{"r1"},
+				Mention: config.MentionConfig{
+					AtUserIds: []string{"u1", "u2"},
+					AtMobiles: []string{"m1", "m2", "m3"},
+				},
+				SeverityMentions: map[string]config.MentionConfig{
+					"critical": {AtAll: true},
+				},
+			}},
+		},
+	}
+	rt, err := Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	ch := rt.Channels["default"]
+
+	got := ch.EffectiveMention(alertmanager.WebhookMessage{})
+	if len(got.AtUserIds) != 2 || len(got.AtMobiles) != 1 || got.AtMobiles[0] != "m1" {
+		t.Fatalf("mention=%+v want 2 user ids and mobile m1", got)
+	}
+
+	got = ch.EffectiveMention(alertmanager.WebhookMessage{Alerts: []alertmanager.Alert{alertWithSeverity("firing", "critical")}})
+	if !got.AtAll {
+		t.Fatalf("AtAll=false want true")
+	}
+}
+
+func TestCompileChannels_MsgTypeOverride(t *testing.T) {
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Robots: []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{
+				{Name: "default", Robots: []string{"r1"}},
+				{Name: "plain", Robots: []string{"r1"}, MsgType: "text"},
+			},
+		},
+	}
+	rt, err := Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if got := rt.Channels["default"].Robots[0].MsgType; got != "markdown" {
+		t.Fatalf("default msg_type=%q want robot's markdown", got)
+	}
+	if got := rt.Channels["plain"].Robots[0].MsgType; got != "text" {
+		t.Fatalf("plain msg_type=%q want text", got)
+	}
+	if rt.Channels["plain"].HasMarkdownRobot() {
+		t.Fatalf("plain channel should not count as markdown")
+	}
+	if cfg.DingTalk.Robots[0].MsgType != "markdown" {
+		t.Fatalf("override leaked into robot config")
+	}
+}
+
+func TestEffectiveMention_AtAllOnCount(t *testing.T) {
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			AtAllOnCount: 2,
+			Robots:       []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{
+				Name:    "default",
+				Robots:  []string{"r1"},
+				Mention: config.MentionConfig{AtUserIds: []string{"owner"}},
+			}},
+		},
+	}
+	rt, err := Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	ch := rt.Channels["default"]
+
+	alerts := func(statuses ...string) alertmanager.WebhookMessage {
+		var msg alertmanager.WebhookMessage
+		for _, s := range statuses {
+			msg.Alerts = append(msg.Alerts, alertmanager.Alert{Status: s})
+		}
+		return msg
+	}
+
+	for _, tc := range []struct {
+		name  string
+		msg   alertmanager.WebhookMessage
+		atAll bool
+	}{
+		{"at threshold", alerts("firing", "firing"), false},
+		{"above threshold", alerts("firing", "firing", "firing"), true},
+		{"resolved not counted", alerts("firing", "firing", "resolved", "resolved"), false},
+	} {
+		got := ch.EffectiveMention(tc.msg)
+		if got.AtAll != tc.atAll {
+			t.Fatalf("%s: AtAll=%v want %v", tc.name, got.AtAll, tc.atAll)
+		}
+		if !tc.atAll && (len(got.AtUserIds) != 1 || got.AtUserIds[0] != "owner") {
+			t.Fatalf("%s: AtUserIds=%v want [owner]", tc.name, got.AtUserIds)
+		}
+	}
+
+	ch.AtAllOnCount = 0
+	if got := ch.EffectiveMention(alerts("firing", "firing", "firing")); got.AtAll {
+		t.Fatalf("AtAll=true with threshold disabled")
+	}
+}
+
+func TestEffectiveMention_FromLabels(t *testing.T) {
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Robots: []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{
+				Name:    "default",
+				Robots:  []string{"r1"},
+				Mention: config.MentionConfig{AtUserIds: []string{"owner"}},
+				MentionRules: []config.MentionRuleConfig{{
+					Name:    "oncall",
+					When:    config.WhenConfig{Labels: map[string][]string{"team": {"db"}}},
+					Mention: config.MentionConfig{AtMobiles: []string{"13000000000"}},
+					From:    config.MentionFromConfig{UserIdLabel: "oncall_userid"},
+				}},
+			}},
+		},
+	}
+	rt, err := Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	ch := rt.Channels["default"]
+
+	msg := alertmanager.WebhookMessage{
+		CommonLabels: map[string]string{"team": "db"},
+		Alerts: []alertmanager.Alert{
+			{Status: "firing", Labels: map[string]string{"team": "db", "oncall_userid": "alice,owner"}},
+			{Status: "firing", Labels: map[string]string{"team": "db", "oncall_userid": "bob"}},
+		},
+	}
+	got := ch.EffectiveMention(msg)
+	if strings.Join(got.AtUserIds, ",") != "owner,alice,bob" || strings.Join(got.AtMobiles, ",") != "13000000000" {
+		t.Fatalf("mention=%+v", got)
+	}
+
+	msg.CommonLabels = map[string]string{"team": "web"}
+	if got := ch.EffectiveMention(msg); strings.Join(got.AtUserIds, ",") != "owner" {
+		t.Fatalf("unmatched rule mention=%+v", got)
+	}
+}
+
+func TestEffectiveMention_FiringOnlyRule(t *testing.T) {
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Robots: []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{
+				Name:   "default",
+				Robots: []string{"r1"},
+				MentionRules: []config.MentionRuleConfig{{
+					Name:    "critical->@all",
+					When:    config.WhenConfig{Labels: map[string][]string{"severity": {"critical"}}, FiringOnly: true},
+					Mention: config.MentionConfig{AtAll: true},
+				}},
+			}},
+		},
+	}
+	rt, err := Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	ch := rt.Channels["default"]
+
+	msg := alertmanager.WebhookMessage{
+		Status:       "firing",
+		CommonLabels: map[string]string{"severity": "critical"},
+		Alerts:       []alertmanager.Alert{alertWithSeverity("firing", "critical")},
+	}
+	if !ch.EffectiveMention(msg).AtAll {
+		t.Fatalf("firing critical did not @all")
+	}
+	msg.Status = "resolved"
+	msg.Alerts = []alertmanager.Alert{alertWithSeverity("resolved", "critical")}
+	if ch.EffectiveMention(msg).AtAll {
+		t.Fatalf("resolved critical triggered @all with firing_only")
+	}
+}
+
+func TestLoadFromFile_Warnings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	data := `
+dingtalk:
+  robots:
+    - name: r1
+      webhook: http://example.invalid
+    - name: spare
+      webhook: http://example.invalid
+  channels:
+    - name: default
+      robots: ["r1"]
+    - name: orphan
+      robots: ["r1"]
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	var logs bytes.Buffer
+	rt, err := LoadFromFile(slog.New(slog.NewTextHandler(&logs, nil)), path)
+	if err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	want := []string{
+		"dingtalk.robots[spare]: is not used by any channel",
+		"dingtalk.channels[orphan]: is not used by any route",
+	}
+	if strings.Join(rt.Warnings, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Warnings=%q want %q", rt.Warnings, want)
+	}
+	for _, w := range want {
+		if !strings.Contains(logs.String(), w) {
+			t.Fatalf("warning %q not logged:\n%s", w, logs.String())
+		}
+	}
+}
+
+func TestChannel_EffectiveMentionConcurrent(t *testing.T) {
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Robots: []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{
+				Name:   "default",
+				Robots: []string{"r1"},
+				MentionRules: []config.MentionRuleConfig{{
+					Name: "oncall",
+					From: config.MentionFromConfig{UserIdLabel: "oncall"},
+				}},
+			}},
+		},
+	}
+	rt, err := Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	ch := rt.Channels["default"]
+	// Spare capacity, as left by normalizing duplicate or blank entries.
+	ch.Mention.AtUserIds = append(make([]string, 0, 8), "lead")
+
+	var wg sync.WaitGroup
+	for _, user := range []string{"alice", "bob"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msg := alertmanager.WebhookMessage{Alerts: []alertmanager.Alert{{Status: "firing", Labels: map[string]string{"oncall": user}}}}
+			for i := 0; i < 1000; i++ {
+				got := ch.EffectiveMention(msg).AtUserIds
+				if len(got) != 2 || got[0] != "lead" || got[1] != user {
+					t.Errorf("%s: AtUserIds=%v", user, got)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got := ch.Mention.AtUserIds; len(got) != 1 {
+		t.Fatalf("channel mention modified: %v", got)
+	}
+}
@@ -0,0 +1,94 @@
+package sendlog
+
+import (
+	"regexp"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// PreviewRunes bounds the content preview kept with each send.
+const PreviewRunes = 200
+
+// Send is one DingTalk send attempt, successful or not.
+type Send struct {
+	Time time.Time `json:"time"`
+	// Source is "alert" for sends from the alert endpoint and "admin" for
+	// test sends from the admin UI.
+	Source   string `json:"source"`
+	Receiver string `json:"receiver,omitempty"`
+	Channel  string `json:"channel"`
+	Robot    string `json:"robot"`
+	MsgType  string `json:"msg_type"`
+	OK       bool   `json:"ok"`
+	Error    string `json:"error,omitempty"`
+	Preview  string `json:"preview"`
+}
+
+// History keeps the most recent sends, successful or not, for answering
+// "why was nobody paged".
+type History struct {
+	mu      sync.Mutex
+	entries []Send
+}
+
+func NewHistory() *History {
+	return &History{}
+}
+
+// Add records s and evicts the oldest sends so at most max remain. A
+// non-positive max clears the history and records nothing. The preview is
+// redacted and truncated here, so callers may pass the full content.
+func (h *History) Add(s Send, max int) {
+	if h == nil {
+		return
+	}
+	if s.Time.IsZero() {
+		s.Time = time.Now()
+	}
+	s.Preview = Preview(s.Preview)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if max <= 0 {
+		h.entries = nil
+		return
+	}
+	h.entries = append(h.entries, s)
+	if over := len(h.entries) - max; over > 0 {
+		h.entries = append([]Send(nil), h.entries[over:]...)
+	}
+}
+
+// List returns the recorded sends, newest first.
+func (h *History) List() []Send {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]Send, 0, len(h.entries))
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		out = append(out, h.entries[i])
+	}
+	return out
+}
+
+var (
+	// secretParam matches webhook query parameters and key=value pairs
+	// that carry credentials.
+	secretParam = regexp.MustCompile(`(?i)\b(access_token|sign|secret|token)=[^&\s)"'>]+`)
+	// robotSecret matches DingTalk robot signing secrets.
+	robotSecret = regexp.MustCompile(`\bSEC[0-9a-fA-F]{16,}\b`)
+)
+
+// Preview redacts webhook tokens and robot secrets in content and cuts it
+// to PreviewRunes runes.
+func Preview(content string) string {
+	content = secretParam.ReplaceAllString(content, "${1}=REDACTED")
+	content = robotSecret.ReplaceAllString(content, "SEC-REDACTED")
+	if utf8.RuneCountInString(content) <= PreviewRunes {
+		return content
+	}
+	runes := []rune(content)
+	return string(runes[:PreviewRunes]) + "…"
+}
@@ -0,0 +1,44 @@
+package sendlog
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestHistory_AddEvictsOldest(t *testing.T) {
+	h := NewHistory()
+	for _, ch := range []string{"a", "b", "c"} {
+		h.Add(Send{Channel: ch, OK: true}, 2)
+	}
+
+	list := h.List()
+	if len(list) != 2 || list[0].Channel != "c" || list[1].Channel != "b" {
+		t.Fatalf("list=%+v want c, b", list)
+	}
+	if list[0].Time.IsZero() {
+		t.Fatalf("time not set")
+	}
+
+	h.Add(Send{Channel: "d"}, 0)
+	if list := h.List(); len(list) != 0 {
+		t.Fatalf("list=%+v want empty after max 0", list)
+	}
+}
+
+func TestPreview_RedactsAndTruncates(t *testing.T) {
+	got := Preview("see https://oapi.dingtalk.com/robot/send?access_token=abc123&sign=xyz and SEC0123456789abcdef0123")
+	for _, leaked := range []string{"abc123", "xyz", "SEC0123456789abcdef0123"} {
+		if strings.Contains(got, leaked) {
+			t.Fatalf("preview %q leaks %q", got, leaked)
+		}
+	}
+	if !strings.Contains(got, "access_token=REDACTED") {
+		t.Fatalf("preview=%q", got)
+	}
+
+	long := Preview(strings.Repeat("告", PreviewRunes+10))
+	if n := utf8.RuneCountInString(long); n != PreviewRunes+1 || !strings.HasSuffix(long, "…") {
+		t.Fatalf("len=%d preview=%q", n, long)
+	}
+}
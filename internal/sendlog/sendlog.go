@@ -0,0 +1,62 @@
+// Package sendlog keeps the most recent failed DingTalk sends in memory for diagnostics.
+package sendlog
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultMax is the number of failures kept by New.
+const DefaultMax = 100
+
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Receiver string    `json:"receiver"`
+	Channel  string    `json:"channel"`
+	Robot    string    `json:"robot,omitempty"`
+	Error    string    `json:"error"`
+}
+
+type Log struct {
+	mu      sync.Mutex
+	max     int
+	entries []Entry
+}
+
+func New(max int) *Log {
+	if max <= 0 {
+		max = DefaultMax
+	}
+	return &Log{max: max}
+}
+
+// Add records e, evicting the oldest entry when full. Error messages must
+// already be free of secrets; the dingtalk client redacts webhook URLs.
+func (l *Log) Add(e Entry) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, e)
+	if over := len(l.entries) - l.max; over > 0 {
+		l.entries = append([]Entry(nil), l.entries[over:]...)
+	}
+}
+
+// List returns the recorded failures, newest first.
+func (l *Log) List() []Entry {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]Entry, 0, len(l.entries))
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		out = append(out, l.entries[i])
+	}
+	return out
+}
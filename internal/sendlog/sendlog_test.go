@@ -0,0 +1,21 @@
+package sendlog
+
+import "testing"
+
+func TestLog_AddEvictsOldest(t *testing.T) {
+	l := New(2)
+	for _, ch := range []string{"a", "b", "c"} {
+		l.Add(Entry{Channel: ch, Error: "boom"})
+	}
+
+	list := l.List()
+	if len(list) != 2 {
+		t.Fatalf("len(List)=%d want 2", len(list))
+	}
+	if list[0].Channel != "c" || list[1].Channel != "b" {
+		t.Fatalf("list=%+v want c, b", list)
+	}
+	if list[0].Time.IsZero() {
+		t.Fatalf("time not set")
+	}
+}
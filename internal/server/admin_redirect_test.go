@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_AdminPrefixRedirect(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		want   int
+	}{
+		{status: 0, want: http.StatusFound},
+		{status: http.StatusMovedPermanently, want: http.StatusMovedPermanently},
+	} {
+		cfg := &config.Config{
+			Admin: config.AdminConfig{PathPrefix: "/ops", RedirectStatus: tc.status},
+			DingTalk: config.DingTalkConfig{
+				Timeout:  config.Duration(2 * time.Second),
+				Robots:   []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "text"}},
+				Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+			},
+		}
+		rt, err := runtime.Build(nil, "", "", cfg)
+		if err != nil {
+			t.Fatalf("runtime.Build: %v", err)
+		}
+		h := NewHandler(HandlerOptions{
+			State:        runtime.NewStore(rt),
+			AdminPrefix:  "/ops",
+			AdminHandler: http.NotFoundHandler(),
+		})
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/ops?tab=templates&name=a%20b", nil))
+		if rr.Code != tc.want {
+			t.Fatalf("redirect_status=%d: status=%d want %d", tc.status, rr.Code, tc.want)
+		}
+		if loc := rr.Header().Get("Location"); loc != "/ops/?tab=templates&name=a%20b" {
+			t.Fatalf("Location=%q", loc)
+		}
+	}
+}
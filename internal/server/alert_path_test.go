@@ -0,0 +1,56 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_AlertPathTrailingSlash(t *testing.T) {
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout:  config.Duration(2 * time.Second),
+			Robots:   []config.RobotConfig{{Name: "default", Webhook: dt.URL, MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"default"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	body := []byte(`{"receiver":"default","status":"firing","alerts":[]}`)
+
+	post := func(h http.Handler, path string) int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		return rr.Code
+	}
+
+	for _, tc := range []struct {
+		alertPath string
+		strict    bool
+		want      map[string]int
+	}{
+		{"/alert", false, map[string]int{"/alert": http.StatusOK, "/alert/": http.StatusOK, "/alert/x": http.StatusNotFound}},
+		{"/alert/", false, map[string]int{"/alert": http.StatusOK, "/alert/": http.StatusOK}},
+		{"/alert", true, map[string]int{"/alert": http.StatusOK, "/alert/": http.StatusNotFound}},
+	} {
+		h := NewHandler(HandlerOptions{AlertPath: tc.alertPath, StrictPath: tc.strict, State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+		for path, want := range tc.want {
+			if got := post(h, path); got != want {
+				t.Fatalf("path=%q strict=%v POST %s: status=%d want %d", tc.alertPath, tc.strict, path, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/dingtalk"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_AtomicRetryResendsWholeChannel(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		robot := r.URL.Query().Get("robot")
+		mu.Lock()
+		calls[robot]++
+		n := calls[robot]
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if robot == "flaky" && n == 1 {
+			_, _ = w.Write([]byte(`{"errcode":-1,"errmsg":"system busy"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout: config.Duration(2 * time.Second),
+			Robots: []config.RobotConfig{
+				{Name: "good", Webhook: dt.URL + "?robot=good", MsgType: "markdown"},
+				{Name: "flaky", Webhook: dt.URL + "?robot=flaky", MsgType: "markdown"},
+			},
+			Channels: []config.ChannelConfig{{
+				Name:        "default",
+				Robots:      []string{"good", "flaky"},
+				AtomicRetry: config.AtomicRetryConfig{Attempts: 2, Backoff: config.Duration(time.Millisecond)},
+			}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", bytes.NewReader([]byte(`{"receiver":"default","status":"firing","alerts":[]}`))))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// One failed attempt plus one retry of the whole channel.
+	if calls["good"] != 2 || calls["flaky"] != 2 {
+		t.Fatalf("calls=%v want 2 each", calls)
+	}
+}
+
+func TestHandler_RetryBudgetCapsResends(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls[r.URL.Query().Get("robot")]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"errcode":-1,"errmsg":"system busy"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	retry := config.AtomicRetryConfig{Attempts: 5, Backoff: config.Duration(time.Millisecond)}
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout:     config.Duration(2 * time.Second),
+			RetryBudget: 3,
+			Robots: []config.RobotConfig{
+				{Name: "a1", Webhook: dt.URL + "?robot=a1", MsgType: "markdown"},
+				{Name: "a2", Webhook: dt.URL + "?robot=a2", MsgType: "markdown"},
+				{Name: "b1", Webhook: dt.URL + "?robot=b1", MsgType: "markdown"},
+				{Name: "b2", Webhook: dt.URL + "?robot=b2", MsgType: "markdown"},
+			},
+			Channels: []config.ChannelConfig{
+				{Name: "default", Robots: []string{"a1", "a2"}, AtomicRetry: retry},
+				{Name: "b", Robots: []string{"b1", "b2"}, AtomicRetry: retry},
+			},
+			Routes: []config.RouteConfig{{Name: "all", Channels: []string{"default", "b"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", bytes.NewReader([]byte(`{"receiver":"default","status":"firing","alerts":[]}`))))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// Channel default is retried once, spending 2 of the 3 resends; its second
+	// retry resends only a1 with the resend left, and channel b fails fast.
+	if calls["a1"] != 3 || calls["a2"] != 2 || calls["b1"] != 1 || calls["b2"] != 1 {
+		t.Fatalf("calls=%v", calls)
+	}
+	// a1 reports the failure of its last resend, the others the budget.
+	if got := strings.Count(rr.Body.String(), "retry budget exhausted"); got != 3 {
+		t.Fatalf("want the unretried results to mention the budget, got %d: %s", got, rr.Body.String())
+	}
+}
+
+func TestHandler_RetryBudgetCoversClientResends(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		q := r.URL.Query()
+		mu.Lock()
+		calls[q.Get("robot")]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		ts, _ := strconv.ParseInt(q.Get("timestamp"), 10, 64)
+		switch {
+		case q.Get("robot") == "kw" && !strings.Contains(string(b), "KW-XYZ"):
+			_, _ = w.Write([]byte(`{"errcode":310000,"errmsg":"keywords not in content"}`))
+		case q.Get("robot") == "signed" && q.Get("sign") != dingtalk.Sign(ts, "SECnew"):
+			_, _ = w.Write([]byte(`{"errcode":310000,"errmsg":"sign not match"}`))
+		default:
+			_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+		}
+	}))
+	t.Cleanup(dt.Close)
+
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout:        config.Duration(2 * time.Second),
+			RetryBudget:    1,
+			MaxConcurrency: 1,
+			Robots: []config.RobotConfig{
+				{Name: "kw", Webhook: dt.URL + "?robot=kw", MsgType: "markdown", Keyword: "KW-XYZ", KeywordAutoAppend: true},
+				{Name: "signed", Webhook: dt.URL + "?robot=signed", MsgType: "markdown", Secret: config.SecretList{"SECold", "SECnew"}},
+			},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"kw", "signed"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", bytes.NewReader([]byte(`{"receiver":"default","status":"firing","alerts":[]}`))))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// The keyword resend spends the only unit; the fallback secret is not tried.
+	if calls["kw"] != 2 || calls["signed"] != 1 {
+		t.Fatalf("calls=%v", calls)
+	}
+	if !strings.Contains(rr.Body.String(), "sign not match (retry budget exhausted)") {
+		t.Fatalf("body=%s", rr.Body.String())
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_ChannelRateLimit(t *testing.T) {
+	var sends atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sends.Add(1)
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout: config.Duration(2 * time.Second),
+			Robots:  []config.RobotConfig{{Name: "r1", Webhook: srv.URL, MsgType: "text"}},
+			Channels: []config.ChannelConfig{{
+				Name:      "default",
+				Robots:    []string{"r1"},
+				RateLimit: config.RateLimitConfig{PerMinute: 2, Mode: "drop"},
+			}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	post := func() int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(`{"receiver":"default","status":"firing","alerts":[]}`)))
+		return rr.Code
+	}
+	for i := 0; i < 2; i++ {
+		if code := post(); code != http.StatusOK {
+			t.Fatalf("post #%d status=%d", i+1, code)
+		}
+	}
+	if code := post(); code != http.StatusInternalServerError {
+		t.Fatalf("post #3 status=%d want %d", code, http.StatusInternalServerError)
+	}
+	if got := sends.Load(); got != 2 {
+		t.Fatalf("sends=%d want 2", got)
+	}
+
+	st := rt.ChannelLimiter.States()["default"]
+	if st.PerMinute != 2 || st.Dropped != 1 {
+		t.Fatalf("state=%+v", st)
+	}
+}
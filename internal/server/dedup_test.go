@@ -0,0 +1,125 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/dedup"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_DedupWindowSuppressesRepeats(t *testing.T) {
+	var sends atomic.Int32
+	var fail atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sends.Add(1)
+		if fail.Load() {
+			_, _ = w.Write([]byte(`{"errcode":130101,"errmsg":"send too fast"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout:     config.Duration(2 * time.Second),
+			DedupWindow: config.Duration(time.Hour),
+			Robots:      []config.RobotConfig{{Name: "r1", Webhook: srv.URL, MsgType: "text"}},
+			Channels:    []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20, Dedup: dedup.New()})
+
+	post := func(payload string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(payload)))
+		return rr
+	}
+	firing := `{"receiver":"ops","status":"firing","commonLabels":{"alertname":"DiskFull"},"alerts":[]}`
+	resolved := `{"receiver":"ops","status":"resolved","commonLabels":{"alertname":"DiskFull"},"alerts":[]}`
+
+	// A failed send is not remembered, so Alertmanager's retry goes through.
+	fail.Store(true)
+	if rr := post(firing); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("failing send: status=%d", rr.Code)
+	}
+	fail.Store(false)
+	if rr := post(firing); rr.Code != http.StatusOK || sends.Load() != 2 {
+		t.Fatalf("retry: status=%d sends=%d", rr.Code, sends.Load())
+	}
+
+	rr := post(firing)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "duplicate suppressed") {
+		t.Fatalf("repeat: status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if sends.Load() != 2 {
+		t.Fatalf("sends=%d want 2 after duplicate", sends.Load())
+	}
+
+	if rr := post(resolved); rr.Code != http.StatusOK || sends.Load() != 3 {
+		t.Fatalf("resolved: status=%d sends=%d", rr.Code, sends.Load())
+	}
+}
+
+func TestHandler_RobotDedupWindows(t *testing.T) {
+	var mu sync.Mutex
+	sends := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sends[r.URL.Query().Get("robot")]++
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	hour, off := config.Duration(time.Hour), config.Duration(0)
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout:     config.Duration(2 * time.Second),
+			DedupWindow: config.Duration(time.Minute),
+			Robots: []config.RobotConfig{
+				{Name: "ops", Webhook: srv.URL + "?robot=ops", MsgType: "text", DedupWindow: &hour},
+				{Name: "audit", Webhook: srv.URL + "?robot=audit", MsgType: "text", DedupWindow: &off},
+			},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"ops", "audit"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	if got := rt.MaxDedupWindow(); got != time.Hour {
+		t.Fatalf("MaxDedupWindow=%v want 1h", got)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20, Dedup: dedup.New()})
+
+	firing := `{"receiver":"ops","status":"firing","commonLabels":{"alertname":"DiskFull"},"alerts":[]}`
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(firing)))
+		if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "duplicate suppressed") {
+			t.Fatalf("post %d: status=%d body=%s", i, rr.Code, rr.Body.String())
+		}
+		if i > 0 && !strings.Contains(rr.Body.String(), `"robot":"ops","ok":true,"duplicate":true`) {
+			t.Fatalf("post %d: ops not reported as duplicate: %s", i, rr.Body.String())
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// The ops robot dedupes the repeats within its hour; audit gets them all.
+	if sends["ops"] != 1 || sends["audit"] != 3 {
+		t.Fatalf("sends=%v want ops=1 audit=3", sends)
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"sync"
+)
+
+// Dispatcher runs DingTalk sends and keeps track of the ones in flight, so
+// that shutdown can wait for them instead of exiting under them.
+type Dispatcher struct {
+	mu       sync.Mutex
+	pending  int
+	draining bool
+	flushed  int
+	idle     chan struct{}
+}
+
+// DrainStats reports the outcome of Drain: Flushed sends completed after
+// draining began, Abandoned ones were still running when it gave up.
+type DrainStats struct {
+	Flushed   int
+	Abandoned int
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// Go runs send in a new goroutine. Sends are still accepted while draining,
+// since they come from requests that were already accepted. A nil
+// Dispatcher runs send untracked.
+func (d *Dispatcher) Go(send func()) {
+	if d == nil {
+		go send()
+		return
+	}
+	d.mu.Lock()
+	d.pending++
+	d.mu.Unlock()
+	go func() {
+		defer d.done()
+		send()
+	}()
+}
+
+func (d *Dispatcher) done() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending--
+	if d.draining {
+		d.flushed++
+	}
+	if d.pending == 0 && d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+}
+
+// beginDrain starts counting flushed sends. Server calls it as soon as
+// Shutdown starts, so sends finishing while connections drain are counted.
+func (d *Dispatcher) beginDrain() {
+	d.mu.Lock()
+	d.draining = true
+	d.mu.Unlock()
+}
+
+// Drain waits until no send is in flight or ctx is done.
+func (d *Dispatcher) Drain(ctx context.Context) DrainStats {
+	if d == nil {
+		return DrainStats{}
+	}
+	d.mu.Lock()
+	d.draining = true
+	if d.pending == 0 {
+		stats := DrainStats{Flushed: d.flushed}
+		d.mu.Unlock()
+		return stats
+	}
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+	idle := d.idle
+	d.mu.Unlock()
+
+	select {
+	case <-idle:
+	case <-ctx.Done():
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return DrainStats{Flushed: d.flushed, Abandoned: d.pending}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_Drain(t *testing.T) {
+	d := NewDispatcher()
+	if stats := d.Drain(context.Background()); stats != (DrainStats{}) {
+		t.Fatalf("idle drain=%+v", stats)
+	}
+
+	release := make(chan struct{})
+	stuck := make(chan struct{})
+	defer close(stuck)
+	for i := 0; i < 2; i++ {
+		d.Go(func() { <-release })
+	}
+	d.Go(func() { <-stuck })
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	stats := d.Drain(ctx)
+	if stats.Flushed != 2 || stats.Abandoned != 1 {
+		t.Fatalf("drain=%+v, want 2 flushed and 1 abandoned", stats)
+	}
+}
+
+func TestServer_ShutdownDrainsSends(t *testing.T) {
+	d := NewDispatcher()
+	srv := New(Options{ListenAddr: freeAddr(t), Dispatcher: d})
+	done := make(chan error, 1)
+	go func() { done <- srv.ListenAndServe() }()
+
+	release := make(chan struct{})
+	d.Go(func() { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	<-done
+	// Counting starts with Shutdown, before Drain is called; net/http runs
+	// the hook in its own goroutine.
+	for {
+		d.mu.Lock()
+		draining := d.draining
+		d.mu.Unlock()
+		if draining {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	if stats := d.Drain(ctx); stats.Flushed != 1 || stats.Abandoned != 0 {
+		t.Fatalf("drain=%+v, want 1 flushed", stats)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/dedup"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_EmptyChannel(t *testing.T) {
+	for _, tc := range []struct {
+		mode string
+		code int
+		want sendResult
+	}{
+		{"skip", http.StatusOK, sendResult{Channel: "default", OK: true, Skipped: true}},
+		{"error", http.StatusInternalServerError, sendResult{Channel: "default", Error: "no robot to send to"}},
+	} {
+		cfg := &config.Config{
+			DingTalk: config.DingTalkConfig{
+				Timeout:      config.Duration(2 * time.Second),
+				EmptyChannel: tc.mode,
+				Robots:       []config.RobotConfig{{Name: "r1", Webhook: "http://127.0.0.1:1/robot/send", MsgType: "markdown"}},
+				Channels:     []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+			},
+		}
+		rt, err := runtime.Build(nil, "", "", cfg)
+		if err != nil {
+			t.Fatalf("runtime.Build: %v", err)
+		}
+		// The config cannot list a channel without robots; stand in for a
+		// robot selection that yields none for this alert.
+		ch := rt.Channels["default"]
+		ch.Robots = nil
+		rt.Channels["default"] = ch
+		h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(`{"status":"firing","alerts":[{"status":"firing"}]}`)))
+		if rr.Code != tc.code {
+			t.Fatalf("%s: status=%d body=%s", tc.mode, rr.Code, rr.Body.String())
+		}
+		var resp struct {
+			Results []sendResult `json:"results"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: decode: %v", tc.mode, err)
+		}
+		if len(resp.Results) != 1 || resp.Results[0] != tc.want {
+			t.Fatalf("%s: results=%+v", tc.mode, resp.Results)
+		}
+	}
+}
+
+func TestHandler_EmptyChannelIgnoresRobotDedup(t *testing.T) {
+	var sent atomic.Int32
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	hour := config.Duration(time.Hour)
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout:      config.Duration(2 * time.Second),
+			EmptyChannel: "error",
+			Robots:       []config.RobotConfig{{Name: "r1", Webhook: dt.URL, MsgType: "markdown", DedupWindow: &hour}},
+			Channels:     []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20, Dedup: dedup.New()})
+
+	// A channel whose every robot deduplicated the repeat is not empty: the
+	// repeat is answered as a duplicate, not as a failure to retry.
+	body := `{"status":"firing","commonLabels":{"alertname":"DiskFull"},"alerts":[{"status":"firing"}]}`
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(body)))
+		if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "no robot to send to") {
+			t.Fatalf("post %d: status=%d body=%s", i, rr.Code, rr.Body.String())
+		}
+		if i == 1 && !strings.Contains(rr.Body.String(), "duplicate suppressed") {
+			t.Fatalf("post %d: body=%s", i, rr.Body.String())
+		}
+	}
+	if got := sent.Load(); got != 1 {
+		t.Fatalf("sent=%d want 1", got)
+	}
+}
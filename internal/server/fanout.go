@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/dingtalk"
+	"prometheus-dingtalk-hook/internal/metrics"
+	"prometheus-dingtalk-hook/internal/runtime"
+	"prometheus-dingtalk-hook/internal/sendlog"
+)
+
+// sendJob is one rendered message for one robot. index is its slot in the
+// results slice, so results keep channel/robot order however sends finish.
+type sendJob struct {
+	index   int
+	channel string
+	robot   config.RobotConfig
+	msg     dingtalk.Message
+}
+
+// runSends sends jobs with at most dingtalk.max_concurrency in flight and
+// fills in their results. It returns once every send has finished; sends
+// share ctx, so they stop when the request is cancelled, and budget, which
+// the client's keyword and fallback-secret resends spend.
+func runSends(ctx context.Context, rt *runtime.Runtime, opts HandlerOptions, receiver string, jobs []sendJob, results []sendResult, budget *dingtalk.RetryBudget) {
+	limit := rt.Config.DingTalk.MaxConcurrency
+	if limit <= 0 || limit > len(jobs) {
+		limit = len(jobs)
+	}
+
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		sem <- struct{}{}
+		wg.Add(1)
+		opts.Dispatcher.Go(func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			target := runtime.Target(job.robot)
+			target.Budget = budget
+			start := time.Now()
+			err := rt.DingTalk.SendTo(ctx, target, job.msg)
+			metrics.ObserveSend(job.robot.Name, job.channel, start, err)
+			sent := sendlog.Send{
+				Source:   "alert",
+				Receiver: receiver,
+				Channel:  job.channel,
+				Robot:    job.robot.Name,
+				MsgType:  job.msg.MsgType,
+				OK:       err == nil,
+				Preview:  job.msg.Content(),
+			}
+			if err != nil {
+				sent.Error = err.Error()
+			}
+			opts.Sends.Add(sent, rt.Config.Admin.RecentSends)
+			if err != nil {
+				if errors.Is(err, dingtalk.ErrRateLimited) {
+					opts.Logger.Warn("send dropped by rate limit", "robot", job.robot.Name, "receiver", receiver, "channel", job.channel)
+				} else {
+					opts.Logger.Error("send failed", "robot", job.robot.Name, "receiver", receiver, "channel", job.channel, "err", err)
+				}
+				opts.SendLog.Add(sendlog.Entry{Receiver: receiver, Channel: job.channel, Robot: job.robot.Name, Error: err.Error()})
+				results[job.index].Error = err.Error()
+				return
+			}
+			results[job.index].OK = true
+		})
+	}
+	wg.Wait()
+}
+
+// retryAtomicChannels resends every job of a channel with atomic_retry while
+// any of them failed, up to the channel's attempts. Robots that succeeded
+// are sent to again, so the channel either fully succeeds or reports the
+// failures of its last attempt. Every resent job spends one unit of budget,
+// failed jobs first; jobs the budget no longer covers are not resent, and
+// failed ones fail fast with the budget noted in their error.
+func retryAtomicChannels(ctx context.Context, rt *runtime.Runtime, opts HandlerOptions, receiver string, jobs []sendJob, results []sendResult, budget *dingtalk.RetryBudget) {
+	var order []string
+	byChannel := make(map[string][]sendJob)
+	for _, job := range jobs {
+		if _, ok := byChannel[job.channel]; !ok {
+			order = append(order, job.channel)
+		}
+		byChannel[job.channel] = append(byChannel[job.channel], job)
+	}
+
+	for _, name := range order {
+		retry := rt.Channels[name].AtomicRetry
+		channelJobs := byChannel[name]
+		for attempt := 1; attempt <= retry.Attempts && !allSent(channelJobs, results); attempt++ {
+			resend, skipped := budgetJobs(channelJobs, results, budget)
+			for _, job := range skipped {
+				if !results[job.index].OK {
+					results[job.index].Error += " (" + dingtalk.ErrRetryBudgetExhausted.Error() + ")"
+				}
+			}
+			if len(skipped) > 0 {
+				opts.Logger.Warn("retry budget exhausted", "channel", name, "receiver", receiver, "attempt", attempt, "skipped", len(skipped), "budget", rt.Config.DingTalk.RetryBudget)
+			}
+			if len(resend) == 0 {
+				break
+			}
+			timer := time.NewTimer(retry.Backoff.Duration())
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			opts.Logger.Warn("retrying channel as a unit", "channel", name, "receiver", receiver, "attempt", attempt)
+			for _, job := range resend {
+				results[job.index].OK = false
+				results[job.index].Error = ""
+			}
+			runSends(ctx, rt, opts, receiver, resend, results, budget)
+			if len(skipped) > 0 {
+				break
+			}
+		}
+	}
+}
+
+// budgetJobs splits the jobs of a channel retry into those budget pays a
+// resend for, failed jobs first, and those it no longer covers.
+func budgetJobs(jobs []sendJob, results []sendResult, budget *dingtalk.RetryBudget) (resend, skipped []sendJob) {
+	ordered := make([]sendJob, 0, len(jobs))
+	for _, ok := range []bool{false, true} {
+		for _, job := range jobs {
+			if results[job.index].OK == ok {
+				ordered = append(ordered, job)
+			}
+		}
+	}
+	for _, job := range ordered {
+		if budget.Take() {
+			resend = append(resend, job)
+		} else {
+			skipped = append(skipped, job)
+		}
+	}
+	return resend, skipped
+}
+
+func allSent(jobs []sendJob, results []sendResult) bool {
+	for _, job := range jobs {
+		if !results[job.index].OK {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeSharedRobots merges the mentions of a job into an earlier job for the
+// same robot with the same message, so a robot shared by several matched
+// channels gets a single message. Channels whose templates, group_by or data
+// render a different message still send it separately. It returns the kept
+// jobs and, for every dropped job, the result index of the job sending for it.
+func mergeSharedRobots(jobs []sendJob, results []sendResult) ([]sendJob, map[int]int) {
+	byRobot := make(map[string][]int, len(jobs))
+	merged := make(map[int]int)
+	out := make([]sendJob, 0, len(jobs))
+	for _, job := range jobs {
+		i := slices.IndexFunc(byRobot[job.robot.Name], func(i int) bool {
+			return sameMessage(out[i].msg, job.msg)
+		})
+		if i < 0 {
+			byRobot[job.robot.Name] = append(byRobot[job.robot.Name], len(out))
+			out = append(out, job)
+			continue
+		}
+		i = byRobot[job.robot.Name][i]
+		out[i].msg.At = mergeAt(out[i].msg.At, job.msg.At)
+		merged[job.index] = out[i].index
+		results[job.index].MergedInto = out[i].channel
+	}
+	return out, merged
+}
+
+// sameMessage reports whether a and b differ at most in their mentions.
+func sameMessage(a, b dingtalk.Message) bool {
+	a.At, b.At = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+// mergeAt returns the union of a and b without modifying either, since
+// jobs of one channel share their At.
+func mergeAt(a, b *dingtalk.At) *dingtalk.At {
+	if a == nil && b == nil {
+		return nil
+	}
+	out := &dingtalk.At{}
+	for _, at := range []*dingtalk.At{a, b} {
+		if at == nil {
+			continue
+		}
+		out.IsAtAll = out.IsAtAll || at.IsAtAll
+		out.AtMobiles = appendMissing(out.AtMobiles, at.AtMobiles)
+		out.AtUserIds = appendMissing(out.AtUserIds, at.AtUserIds)
+	}
+	return out
+}
+
+func appendMissing(dst, src []string) []string {
+	for _, v := range src {
+		if !slices.Contains(dst, v) {
+			dst = append(dst, v)
+		}
+	}
+	return dst
+}
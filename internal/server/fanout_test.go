@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_FanOutBoundedAndOrdered(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		if r.URL.Query().Get("fail") != "" {
+			_, _ = w.Write([]byte(`{"errcode":300001,"errmsg":"token is not exist"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	names := []string{"r1", "r2", "r3", "r4", "r5"}
+	var robots []config.RobotConfig
+	for _, name := range names {
+		webhook := srv.URL + "?robot=" + name
+		if name == "r2" {
+			webhook += "&fail=1"
+		}
+		robots = append(robots, config.RobotConfig{Name: name, Webhook: webhook, MsgType: "text"})
+	}
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout:        config.Duration(2 * time.Second),
+			MaxConcurrency: 2,
+			Robots:         robots,
+			Channels:       []config.ChannelConfig{{Name: "default", Robots: names}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(`{"receiver":"default","status":"firing","alerts":[]}`)))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	if got := peak.Load(); got != 2 {
+		t.Fatalf("peak in-flight sends=%d want 2", got)
+	}
+
+	var resp struct {
+		Results []sendResult `json:"results"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(resp.Results) != len(names) {
+		t.Fatalf("results=%+v", resp.Results)
+	}
+	for i, res := range resp.Results {
+		if res.Robot != names[i] {
+			t.Fatalf("results[%d].robot=%q want %q", i, res.Robot, names[i])
+		}
+		if wantOK := names[i] != "r2"; res.OK != wantOK {
+			t.Fatalf("results[%d]=%+v", i, res)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+
+	"prometheus-dingtalk-hook/internal/dingtalk"
+	"prometheus-dingtalk-hook/internal/metrics"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+// forwardPayload posts the raw body to every forward.urls endpoint and to
+// server.mirror_url in the background. The sends outlive the request, so
+// they do not use its context, but they are tracked by the dispatcher and
+// drained on shutdown. At most forward.max_pending run at once; beyond that
+// forwards are dropped so a slow endpoint cannot pile up goroutines.
+// Failures are logged and counted and never affect the alert response.
+func forwardPayload(rt *runtime.Runtime, opts HandlerOptions, body []byte) {
+	if rt.Forward == nil {
+		return
+	}
+	for _, url := range rt.Config.ForwardURLs() {
+		if !rt.Forward.Reserve() {
+			metrics.ObserveForwardDropped()
+			opts.Logger.Warn("forward dropped: forward.max_pending reached", "url", dingtalk.RedactWebhook(url))
+			continue
+		}
+		opts.Dispatcher.Go(func() {
+			defer rt.Forward.Release()
+			err := rt.Forward.Post(context.Background(), url, body)
+			metrics.ObserveForward(err)
+			if err != nil {
+				opts.Logger.Warn("forward failed", "url", dingtalk.RedactWebhook(url), "err", err)
+			}
+		})
+	}
+}
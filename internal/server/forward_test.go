@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_ForwardsRawPayload(t *testing.T) {
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	received := make(chan string, 1)
+	archive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received <- r.Header.Get("Content-Type") + " " + string(b)
+	}))
+	t.Cleanup(archive.Close)
+	failed := make(chan struct{}, 1)
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failed <- struct{}{}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(broken.Close)
+
+	cfg := &config.Config{
+		Forward: config.ForwardConfig{URLs: []string{broken.URL, archive.URL + "?token=secret"}, Timeout: config.Duration(2 * time.Second)},
+		DingTalk: config.DingTalkConfig{
+			Timeout:  config.Duration(2 * time.Second),
+			Robots:   []config.RobotConfig{{Name: "r1", Webhook: dt.URL, MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20, Dispatcher: NewDispatcher()})
+
+	body := `{"receiver":"default","status":"firing","alerts":[{"status":"firing","labels":{"alertname":"A"}}]}`
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(body)))
+	// A failing forward endpoint does not fail the alert.
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	select {
+	case got := <-received:
+		if got != "application/json "+body {
+			t.Fatalf("forwarded %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("payload was not forwarded")
+	}
+	select {
+	case <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("payload was not forwarded to the failing endpoint")
+	}
+}
+
+func TestHandler_MirrorURLBoundsPending(t *testing.T) {
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	received := make(chan string, 2)
+	unblock := make(chan struct{})
+	siem := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received <- string(b)
+		<-unblock
+	}))
+	t.Cleanup(siem.Close)
+
+	cfg := &config.Config{
+		Server:  config.ServerConfig{MirrorURL: siem.URL},
+		Forward: config.ForwardConfig{Timeout: config.Duration(5 * time.Second), MaxPending: 1},
+		DingTalk: config.DingTalkConfig{
+			Timeout:  config.Duration(2 * time.Second),
+			Robots:   []config.RobotConfig{{Name: "r1", Webhook: dt.URL, MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	d := NewDispatcher()
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20, Dispatcher: d})
+
+	first := `{"receiver":"default","status":"firing","alerts":[{"status":"firing","labels":{"alertname":"A"}}]}`
+	second := `{"receiver":"default","status":"firing","alerts":[{"status":"firing","labels":{"alertname":"B"}}]}`
+	for _, body := range []string{first, second} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+		}
+	}
+
+	select {
+	case got := <-received:
+		if got != first {
+			t.Fatalf("mirrored %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("payload was not mirrored")
+	}
+	close(unblock)
+	d.Drain(context.Background())
+	// The second payload arrived while the first was in flight and was
+	// dropped instead of queued beyond forward.max_pending.
+	if n := len(received); n != 0 {
+		t.Fatalf("mirrored %d more payloads, want 0", n)
+	}
+}
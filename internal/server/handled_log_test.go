@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_LogsHandledSummary(t *testing.T) {
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout:  config.Duration(2 * time.Second),
+			Robots:   []config.RobotConfig{{Name: "r1", Webhook: dt.URL, MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+	h := NewHandler(HandlerOptions{Logger: logger, AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	body := `{"receiver":"ops","status":"firing","alerts":[
+		{"status":"firing","labels":{"alertname":"A"},"annotations":{"description":"secret-ish detail"}},
+		{"status":"firing","labels":{"alertname":"B"}},
+		{"status":"resolved","labels":{"alertname":"C"}}]}`
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	var line map[string]any
+	for _, l := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(l), &m); err != nil {
+			t.Fatalf("log line is not json: %q", l)
+		}
+		if m["msg"] == "alert notification handled" {
+			line = m
+		}
+	}
+	if line == nil {
+		t.Fatalf("no summary line in logs: %s", logs.String())
+	}
+	if line["level"] != "INFO" || line["receiver"] != "ops" || line["status"] != "firing" ||
+		line["alert_count"] != float64(3) || line["firing"] != float64(2) || line["resolved"] != float64(1) ||
+		line["failed"] != float64(0) {
+		t.Fatalf("summary=%v", line)
+	}
+	if ch, _ := line["matched_channels"].([]any); len(ch) != 1 || ch[0] != "default" {
+		t.Fatalf("matched_channels=%v", line["matched_channels"])
+	}
+	if _, ok := line["send_duration"].(float64); !ok {
+		t.Fatalf("send_duration=%v", line["send_duration"])
+	}
+	if strings.Contains(logs.String(), "secret-ish detail") {
+		t.Fatalf("alert body leaked into logs: %s", logs.String())
+	}
+}
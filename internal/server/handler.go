@@ -2,52 +2,72 @@
 package server
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/capture"
+	"prometheus-dingtalk-hook/internal/dedup"
 	"prometheus-dingtalk-hook/internal/dingtalk"
+	"prometheus-dingtalk-hook/internal/metrics"
 	"prometheus-dingtalk-hook/internal/reload"
 	"prometheus-dingtalk-hook/internal/router"
 	"prometheus-dingtalk-hook/internal/runtime"
+	"prometheus-dingtalk-hook/internal/sendlog"
 )
 
 type HandlerOptions struct {
 	Logger       *slog.Logger
 	AlertPath    string
+	StrictPath   bool
 	AdminPrefix  string
 	AdminHandler http.Handler
 	State        *runtime.Store
 	Reload       *reload.Manager
 	MaxBodyBytes int64
+	Capture      *capture.Buffer
+	SendLog      *sendlog.Log
+	// Sends records every send, successful or not, for the admin API.
+	Sends *sendlog.History
+	// Dedup remembers recently sent notifications for dingtalk.dedup_window.
+	Dedup *dedup.Cache
+	// Dispatcher runs the sends so shutdown can wait for them; nil runs
+	// them untracked.
+	Dispatcher *Dispatcher
+	// NoTelemetry leaves /healthz, /readyz and /metrics out of the handler,
+	// for when they are served on server.telemetry_listen instead.
+	NoTelemetry bool
 }
 
-func defaultMarkdownTitle(msg alertmanager.WebhookMessage) string {
-	if msg.CommonAnnotations != nil {
-		if v := strings.TrimSpace(msg.CommonAnnotations["summary"]); v != "" {
-			return v
-		}
-	}
-	if len(msg.Alerts) > 0 && msg.Alerts[0].Annotations != nil {
-		if v := strings.TrimSpace(msg.Alerts[0].Annotations["summary"]); v != "" {
-			return v
-		}
-	}
-	if msg.CommonLabels != nil {
-		if v := strings.TrimSpace(msg.CommonLabels["alertname"]); v != "" {
-			return v
-		}
-	}
-	if len(msg.Alerts) > 0 && msg.Alerts[0].Labels != nil {
-		if v := strings.TrimSpace(msg.Alerts[0].Labels["alertname"]); v != "" {
-			return v
-		}
+// checkRender renders the default template against a synthetic alert, so a
+// broken template dir fails the deep readiness check instead of the next alert.
+func checkRender(rt *runtime.Runtime) error {
+	if rt == nil || rt.Renderer == nil {
+		return errors.New("runtime not loaded")
 	}
-	return "Alertmanager"
+	_, err := rt.Renderer.RenderOutput(rt.Renderer.DefaultName(), alertmanager.WebhookMessage{
+		Receiver:          "readyz",
+		Status:            "firing",
+		CommonLabels:      map[string]string{"alertname": "ReadinessCheck"},
+		CommonAnnotations: map[string]string{},
+		GroupLabels:       map[string]string{},
+		Alerts: []alertmanager.Alert{{
+			Status:      "firing",
+			Labels:      map[string]string{"alertname": "ReadinessCheck", "severity": "info"},
+			Annotations: map[string]string{"summary": "readiness check"},
+			StartsAt:    time.Now(),
+		}},
+	})
+	return err
 }
 
 func NewHandler(opts HandlerOptions) http.Handler {
@@ -56,12 +76,9 @@ func NewHandler(opts HandlerOptions) http.Handler {
 	}
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
-		writeJSON(w, http.StatusOK, map[string]any{"code": 0, "message": "ok"})
-	})
-	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
-		writeJSON(w, http.StatusOK, map[string]any{"code": 0, "message": "ready"})
-	})
+	if !opts.NoTelemetry {
+		handleTelemetry(mux, opts.State)
+	}
 
 	if opts.Reload != nil {
 		mux.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
@@ -87,7 +104,13 @@ func NewHandler(opts HandlerOptions) http.Handler {
 			prefix = "/" + prefix
 		}
 		mux.Handle(prefix+"/", http.StripPrefix(prefix, opts.AdminHandler))
-		mux.Handle(prefix, http.RedirectHandler(prefix+"/", http.StatusMovedPermanently))
+		mux.HandleFunc(prefix, func(w http.ResponseWriter, r *http.Request) {
+			target := prefix + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, adminRedirectStatus(opts.State))
+		})
 	}
 
 	path := opts.AlertPath
@@ -97,10 +120,68 @@ func NewHandler(opts HandlerOptions) http.Handler {
 	mux.Handle(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handleAlert(w, r, opts)
 	}))
+	if alt := alternateAlertPath(path); !opts.StrictPath && alt != "" {
+		// A pattern ending in "/" matches the whole subtree; only the exact
+		// alternate path is an alias.
+		mux.Handle(alt, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != alt {
+				http.NotFound(w, r)
+				return
+			}
+			handleAlert(w, r, opts)
+		}))
+	}
 
 	return mux
 }
 
+// NewTelemetryHandler serves only /healthz, /readyz and /metrics, for the
+// server.telemetry_listen listener.
+func NewTelemetryHandler(state *runtime.Store) http.Handler {
+	mux := http.NewServeMux()
+	handleTelemetry(mux, state)
+	return mux
+}
+
+func handleTelemetry(mux *http.ServeMux, state *runtime.Store) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"code": 0, "message": "ok"})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if deep, _ := strconv.ParseBool(r.URL.Query().Get("deep")); deep {
+			if err := checkRender(state.Load()); err != nil {
+				writeJSON(w, http.StatusServiceUnavailable, map[string]any{"code": 503, "message": "render check failed: " + err.Error()})
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"code": 0, "message": "ready"})
+	})
+	mux.Handle("/metrics", metrics.Handler())
+}
+
+// adminRedirectStatus returns admin.redirect_status of the current runtime,
+// defaulting to 302 Found.
+func adminRedirectStatus(state *runtime.Store) int {
+	if state != nil {
+		if rt := state.Load(); rt != nil && rt.Config != nil && rt.Config.Admin.RedirectStatus != 0 {
+			return rt.Config.Admin.RedirectStatus
+		}
+	}
+	return http.StatusFound
+}
+
+// alternateAlertPath returns path with its trailing slash toggled, or "" when
+// there is no distinct alternate (the root path).
+func alternateAlertPath(path string) string {
+	if path == "/" {
+		return ""
+	}
+	if strings.HasSuffix(path, "/") {
+		return strings.TrimSuffix(path, "/")
+	}
+	return path + "/"
+}
+
 func handleAlert(w http.ResponseWriter, r *http.Request, opts HandlerOptions) {
 	if r.Method != http.MethodPost {
 		w.Header().Set("Allow", http.MethodPost)
@@ -120,7 +201,18 @@ func handleAlert(w http.ResponseWriter, r *http.Request, opts HandlerOptions) {
 		return
 	}
 
-	if err := checkToken(r, rt.Config.Auth.Token); err != nil {
+	if len(rt.AllowedCIDRs) > 0 {
+		ip, ok := clientIP(r, rt.TrustedProxies)
+		if !ok || !containsAddr(rt.AllowedCIDRs, ip) {
+			opts.Logger.Warn("alert source not allowed", "remote_addr", r.RemoteAddr, "client_ip", ip)
+			writeJSON(w, http.StatusForbidden, map[string]any{"code": 403, "message": "forbidden"})
+			return
+		}
+	}
+
+	auth := rt.Config.Auth
+	tokenErr := checkToken(r, auth.Token)
+	if tokenErr != nil && (auth.HMACSecret == "" || auth.RequireAll) {
 		writeJSON(w, http.StatusUnauthorized, map[string]any{"code": 401, "message": "unauthorized"})
 		return
 	}
@@ -134,76 +226,253 @@ func handleAlert(w http.ResponseWriter, r *http.Request, opts HandlerOptions) {
 		return
 	}
 
-	var msg alertmanager.WebhookMessage
-	if err := json.Unmarshal(data, &msg); err != nil {
+	if auth.HMACSecret != "" {
+		// Without require_all a valid token is enough on its own.
+		tokenPassed := auth.Token != "" && tokenErr == nil
+		if err := checkSignature(r, data, auth.HMACSecret); err != nil && (auth.RequireAll || !tokenPassed) {
+			opts.Logger.Warn("alert signature rejected", "remote_addr", r.RemoteAddr, "err", err)
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"code": 401, "message": "unauthorized"})
+			return
+		}
+	}
+
+	if opts.Capture != nil {
+		if c := rt.Config.Server.Capture; c.Enabled {
+			opts.Capture.Add(data, c.MaxEntries)
+		} else {
+			opts.Capture.Clear()
+		}
+	}
+
+	msg, skipped, err := alertmanager.Decode(data, rt.Config.Server.TolerantJSON, opts.Logger)
+	if err != nil {
 		opts.Logger.Warn("invalid payload", "err", err)
 		writeJSON(w, http.StatusBadRequest, map[string]any{"code": 400, "message": "invalid json"})
 		return
 	}
 
-	channelNames := router.FirstMatch(rt.Routes, msg)
-	if len(channelNames) == 0 {
+	// Forwarding mirrors every accepted payload, so it runs before quiet
+	// hours and dedup, which only concern DingTalk.
+	forwardPayload(rt, opts, data)
+
+	if rt.QuietHours.Suppress(msg) {
+		metrics.QuietHoursSuppressedTotal.Inc()
+		opts.Logger.Info("notification muted by quiet hours", "receiver", msg.Receiver, "status", msg.Status, "alerts", len(msg.Alerts))
+		writeJSON(w, http.StatusOK, map[string]any{"code": 0, "message": "muted by quiet hours"})
+		return
+	}
+
+	// With per-robot windows the check moves to each robot below.
+	dedupKey := dedup.Key(msg)
+	if !rt.RobotDedup && opts.Dedup.Recent(dedupKey, rt.Config.DingTalk.DedupWindow.Duration()) {
+		metrics.DedupSuppressedTotal.Inc()
+		opts.Logger.Debug("duplicate notification suppressed", "receiver", msg.Receiver, "status", msg.Status, "alerts", len(msg.Alerts))
+		writeJSON(w, http.StatusOK, map[string]any{"code": 0, "message": "duplicate suppressed"})
+		return
+	}
+
+	msg = rt.Priority.Order(msg)
+
+	matched := router.AllMatch(rt.Routes, msg)
+	routeNames := router.RouteNames(matched)
+	channelNames := router.UnionChannels(matched)
+	routed := len(channelNames) > 0
+	if !routed {
 		channelNames = []string{"default"}
 	}
+	opts.Logger.Debug("routes matched", "receiver", msg.Receiver, "status", msg.Status, "routes", routeNames, "channels", channelNames)
 
-	var sendErrs []error
+	var results []sendResult
+	var jobs []sendJob
 	for _, channelName := range channelNames {
 		channel, ok := rt.Channels[channelName]
 		if !ok {
-			sendErrs = append(sendErrs, errors.New("unknown channel "+channelName))
+			results = append(results, sendResult{Channel: channelName, Error: "unknown channel " + channelName})
+			continue
+		}
+		if channel.SkipsResolved(msg) {
+			opts.Logger.Debug("resolved notification skipped by send_resolved", "receiver", msg.Receiver, "channel", channel.Name)
+			continue
+		}
+		if len(channel.Robots) == 0 {
+			results = append(results, emptyChannelResult(rt, opts, msg, channel.Name))
 			continue
 		}
 
-		content, err := rt.Renderer.Render(channel.Template, msg)
+		robots := channel.Robots
+		if rt.RobotDedup {
+			robots = nil
+			for _, robot := range channel.Robots {
+				if opts.Dedup.Recent(dedup.RobotKey(robot.Name, dedupKey), rt.DedupWindow(robot)) {
+					metrics.RobotDedupSuppressedTotal.WithLabelValues(robot.Name).Inc()
+					opts.Logger.Debug("duplicate notification suppressed for robot", "receiver", msg.Receiver, "channel", channel.Name, "robot", robot.Name)
+					results = append(results, sendResult{Channel: channel.Name, Robot: robot.Name, OK: true, Duplicate: true})
+					continue
+				}
+				robots = append(robots, robot)
+			}
+			if len(robots) == 0 {
+				continue
+			}
+		}
+
+		if err := rt.ChannelLimiter.Acquire(r.Context(), channel.Name); err != nil {
+			if errors.Is(err, dingtalk.ErrRateLimited) {
+				metrics.ChannelThrottledTotal.WithLabelValues(channel.Name).Inc()
+				opts.Logger.Warn("notification dropped by channel rate limit", "receiver", msg.Receiver, "channel", channel.Name)
+			}
+			results = append(results, sendResult{Channel: channel.Name, Error: err.Error()})
+			continue
+		}
+
+		cm, err := rt.BuildMessage(channel, msg, routed, robots)
 		if err != nil {
 			opts.Logger.Error("render failed", "channel", channel.Name, "err", err)
-			sendErrs = append(sendErrs, err)
+			metrics.RenderErrorsTotal.WithLabelValues(channel.Name).Inc()
+			opts.SendLog.Add(sendlog.Entry{Receiver: msg.Receiver, Channel: channel.Name, Error: "render: " + err.Error()})
+			results = append(results, sendResult{Channel: channel.Name, Error: err.Error()})
 			continue
 		}
-
-		mention := channel.EffectiveMention(msg)
-		var at *dingtalk.At
-		if mention.AtAll || len(mention.AtMobiles) > 0 || len(mention.AtUserIds) > 0 {
-			at = &dingtalk.At{
-				AtMobiles: mention.AtMobiles,
-				AtUserIds: mention.AtUserIds,
-				IsAtAll:   mention.AtAll,
-			}
+		if cm.Truncated {
+			metrics.MessagesTruncatedTotal.WithLabelValues(channel.Name).Inc()
+			opts.Logger.Warn("message truncated to dingtalk.max_message_bytes", "receiver", msg.Receiver, "channel", channel.Name, "alerts", len(msg.Alerts))
+		}
+		size := len(cm.Output.Content)
+		metrics.MessageBytes.WithLabelValues(channel.Name).Observe(float64(size))
+		if soft := rt.Config.DingTalk.WarnMessageBytes; soft > 0 && size > soft {
+			opts.Logger.Warn("message exceeds dingtalk.warn_message_bytes", "receiver", msg.Receiver, "channel", channel.Name, "bytes", size, "warn_message_bytes", soft, "max_message_bytes", rt.Config.DingTalk.MaxMessageBytes)
 		}
 
-			for _, robot := range channel.Robots {
-				msgType := strings.TrimSpace(robot.MsgType)
-				dtMsg := dingtalk.Message{
-					MsgType: msgType,
-					Title:   strings.TrimSpace(robot.Title),
-					At:      at,
-				}
-				switch msgType {
-				case "markdown":
-					if dtMsg.Title == "" {
-						dtMsg.Title = defaultMarkdownTitle(msg)
-					}
-					dtMsg.Markdown = content
-				case "text":
-					dtMsg.Text = content
-				default:
-					sendErrs = append(sendErrs, errors.New("unsupported msg_type "+msgType))
+		for _, rm := range cm.Robots {
+			if rm.Err != nil {
+				results = append(results, sendResult{Channel: channel.Name, Robot: rm.Robot.Name, Error: rm.Err.Error()})
 				continue
 			}
+			jobs = append(jobs, sendJob{index: len(results), channel: channel.Name, robot: rm.Robot, msg: rm.Msg})
+			results = append(results, sendResult{Channel: channel.Name, Robot: rm.Robot.Name, Truncated: cm.Truncated})
+		}
+	}
 
-			if err := rt.DingTalk.Send(r.Context(), robot.Webhook, robot.Secret, dtMsg); err != nil {
-				opts.Logger.Error("send failed", "robot", robot.Name, "receiver", msg.Receiver, "channel", channel.Name, "err", err)
-				sendErrs = append(sendErrs, err)
+	var merged map[int]int
+	if rt.Config.DingTalk.SharedRobotMention == "merge" {
+		jobs, merged = mergeSharedRobots(jobs, results)
+	}
+	sendStart := time.Now()
+	budget := dingtalk.NewRetryBudget(rt.Config.DingTalk.RetryBudget)
+	runSends(r.Context(), rt, opts, msg.Receiver, jobs, results, budget)
+	retryAtomicChannels(r.Context(), rt, opts, msg.Receiver, jobs, results, budget)
+	sendDuration := time.Since(sendStart)
+	for dst, src := range merged {
+		results[dst].OK = results[src].OK
+		results[dst].Error = results[src].Error
+	}
+
+	var failed, duplicates int
+	for _, res := range results {
+		if !res.OK {
+			failed++
+		}
+		if res.Duplicate {
+			duplicates++
+		}
+	}
+	if rt.RobotDedup {
+		for _, job := range jobs {
+			if results[job.index].OK {
+				opts.Dedup.Record(dedup.RobotKey(job.robot.Name, dedupKey))
 			}
 		}
+		if duplicates > 0 && duplicates == len(results) {
+			metrics.DedupSuppressedTotal.Inc()
+			writeJSON(w, http.StatusOK, map[string]any{"code": 0, "message": "duplicate suppressed", "results": results})
+			return
+		}
 	}
+	logHandled(opts.Logger, msg, channelNames, failed, sendDuration)
 
-	if len(sendErrs) > 0 {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"code": 500, "message": "send failed"})
-		return
+	resp := map[string]any{"code": 0, "message": "ok", "results": results}
+	if skipped > 0 {
+		resp["skipped_alerts"] = skipped
+	}
+	if rt.Config.Server.DebugResponse {
+		resp["routes"] = routeNames
 	}
+	// Any failure answers 500 so Alertmanager retries, unless best_effort
+	// accepts a partial failure; results tell which channel/robot pairs
+	// failed either way.
+	if failed > 0 {
+		resp["message"] = "partial send failure"
+		if failed == len(results) {
+			resp["message"] = "send failed"
+		}
+		if failed == len(results) || rt.Config.Server.AlertResponseMode != "best_effort" {
+			resp["code"] = 500
+			writeJSON(w, http.StatusInternalServerError, resp)
+			return
+		}
+		opts.Logger.Warn("partial send failure answered with 200 by alert_response_mode best_effort", "receiver", msg.Receiver, "failed", failed, "sends", len(results))
+	}
+	if !rt.RobotDedup {
+		opts.Dedup.Record(dedupKey)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
 
-	writeJSON(w, http.StatusOK, map[string]any{"code": 0, "message": "ok"})
+// logHandled writes one summary line per notification that reached the
+// send stage. It carries counts rather than the alerts themselves so that
+// the line stays small; failures are logged in detail where they happen.
+func logHandled(logger *slog.Logger, msg alertmanager.WebhookMessage, channels []string, failed int, sendDuration time.Duration) {
+	var firing, resolved int
+	for _, a := range msg.Alerts {
+		switch a.Status {
+		case "firing":
+			firing++
+		case "resolved":
+			resolved++
+		}
+	}
+	logger.Info("alert notification handled",
+		"receiver", msg.Receiver,
+		"status", msg.Status,
+		"alert_count", len(msg.Alerts),
+		"firing", firing,
+		"resolved", resolved,
+		"matched_channels", channels,
+		"failed", failed,
+		"send_duration", sendDuration,
+	)
+}
+
+// sendResult reports the outcome for one channel/robot pair. Robot is empty
+// when the channel failed before sending, e.g. on a render error.
+type sendResult struct {
+	Channel string `json:"channel"`
+	Robot   string `json:"robot,omitempty"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	// Truncated is set when the message was shortened to max_message_bytes.
+	Truncated bool `json:"truncated,omitempty"`
+	// MergedInto names the channel whose send to this robot also carried
+	// this channel's mentions, see dingtalk.shared_robot_mention.
+	MergedInto string `json:"merged_into,omitempty"`
+	// Duplicate is set when the send was suppressed by the robot's own
+	// dedup_window; it counts as successful.
+	Duplicate bool `json:"duplicate,omitempty"`
+	// Skipped is set on the result of a channel with no robot to send to
+	// under dingtalk.empty_channel skip; it counts as successful.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// emptyChannelResult is the result of a matched channel with no robot to
+// send to, as dingtalk.empty_channel decides.
+func emptyChannelResult(rt *runtime.Runtime, opts HandlerOptions, msg alertmanager.WebhookMessage, channel string) sendResult {
+	metrics.EmptyChannelsTotal.WithLabelValues(channel).Inc()
+	if rt.Config.DingTalk.EmptyChannel == "error" {
+		opts.Logger.Warn("channel has no robot to send to", "receiver", msg.Receiver, "channel", channel)
+		return sendResult{Channel: channel, Error: "no robot to send to"}
+	}
+	opts.Logger.Debug("channel has no robot to send to, skipped", "receiver", msg.Receiver, "channel", channel)
+	return sendResult{Channel: channel, OK: true, Skipped: true}
 }
 
 func checkToken(r *http.Request, expected string) error {
@@ -230,6 +499,26 @@ func checkToken(r *http.Request, expected string) error {
 	return errors.New("missing token")
 }
 
+// checkSignature verifies the X-Signature header, the hex HMAC-SHA256 of body
+// keyed with secret, optionally prefixed with "sha256=".
+func checkSignature(r *http.Request, body []byte, secret string) error {
+	sig := strings.TrimSpace(r.Header.Get("X-Signature"))
+	if sig == "" {
+		return errors.New("missing signature")
+	}
+	sig = strings.TrimPrefix(sig, "sha256=")
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return errors.New("signature must be hex")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
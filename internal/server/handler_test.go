@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/metrics"
 	"prometheus-dingtalk-hook/internal/runtime"
 )
 
@@ -84,3 +86,28 @@ func TestHandler_TokenAuth(t *testing.T) {
 		}
 	}
 }
+
+func TestHandler_Metrics(t *testing.T) {
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Robots:   []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	metrics.ObserveSend("r1", "default", time.Now(), nil)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `dingtalk_hook_sends_total{channel="default",result="success",robot="r1"}`) {
+		t.Fatalf("missing sends counter in:\n%s", rr.Body.String())
+	}
+}
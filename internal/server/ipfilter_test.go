@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := config.ParsePrefixes([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("ParsePrefixes: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		xff     string
+		realIP  string
+		trusted bool
+		want    string
+	}{
+		{name: "direct", remote: "192.0.2.1:1234", xff: "198.51.100.7", want: "192.0.2.1"},
+		{name: "untrusted peer ignores headers", remote: "192.0.2.1:1234", realIP: "198.51.100.7", trusted: true, want: "192.0.2.1"},
+		{name: "trusted peer uses xff", remote: "10.1.2.3:1234", xff: "198.51.100.7, 10.9.9.9", trusted: true, want: "198.51.100.7"},
+		{name: "trusted peer uses x-real-ip", remote: "10.1.2.3:1234", realIP: "198.51.100.8", trusted: true, want: "198.51.100.8"},
+		{name: "headers ignored without trusted proxies", remote: "10.1.2.3:1234", xff: "198.51.100.7", want: "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/alert", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			proxies := trusted
+			if !tt.trusted {
+				proxies = nil
+			}
+			got, ok := clientIP(r, proxies)
+			if !ok || got.String() != tt.want {
+				t.Fatalf("clientIP=%v,%v want %s", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_AllowedCIDRs(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{AllowedCIDRs: []string{"192.0.2.0/24"}},
+		DingTalk: config.DingTalkConfig{
+			Robots:   []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "text"}},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	req := httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(`{}`))
+	req.RemoteAddr = "203.0.113.5:4000"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("status=%d want %d", rr.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_LinkMsgType(t *testing.T) {
+	var links []map[string]any
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			MsgType string         `json:"msgtype"`
+			Link    map[string]any `json:"link"`
+		}
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &payload)
+		if payload.MsgType == "link" {
+			links = append(links, payload.Link)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "card.tmpl"), []byte(`**{{ index .Payload.CommonAnnotations "summary" }}**{{ link "https://grafana.example/d/1" }}{{ linkPic "https://img.example/p.png" }}`), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	cfg := &config.Config{
+		Template: config.TemplateConfig{Dir: dir},
+		DingTalk: config.DingTalkConfig{
+			Timeout: config.Duration(2 * time.Second),
+			Robots:  []config.RobotConfig{{Name: "r1", Webhook: dt.URL, MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{
+				{Name: "default", Robots: []string{"r1"}, MsgType: "link"},
+				{Name: "card", Robots: []string{"r1"}, MsgType: "link", Template: "card"},
+			},
+			Routes: []config.RouteConfig{{Name: "card", When: config.WhenConfig{Receiver: []string{"card"}}, Channels: []string{"card"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	for _, receiver := range []string{"default", "card"} {
+		body := `{"receiver":"` + receiver + `","status":"firing","commonAnnotations":{"summary":"Disk full"},
+			"alerts":[{"status":"firing","generatorURL":"https://prom.example/graph"}]}`
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: status=%d body=%s", receiver, rr.Code, rr.Body.String())
+		}
+	}
+
+	if len(links) != 2 {
+		t.Fatalf("links=%v", links)
+	}
+	if links[0]["messageUrl"] != "https://prom.example/graph" || links[0]["title"] != "Disk full" {
+		t.Fatalf("generatorURL fallback: %v", links[0])
+	}
+	if links[1]["messageUrl"] != "https://grafana.example/d/1" || links[1]["picUrl"] != "https://img.example/p.png" || links[1]["text"] != "Disk full" {
+		t.Fatalf("template directives: %v", links[1])
+	}
+}
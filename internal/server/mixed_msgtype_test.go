@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_MixedMsgTypeChannelConvertsTextRobot(t *testing.T) {
+	var mu sync.Mutex
+	bodies := map[string]map[string]any{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		var payload map[string]any
+		_ = json.Unmarshal(b, &payload)
+		mu.Lock()
+		bodies[r.URL.Query().Get("robot")] = payload
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "default.tmpl"), []byte("### Disk full\n- **host**: `db-1`"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	cfg := &config.Config{
+		Template: config.TemplateConfig{Dir: dir},
+		DingTalk: config.DingTalkConfig{
+			Timeout:        config.Duration(2 * time.Second),
+			MaxConcurrency: 2,
+			Robots: []config.RobotConfig{
+				{Name: "md", Webhook: srv.URL + "?robot=md", MsgType: "markdown", Title: "t"},
+				{Name: "txt", Webhook: srv.URL + "?robot=txt", MsgType: "text"},
+			},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"md", "txt"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(`{"status":"firing","alerts":[]}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	md, _ := bodies["md"]["markdown"].(map[string]any)
+	if md["text"] != "### Disk full\n- **host**: `db-1`" {
+		t.Fatalf("markdown robot got %v", bodies["md"])
+	}
+	txt, _ := bodies["txt"]["text"].(map[string]any)
+	if txt["content"] != "Disk full\n- host: db-1" {
+		t.Fatalf("text robot got %v", bodies["txt"])
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_ReadyzDeepChecksRender(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "default.tmpl"), []byte(`{{ template "missing" . }}`), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	build := func(tplDir string) http.Handler {
+		rt, err := runtime.Build(nil, "", "", &config.Config{
+			Template: config.TemplateConfig{Dir: tplDir},
+			DingTalk: config.DingTalkConfig{
+				Timeout:  config.Duration(2 * time.Second),
+				Robots:   []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "markdown"}},
+				Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("runtime.Build: %v", err)
+		}
+		return NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+	}
+	get := func(h http.Handler, target string) int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr.Code
+	}
+
+	healthy := build("")
+	if code := get(healthy, "/readyz?deep=true"); code != http.StatusOK {
+		t.Fatalf("healthy deep readyz status=%d", code)
+	}
+
+	broken := build(dir)
+	if code := get(broken, "/readyz"); code != http.StatusOK {
+		t.Fatalf("shallow readyz status=%d, want 200", code)
+	}
+	if code := get(broken, "/readyz?deep=true"); code != http.StatusServiceUnavailable {
+		t.Fatalf("deep readyz status=%d, want 503", code)
+	}
+}
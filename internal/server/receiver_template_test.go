@@ -0,0 +1,79 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_ReceiverNamedTemplate(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	for name, text := range map[string]string{
+		"default.tmpl":  "default body",
+		"ops-team.tmpl": "ops body",
+		"routed.tmpl":   "routed body",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	cfg := &config.Config{
+		Template: config.TemplateConfig{Dir: dir, ByReceiver: true},
+		DingTalk: config.DingTalkConfig{
+			Timeout: config.Duration(2 * time.Second),
+			Robots:  []config.RobotConfig{{Name: "r1", Webhook: srv.URL, MsgType: "text"}},
+			Channels: []config.ChannelConfig{
+				{Name: "default", Robots: []string{"r1"}},
+				{Name: "routed", Robots: []string{"r1"}, Template: "routed"},
+			},
+			Routes: []config.RouteConfig{{
+				Name:     "severe",
+				When:     config.WhenConfig{Labels: map[string][]string{"severity": {"critical"}}},
+				Channels: []string{"routed"},
+			}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{`{"receiver":"ops-team","status":"firing","alerts":[]}`, "ops body"},
+		{`{"receiver":"db-team","status":"firing","alerts":[]}`, "default body"},
+		// A channel selected by a route keeps its own template.
+		{`{"receiver":"ops-team","status":"firing","commonLabels":{"severity":"critical"},"alerts":[]}`, "routed body"},
+	}
+	for _, tt := range tests {
+		body = ""
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(tt.payload)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		if !strings.Contains(body, tt.want) {
+			t.Fatalf("payload %s: sent %s want %q", tt.payload, body, tt.want)
+		}
+	}
+}
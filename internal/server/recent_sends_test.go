@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+	"prometheus-dingtalk-hook/internal/sendlog"
+)
+
+func TestHandler_RecordsRecentSends(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(ok.Close)
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"errcode":300001,"errmsg":"token is not exist"}`))
+	}))
+	t.Cleanup(bad.Close)
+
+	cfg := &config.Config{
+		Admin: config.AdminConfig{RecentSends: 10},
+		DingTalk: config.DingTalkConfig{
+			Timeout: config.Duration(2 * time.Second),
+			Robots: []config.RobotConfig{
+				{Name: "good", Webhook: ok.URL, MsgType: "text"},
+				{Name: "broken", Webhook: bad.URL, MsgType: "markdown"},
+			},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"good", "broken"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	sends := sendlog.NewHistory()
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20, Sends: sends})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(`{"receiver":"ops","status":"firing","alerts":[{"status":"firing","labels":{"alertname":"DiskFull"}}]}`)))
+
+	list := sends.List()
+	if len(list) != 2 {
+		t.Fatalf("sends=%+v, want 2", list)
+	}
+	byRobot := map[string]sendlog.Send{}
+	for _, s := range list {
+		byRobot[s.Robot] = s
+	}
+	good, broken := byRobot["good"], byRobot["broken"]
+	if !good.OK || good.Source != "alert" || good.Receiver != "ops" || good.Channel != "default" || good.MsgType != "text" {
+		t.Fatalf("good=%+v", good)
+	}
+	if !strings.Contains(good.Preview, "告警触发") {
+		t.Fatalf("preview=%q, want rendered content", good.Preview)
+	}
+	if broken.OK || broken.MsgType != "markdown" || !strings.Contains(broken.Error, "300001") {
+		t.Fatalf("broken=%+v", broken)
+	}
+}
@@ -44,7 +44,7 @@ dingtalk:
 		t.Fatalf("LoadFromFile: %v", err)
 	}
 	store := runtime.NewStore(rt)
-	mgr, err := reload.New(nil, cfgPath, store, false, 2*time.Second)
+	mgr, err := reload.New(nil, cfgPath, store, false, reload.ModePoll, 2*time.Second)
 	if err != nil {
 		t.Fatalf("reload.New: %v", err)
 	}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_LogsAndReportsMatchedRoutes(t *testing.T) {
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{DebugResponse: true},
+		DingTalk: config.DingTalkConfig{
+			Timeout: config.Duration(2 * time.Second),
+			Robots:  []config.RobotConfig{{Name: "r1", Webhook: dt.URL, MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{
+				{Name: "default", Robots: []string{"r1"}},
+				{Name: "ops", Robots: []string{"r1"}},
+			},
+			Routes: []config.RouteConfig{
+				{Name: "all-ops", When: config.WhenConfig{Receiver: []string{"ops"}}, Channels: []string{"ops"}, Continue: true},
+				{Name: "critical", When: config.WhenConfig{Labels: map[string][]string{"severity": {"critical"}}}, Channels: []string{"default"}},
+			},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	h := NewHandler(HandlerOptions{Logger: logger, AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	body := `{"receiver":"ops","status":"firing","commonLabels":{"severity":"critical"},"alerts":[{"status":"firing","labels":{"severity":"critical"}}]}`
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	if !strings.Contains(logs.String(), `msg="routes matched"`) || !strings.Contains(logs.String(), "routes=\"[all-ops critical]\"") {
+		t.Fatalf("route names not logged: %s", logs.String())
+	}
+	var resp struct {
+		Routes []string `json:"routes"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if strings.Join(resp.Routes, ",") != "all-ops,critical" {
+		t.Fatalf("routes=%v", resp.Routes)
+	}
+}
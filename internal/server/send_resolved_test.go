@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_ChannelSendResolvedFalse(t *testing.T) {
+	var sent atomic.Int32
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	sendResolved := false
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout:  config.Duration(2 * time.Second),
+			Robots:   []config.RobotConfig{{Name: "r1", Webhook: dt.URL, MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}, SendResolved: &sendResolved}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	for _, tc := range []struct {
+		name string
+		body string
+		want int32
+	}{
+		{"all resolved", `{"status":"resolved","alerts":[{"status":"resolved"},{"status":"resolved"}]}`, 0},
+		{"mixed", `{"status":"firing","alerts":[{"status":"resolved"},{"status":"firing"}]}`, 1},
+		{"firing", `{"status":"firing","alerts":[{"status":"firing"}]}`, 1},
+	} {
+		sent.Store(0)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(tc.body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: status=%d body=%s", tc.name, rr.Code, rr.Body.String())
+		}
+		if got := sent.Load(); got != tc.want {
+			t.Fatalf("%s: sent=%d want %d", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_SendResults(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(ok.Close)
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"errcode":300001,"errmsg":"token is not exist"}`))
+	}))
+	t.Cleanup(bad.Close)
+
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout: config.Duration(2 * time.Second),
+			Robots: []config.RobotConfig{
+				{Name: "good", Webhook: ok.URL, MsgType: "text"},
+				{Name: "broken", Webhook: bad.URL, MsgType: "text"},
+			},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"good", "broken"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(`{"receiver":"default","status":"firing","alerts":[]}`)))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("status=%d want %d body=%s", rr.Code, http.StatusInternalServerError, rr.Body.String())
+	}
+
+	var resp struct {
+		Message string       `json:"message"`
+		Results []sendResult `json:"results"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if resp.Message != "partial send failure" {
+		t.Fatalf("message=%q", resp.Message)
+	}
+	if len(resp.Results) != 2 {
+		t.Fatalf("results=%+v", resp.Results)
+	}
+	if !resp.Results[0].OK || resp.Results[0].Robot != "good" {
+		t.Fatalf("results[0]=%+v", resp.Results[0])
+	}
+	if resp.Results[1].OK || resp.Results[1].Robot != "broken" || !strings.Contains(resp.Results[1].Error, "300001") {
+		t.Fatalf("results[1]=%+v", resp.Results[1])
+	}
+}
+
+func TestHandler_BestEffortResponseMode(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(ok.Close)
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"errcode":300001,"errmsg":"token is not exist"}`))
+	}))
+	t.Cleanup(bad.Close)
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{AlertResponseMode: "best_effort"},
+		DingTalk: config.DingTalkConfig{
+			Timeout: config.Duration(2 * time.Second),
+			Robots: []config.RobotConfig{
+				{Name: "good", Webhook: ok.URL, MsgType: "text"},
+				{Name: "broken", Webhook: bad.URL, MsgType: "text"},
+			},
+			Channels: []config.ChannelConfig{
+				{Name: "default", Robots: []string{"good", "broken"}},
+				{Name: "dead", Robots: []string{"broken"}},
+			},
+			Routes: []config.RouteConfig{
+				{Name: "dead", When: config.WhenConfig{Receiver: []string{"dead"}}, Channels: []string{"dead"}},
+			},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(`{"receiver":"default","status":"firing","alerts":[]}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("partial failure status=%d want %d body=%s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var resp struct {
+		Code    int          `json:"code"`
+		Message string       `json:"message"`
+		Results []sendResult `json:"results"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if resp.Code != 0 || resp.Message != "partial send failure" || len(resp.Results) != 2 || resp.Results[1].OK {
+		t.Fatalf("resp=%+v", resp)
+	}
+
+	// Nothing delivered: Alertmanager must still retry.
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(`{"receiver":"dead","status":"firing","alerts":[]}`)))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("total failure status=%d want %d body=%s", rr.Code, http.StatusInternalServerError, rr.Body.String())
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"net"
 	"net/http"
 	"time"
 
+	"prometheus-dingtalk-hook/internal/capture"
+	"prometheus-dingtalk-hook/internal/dedup"
 	"prometheus-dingtalk-hook/internal/reload"
 	"prometheus-dingtalk-hook/internal/runtime"
+	"prometheus-dingtalk-hook/internal/sendlog"
 )
 
 var ErrServerClosed = http.ErrServerClosed
@@ -18,6 +22,7 @@ type Options struct {
 	Logger       *slog.Logger
 	ListenAddr   string
 	AlertPath    string
+	StrictPath   bool
 	AdminPrefix  string
 	AdminHandler http.Handler
 	State        *runtime.Store
@@ -26,11 +31,28 @@ type Options struct {
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
 	MaxBodyBytes int64
+	Capture      *capture.Buffer
+	SendLog      *sendlog.Log
+	Sends        *sendlog.History
+	Dedup        *dedup.Cache
+	Dispatcher   *Dispatcher
+
+	// TLSCertFile and TLSKeyFile switch the listener to HTTPS. The certificate
+	// itself is taken from the current runtime, see newTLSConfig.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TelemetryListen, when set, moves /healthz, /readyz and /metrics to a
+	// separate plain-HTTP listener so they can stay on a private address.
+	TelemetryListen string
 }
 
 type Server struct {
 	logger *slog.Logger
 	srv    *http.Server
+	tls    bool
+	// telemetry serves Options.TelemetryListen; nil when not configured.
+	telemetry *http.Server
 }
 
 func New(opts Options) *Server {
@@ -41,14 +63,21 @@ func New(opts Options) *Server {
 	handler := NewHandler(HandlerOptions{
 		Logger:       opts.Logger,
 		AlertPath:    opts.AlertPath,
+		StrictPath:   opts.StrictPath,
 		AdminPrefix:  opts.AdminPrefix,
 		AdminHandler: opts.AdminHandler,
 		State:        opts.State,
 		Reload:       opts.Reload,
 		MaxBodyBytes: opts.MaxBodyBytes,
+		Capture:      opts.Capture,
+		SendLog:      opts.SendLog,
+		Sends:        opts.Sends,
+		Dedup:        opts.Dedup,
+		Dispatcher:   opts.Dispatcher,
+		NoTelemetry:  opts.TelemetryListen != "",
 	})
 
-	return &Server{
+	s := &Server{
 		logger: opts.Logger,
 		srv: &http.Server{
 			Addr:         opts.ListenAddr,
@@ -58,15 +87,60 @@ func New(opts Options) *Server {
 			IdleTimeout:  opts.IdleTimeout,
 		},
 	}
+	if opts.Dispatcher != nil {
+		s.srv.RegisterOnShutdown(opts.Dispatcher.beginDrain)
+	}
+	if opts.TLSCertFile != "" && opts.TLSKeyFile != "" {
+		s.tls = true
+		s.srv.TLSConfig = newTLSConfig(opts.State)
+	}
+	if opts.TelemetryListen != "" {
+		s.telemetry = &http.Server{
+			Addr:         opts.TelemetryListen,
+			Handler:      NewTelemetryHandler(opts.State),
+			ReadTimeout:  opts.ReadTimeout,
+			WriteTimeout: opts.WriteTimeout,
+			IdleTimeout:  opts.IdleTimeout,
+		}
+	}
+	return s
 }
 
+// ListenAndServe serves until Shutdown. The telemetry listener, if any, is
+// bound first so that an unusable address fails startup like the main one.
 func (s *Server) ListenAndServe() error {
-	if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	if s.telemetry != nil {
+		ln, err := net.Listen("tcp", s.telemetry.Addr)
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := s.telemetry.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.logger.Error("telemetry server error", "err", err)
+			}
+		}()
+	}
+
+	var err error
+	if s.tls {
+		err = s.srv.ListenAndServeTLS("", "")
+	} else {
+		err = s.srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if s.telemetry != nil {
+			_ = s.telemetry.Close()
+		}
 		return err
 	}
 	return http.ErrServerClosed
 }
 
+// Shutdown gracefully stops both listeners.
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.srv.Shutdown(ctx)
+	err := s.srv.Shutdown(ctx)
+	if s.telemetry != nil {
+		err = errors.Join(err, s.telemetry.Shutdown(ctx))
+	}
+	return err
 }
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_SharedRobotMention(t *testing.T) {
+	var mu sync.Mutex
+	var sent [][]string
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			At struct {
+				AtUserIds []string `json:"atUserIds"`
+			} `json:"at"`
+		}
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &payload)
+		mu.Lock()
+		sent = append(sent, payload.At.AtUserIds)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	newHandler := func(mode string) http.Handler {
+		cfg := &config.Config{
+			DingTalk: config.DingTalkConfig{
+				Timeout:            config.Duration(2 * time.Second),
+				SharedRobotMention: mode,
+				Robots:             []config.RobotConfig{{Name: "shared", Webhook: dt.URL, MsgType: "markdown"}},
+				Channels: []config.ChannelConfig{
+					{Name: "default", Robots: []string{"shared"}},
+					{Name: "ops", Robots: []string{"shared"}, Mention: config.MentionConfig{AtUserIds: []string{"ops-oncall"}}},
+					{Name: "dba", Robots: []string{"shared"}, Mention: config.MentionConfig{AtUserIds: []string{"dba-oncall", "ops-oncall"}}},
+				},
+				Routes: []config.RouteConfig{
+					{Name: "ops", When: config.WhenConfig{Receiver: []string{"db"}}, Channels: []string{"ops"}, Continue: true},
+					{Name: "dba", When: config.WhenConfig{Receiver: []string{"db"}}, Channels: []string{"dba"}},
+				},
+			},
+		}
+		rt, err := runtime.Build(nil, "", "", cfg)
+		if err != nil {
+			t.Fatalf("runtime.Build: %v", err)
+		}
+		return NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+	}
+	post := func(h http.Handler) []sendResult {
+		t.Helper()
+		mu.Lock()
+		sent = nil
+		mu.Unlock()
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(`{"receiver":"db","status":"firing","alerts":[{"status":"firing"}]}`)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		var resp struct {
+			Results []sendResult `json:"results"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("json: %v", err)
+		}
+		return resp.Results
+	}
+
+	post(newHandler("separate"))
+	if len(sent) != 2 {
+		t.Fatalf("separate: sent=%v want 2 messages", sent)
+	}
+
+	results := post(newHandler("merge"))
+	if len(sent) != 1 || strings.Join(sent[0], ",") != "ops-oncall,dba-oncall" {
+		t.Fatalf("merge: sent=%v want one message mentioning both", sent)
+	}
+	if len(results) != 2 || !results[0].OK || !results[1].OK || results[1].MergedInto != "ops" {
+		t.Fatalf("merge: results=%+v", results)
+	}
+}
+
+func TestHandler_SharedRobotMergeKeepsDifferentMessages(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Markdown struct {
+				Text string `json:"text"`
+			} `json:"markdown"`
+		}
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &payload)
+		mu.Lock()
+		sent = append(sent, strings.TrimSpace(payload.Markdown.Text))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	dir := t.TempDir()
+	for name, body := range map[string]string{"ops.tmpl": "ops view", "dba.tmpl": "dba view"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	cfg := &config.Config{
+		Template: config.TemplateConfig{Dir: dir},
+		DingTalk: config.DingTalkConfig{
+			Timeout:            config.Duration(2 * time.Second),
+			SharedRobotMention: "merge",
+			Robots:             []config.RobotConfig{{Name: "shared", Webhook: dt.URL, MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{
+				{Name: "default", Robots: []string{"shared"}},
+				{Name: "ops", Robots: []string{"shared"}, Template: "ops"},
+				{Name: "dba", Robots: []string{"shared"}, Template: "dba"},
+			},
+			Routes: []config.RouteConfig{
+				{Name: "ops", When: config.WhenConfig{Receiver: []string{"db"}}, Channels: []string{"ops"}, Continue: true},
+				{Name: "dba", When: config.WhenConfig{Receiver: []string{"db"}}, Channels: []string{"dba"}},
+			},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(`{"receiver":"db","status":"firing","alerts":[{"status":"firing"}]}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Results []sendResult `json:"results"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	for _, res := range resp.Results {
+		if res.MergedInto != "" {
+			t.Fatalf("results=%+v, want no merge", resp.Results)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	slices.Sort(sent)
+	if strings.Join(sent, "|") != "dba view|ops view" {
+		t.Fatalf("sent=%q want both channels' messages", sent)
+	}
+}
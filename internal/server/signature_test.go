@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func newSignatureHandler(t *testing.T, auth config.AuthConfig) http.Handler {
+	t.Helper()
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	cfg := &config.Config{
+		Auth: auth,
+		DingTalk: config.DingTalkConfig{
+			Timeout:  config.Duration(2 * time.Second),
+			Robots:   []config.RobotConfig{{Name: "default", Webhook: dt.URL, MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"default"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	return NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+}
+
+func TestHandler_SignatureAuth(t *testing.T) {
+	body := []byte(`{"receiver":"default","status":"firing","alerts":[]}`)
+	// printf '%s' "$body" | openssl dgst -sha256 -hmac s3cret
+	const goodSig = "941eb27d87357e0e749512a041cb41d34d457bfe1aeb7f798c5185b869f0a13f"
+
+	send := func(h http.Handler, headers map[string]string) int {
+		req := httptest.NewRequest(http.MethodPost, "/alert", bytes.NewReader(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	sigOnly := newSignatureHandler(t, config.AuthConfig{HMACSecret: "s3cret"})
+	for name, tc := range map[string]struct {
+		headers map[string]string
+		want    int
+	}{
+		"good":     {map[string]string{"X-Signature": goodSig}, http.StatusOK},
+		"prefixed": {map[string]string{"X-Signature": "sha256=" + goodSig}, http.StatusOK},
+		"missing":  {nil, http.StatusUnauthorized},
+		"wrong":    {map[string]string{"X-Signature": "00" + goodSig[2:]}, http.StatusUnauthorized},
+		"not hex":  {map[string]string{"X-Signature": "zz"}, http.StatusUnauthorized},
+	} {
+		if got := send(sigOnly, tc.headers); got != tc.want {
+			t.Fatalf("%s: status=%d want %d", name, got, tc.want)
+		}
+	}
+
+	either := newSignatureHandler(t, config.AuthConfig{Token: "t", HMACSecret: "s3cret"})
+	if got := send(either, map[string]string{"X-Token": "t"}); got != http.StatusOK {
+		t.Fatalf("either/token: status=%d", got)
+	}
+	if got := send(either, map[string]string{"X-Signature": goodSig}); got != http.StatusOK {
+		t.Fatalf("either/signature: status=%d", got)
+	}
+	if got := send(either, map[string]string{"X-Token": "bad"}); got != http.StatusUnauthorized {
+		t.Fatalf("either/bad token: status=%d", got)
+	}
+
+	both := newSignatureHandler(t, config.AuthConfig{Token: "t", HMACSecret: "s3cret", RequireAll: true})
+	if got := send(both, map[string]string{"X-Token": "t"}); got != http.StatusUnauthorized {
+		t.Fatalf("both/token only: status=%d", got)
+	}
+	if got := send(both, map[string]string{"X-Signature": goodSig}); got != http.StatusUnauthorized {
+		t.Fatalf("both/signature only: status=%d", got)
+	}
+	if got := send(both, map[string]string{"X-Token": "t", "X-Signature": goodSig}); got != http.StatusOK {
+		t.Fatalf("both: status=%d", got)
+	}
+}
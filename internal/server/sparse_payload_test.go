@@ -0,0 +1,52 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_SparsePayloadsNeverFail(t *testing.T) {
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout: config.Duration(2 * time.Second),
+			Robots: []config.RobotConfig{
+				{Name: "md", Webhook: dt.URL, MsgType: "markdown"},
+				{Name: "text", Webhook: dt.URL, MsgType: "text"},
+			},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"md", "text"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	for _, body := range []string{
+		`{}`,
+		`{"alerts":null}`,
+		`{"status":"firing","alerts":[{}]}`,
+		`{"status":"firing","commonLabels":null,"commonAnnotations":null,"alerts":[{"labels":null,"annotations":null}]}`,
+		`{"status":"firing","alerts":[{"status":"firing","labels":{"alertname":"A"},"startsAt":"2024-05-01T16:30:00.123456789Z"}]}`,
+		`{"status":"resolved","alerts":[{"status":"resolved","startsAt":"2024-05-01T16:30:00Z","endsAt":""}]}`,
+		`{"status":"resolved","alerts":[{"status":"resolved","endsAt":null},{"status":"firing"}]}`,
+	} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", bytes.NewReader([]byte(body))))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("body=%s status=%d resp=%s", body, rr.Code, rr.Body.String())
+		}
+	}
+}
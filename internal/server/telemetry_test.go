@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	return addr
+}
+
+func TestServer_TelemetryListener(t *testing.T) {
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout:  config.Duration(2 * time.Second),
+			Robots:   []config.RobotConfig{{Name: "r1", Webhook: "http://127.0.0.1:1", MsgType: "markdown"}},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	mainAddr, telemetryAddr := freeAddr(t), freeAddr(t)
+	srv := New(Options{
+		ListenAddr:      mainAddr,
+		AlertPath:       "/alert",
+		AdminPrefix:     "/admin",
+		AdminHandler:    http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("admin")) }),
+		State:           runtime.NewStore(rt),
+		MaxBodyBytes:    1 << 20,
+		TelemetryListen: telemetryAddr,
+	})
+	done := make(chan error, 1)
+	go func() { done <- srv.ListenAndServe() }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown: %v", err)
+		}
+		if err := <-done; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("ListenAndServe: %v", err)
+		}
+	})
+
+	get := func(addr, path string) int {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			resp, err := http.Get("http://" + addr + path)
+			if err == nil {
+				resp.Body.Close()
+				return resp.StatusCode
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("GET %s%s: %v", addr, path, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	for _, path := range []string{"/healthz", "/readyz", "/metrics"} {
+		if code := get(telemetryAddr, path); code != http.StatusOK {
+			t.Fatalf("telemetry %s status=%d", path, code)
+		}
+		if code := get(mainAddr, path); code != http.StatusNotFound {
+			t.Fatalf("main %s status=%d, want 404", path, code)
+		}
+	}
+	if code := get(telemetryAddr, "/admin/"); code != http.StatusNotFound {
+		t.Fatalf("telemetry /admin/ status=%d, want 404", code)
+	}
+	if code := get(mainAddr, "/admin/"); code != http.StatusOK {
+		t.Fatalf("main /admin/ status=%d", code)
+	}
+
+	resp, err := http.Post("http://"+mainAddr+"/alert", "application/json", strings.NewReader(`{`))
+	if err != nil {
+		t.Fatalf("POST /alert: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("main /alert status=%d, want 400 from the alert handler", resp.StatusCode)
+	}
+	resp, err = http.Post("http://"+telemetryAddr+"/alert", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("POST telemetry /alert: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("telemetry /alert status=%d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_TextTitleFirstLine(t *testing.T) {
+	var mu sync.Mutex
+	var texts []string
+	var markdowns []string
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			MsgType string `json:"msgtype"`
+			Text    struct {
+				Content string `json:"content"`
+			} `json:"text"`
+			Markdown struct {
+				Text string `json:"text"`
+			} `json:"markdown"`
+		}
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &payload)
+		mu.Lock()
+		switch payload.MsgType {
+		case "text":
+			texts = append(texts, payload.Text.Content)
+		case "markdown":
+			markdowns = append(markdowns, payload.Markdown.Text)
+		}
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	cfg := &config.Config{
+		Template: config.TemplateConfig{TextTitle: "[{{ .Payload.Status | upper }}]\n{{ .Payload.CommonLabels.alertname }}"},
+		DingTalk: config.DingTalkConfig{
+			Timeout: config.Duration(2 * time.Second),
+			Robots: []config.RobotConfig{
+				{Name: "text", Webhook: dt.URL + "?robot=text", MsgType: "text"},
+				{Name: "md", Webhook: dt.URL + "?robot=md", MsgType: "markdown"},
+			},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"text", "md"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	body := `{"receiver":"default","status":"firing","commonLabels":{"alertname":"DiskFull"},
+		"alerts":[{"status":"firing","labels":{"alertname":"DiskFull"}}]}`
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(texts) != 1 || len(markdowns) != 1 {
+		t.Fatalf("texts=%q markdowns=%q", texts, markdowns)
+	}
+	first, rest, _ := strings.Cut(texts[0], "\n")
+	if first != "[FIRING] DiskFull" || strings.TrimSpace(rest) == "" {
+		t.Fatalf("text content=%q", texts[0])
+	}
+	if strings.Contains(markdowns[0], "[FIRING]") {
+		t.Fatalf("markdown got the text title: %q", markdowns[0])
+	}
+}
+
+func TestHandler_TextTitleSkippedWithoutTextRobot(t *testing.T) {
+	var mu sync.Mutex
+	var sent int
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sent++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	// The title template fails at execution; a channel with only markdown
+	// robots never renders it and must still send.
+	cfg := &config.Config{
+		Template: config.TemplateConfig{TextTitle: "{{ .NoSuchField }}"},
+		DingTalk: config.DingTalkConfig{
+			Timeout: config.Duration(2 * time.Second),
+			Robots: []config.RobotConfig{
+				{Name: "md", Webhook: dt.URL + "?robot=md", MsgType: "markdown"},
+			},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"md"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	body := `{"receiver":"default","status":"firing","alerts":[{"status":"firing","labels":{"alertname":"DiskFull"}}]}`
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if sent != 1 {
+		t.Fatalf("sent=%d, want 1", sent)
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+// newTLSConfig resolves the certificate, client CAs, minimum version and
+// cipher suites from the current runtime on every handshake, so a reload
+// swaps them without a restart. The per-handshake config replaces the one
+// net/http prepared, so it offers h2 over ALPN itself.
+func newTLSConfig(state *runtime.Store) *tls.Config {
+	nextProtos := []string{"h2", "http/1.1"}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			rt := state.Load()
+			if rt == nil || rt.TLSCertificate == nil {
+				return nil, errors.New("tls certificate is not configured")
+			}
+			cert := rt.TLSCertificate
+			cfg := &tls.Config{
+				MinVersion:   rt.TLSMinVersion,
+				CipherSuites: rt.TLSCipherSuites,
+				NextProtos:   nextProtos,
+				GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+					return cert, nil
+				},
+			}
+			if rt.ClientCAs != nil {
+				cfg.ClientCAs = rt.ClientCAs
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return cfg, nil
+		},
+	}
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func writeSelfSigned(t *testing.T, dir, name, cn string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey: %v", err)
+	}
+	certPath := filepath.Join(dir, name+".crt")
+	keyPath := filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return certPath, keyPath
+}
+
+func TestTLSConfig_PicksUpReloadedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	build := func(cn string) *runtime.Runtime {
+		certPath, keyPath := writeSelfSigned(t, dir, cn, cn)
+		cfg := &config.Config{
+			Server: config.ServerConfig{TLSCertFile: certPath, TLSKeyFile: keyPath},
+			DingTalk: config.DingTalkConfig{
+				Robots:   []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "text"}},
+				Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+			},
+		}
+		rt, err := runtime.Build(nil, "", "", cfg)
+		if err != nil {
+			t.Fatalf("runtime.Build: %v", err)
+		}
+		return rt
+	}
+
+	store := runtime.NewStore(build("first"))
+	ts := httptest.NewUnstartedServer(NewHandler(HandlerOptions{State: store, MaxBodyBytes: 1 << 20}))
+	ts.TLS = newTLSConfig(store)
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+
+	peerCN := func() string {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+			ForceAttemptHTTP2: true,
+		}}
+		resp, err := client.Get(ts.URL + "/healthz")
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.Proto != "HTTP/2.0" {
+			t.Fatalf("proto=%s want HTTP/2.0", resp.Proto)
+		}
+		return resp.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	if cn := peerCN(); cn != "first" {
+		t.Fatalf("cn=%q want %q", cn, "first")
+	}
+	store.Store(build("second"))
+	if cn := peerCN(); cn != "second" {
+		t.Fatalf("cn=%q want %q after reload", cn, "second")
+	}
+}
+
+func TestTLSConfig_MinVersionAndCipherSuites(t *testing.T) {
+	certPath, keyPath := writeSelfSigned(t, t.TempDir(), "hook", "hook")
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			TLSCertFile:     certPath,
+			TLSKeyFile:      keyPath,
+			TLSMinVersion:   "1.2",
+			TLSCipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"},
+		},
+		DingTalk: config.DingTalkConfig{
+			Robots:   []config.RobotConfig{{Name: "r1", Webhook: "http://example.invalid", MsgType: "text"}},
+			Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	store := runtime.NewStore(rt)
+
+	got, err := newTLSConfig(store).GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("GetConfigForClient: %v", err)
+	}
+	if got.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("MinVersion=%x want %x", got.MinVersion, tls.VersionTLS12)
+	}
+	if len(got.CipherSuites) != 1 || got.CipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 {
+		t.Fatalf("CipherSuites=%v", got.CipherSuites)
+	}
+
+	ts := httptest.NewUnstartedServer(NewHandler(HandlerOptions{State: store, MaxBodyBytes: 1 << 20}))
+	ts.TLS = newTLSConfig(store)
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	get := func(client *tls.Config) error {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: client, DisableKeepAlives: true}}
+		resp, err := c.Get(ts.URL + "/healthz")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	if err := get(&tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12}); err != nil {
+		t.Fatalf("allowed suite: %v", err)
+	}
+	other := &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+		CipherSuites:       []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	}
+	if err := get(other); err == nil {
+		t.Fatalf("handshake with a suite outside tls_cipher_suites succeeded")
+	}
+
+	cfg.Server.TLSMinVersion = "1.3"
+	cfg.Server.TLSCipherSuites = nil
+	rt, err = runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	store.Store(rt)
+	if err := get(&tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12}); err == nil {
+		t.Fatalf("TLS 1.2 handshake succeeded with tls_min_version 1.3")
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_TolerantJSON(t *testing.T) {
+	var sent []string
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		sent = append(sent, string(b))
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	newHandler := func(tolerant bool) http.Handler {
+		cfg := &config.Config{
+			Server: config.ServerConfig{TolerantJSON: tolerant},
+			DingTalk: config.DingTalkConfig{
+				Timeout:  config.Duration(2 * time.Second),
+				Robots:   []config.RobotConfig{{Name: "r1", Webhook: dt.URL, MsgType: "text"}},
+				Channels: []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+			},
+		}
+		rt, err := runtime.Build(nil, "", "", cfg)
+		if err != nil {
+			t.Fatalf("runtime.Build: %v", err)
+		}
+		return NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+	}
+
+	body := `{"receiver":"default","status":"firing","alerts":[
+		{"status":"firing","annotations":{"summary":"good alert"}},
+		{"status":"firing","startsAt":"not-a-time","annotations":{"summary":"bad alert"}}
+	]}`
+
+	{
+		rr := httptest.NewRecorder()
+		newHandler(false).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("strict status=%d want %d", rr.Code, http.StatusBadRequest)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	newHandler(true).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("tolerant status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if resp["skipped_alerts"] != float64(1) {
+		t.Fatalf("skipped_alerts=%v want 1", resp["skipped_alerts"])
+	}
+	if len(sent) != 1 {
+		t.Fatalf("sent=%d want 1", len(sent))
+	}
+	if !strings.Contains(sent[0], "good alert") || strings.Contains(sent[0], "bad alert") {
+		t.Fatalf("unexpected message: %s", sent[0])
+	}
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"prometheus-dingtalk-hook/internal/config"
+	"prometheus-dingtalk-hook/internal/runtime"
+)
+
+func TestHandler_TruncatesLongMessages(t *testing.T) {
+	var sent []string
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Markdown struct {
+				Text string `json:"text"`
+			} `json:"markdown"`
+		}
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &payload)
+		sent = append(sent, payload.Markdown.Text)
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout:         config.Duration(2 * time.Second),
+			MaxMessageBytes: 1000,
+			Robots:          []config.RobotConfig{{Name: "r1", Webhook: dt.URL, MsgType: "markdown"}},
+			Channels:        []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	h := NewHandler(HandlerOptions{AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	var alerts []string
+	for i := 0; i < 20; i++ {
+		alerts = append(alerts, fmt.Sprintf(`{"status":"firing","annotations":{"summary":"磁盘告警 %d","description":"%s"}}`, i, strings.Repeat("描述", 20)))
+	}
+	body := `{"receiver":"default","status":"firing","alerts":[` + strings.Join(alerts, ",") + `]}`
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", bytes.NewReader([]byte(body))))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Results []sendResult `json:"results"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if len(resp.Results) != 1 || !resp.Results[0].Truncated {
+		t.Fatalf("results=%+v want truncated", resp.Results)
+	}
+	if len(sent) != 1 {
+		t.Fatalf("sent=%d", len(sent))
+	}
+	got := sent[0]
+	if len(got) > 1000 || !utf8.ValidString(got) {
+		t.Fatalf("len=%d valid=%v", len(got), utf8.ValidString(got))
+	}
+	if !strings.Contains(got, "磁盘告警 0") || strings.Contains(got, "磁盘告警 19") {
+		t.Fatalf("later alerts should be dropped first: %q", got)
+	}
+	if !strings.Contains(got, "alerts omitted)") {
+		t.Fatalf("missing truncation notice: %q", got)
+	}
+}
+
+func TestHandler_WarnsAboveSoftMessageSize(t *testing.T) {
+	dt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	t.Cleanup(dt.Close)
+
+	cfg := &config.Config{
+		DingTalk: config.DingTalkConfig{
+			Timeout:          config.Duration(2 * time.Second),
+			MaxMessageBytes:  20000,
+			WarnMessageBytes: 500,
+			Robots:           []config.RobotConfig{{Name: "r1", Webhook: dt.URL, MsgType: "markdown"}},
+			Channels:         []config.ChannelConfig{{Name: "default", Robots: []string{"r1"}}},
+		},
+	}
+	rt, err := runtime.Build(nil, "", "", cfg)
+	if err != nil {
+		t.Fatalf("runtime.Build: %v", err)
+	}
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	h := NewHandler(HandlerOptions{Logger: logger, AlertPath: "/alert", State: runtime.NewStore(rt), MaxBodyBytes: 1 << 20})
+
+	post := func(description string) {
+		t.Helper()
+		logs.Reset()
+		body := `{"receiver":"default","status":"firing","alerts":[{"status":"firing","annotations":{"summary":"disk","description":"` + description + `"}}]}`
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%s", rr.Code, rr.Body.String())
+		}
+	}
+
+	post("short")
+	if strings.Contains(logs.String(), "warn_message_bytes") {
+		t.Fatalf("warned below the threshold:\n%s", logs.String())
+	}
+
+	post(strings.Repeat("x", 600))
+	if !strings.Contains(logs.String(), "message exceeds dingtalk.warn_message_bytes") {
+		t.Fatalf("no warning past the threshold:\n%s", logs.String())
+	}
+	if strings.Contains(logs.String(), "message truncated") {
+		t.Fatalf("message under max_message_bytes was truncated:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,57 @@
+package template
+
+import (
+	"strings"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+)
+
+// coalesceFlapping keeps one entry per alert when a batch carries both a
+// firing and a resolved entry for it: the one with the latest event, its
+// EndsAt when resolved and its StartsAt when firing, or the later one in
+// the batch on a tie. Alerts are identified by fingerprint, or by their
+// labels when the payload has none. The kept entry takes the position of
+// the first one, and the payload status follows the remaining alerts.
+func coalesceFlapping(payload alertmanager.WebhookMessage) alertmanager.WebhookMessage {
+	index := make(map[string]int, len(payload.Alerts))
+	alerts := make([]alertmanager.Alert, 0, len(payload.Alerts))
+	for _, a := range payload.Alerts {
+		key := alertKey(a)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(alerts)
+			alerts = append(alerts, a)
+			continue
+		}
+		if !eventTime(a).Before(eventTime(alerts[i])) {
+			alerts[i] = a
+		}
+	}
+	if len(alerts) == len(payload.Alerts) {
+		return payload
+	}
+
+	payload.Alerts = alerts
+	if strings.EqualFold(payload.Status, "firing") {
+		firing, _ := splitStatus(alerts)
+		if len(firing) == 0 {
+			payload.Status = "resolved"
+		}
+	}
+	return payload
+}
+
+func alertKey(a alertmanager.Alert) string {
+	if fp := strings.TrimSpace(a.Fingerprint); fp != "" {
+		return fp
+	}
+	return "\xff" + formatKV(a.Labels)
+}
+
+func eventTime(a alertmanager.Alert) time.Time {
+	if strings.EqualFold(a.Status, "resolved") {
+		return a.EndsAt
+	}
+	return a.StartsAt
+}
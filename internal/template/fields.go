@@ -0,0 +1,86 @@
+package template
+
+import (
+	"strings"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+)
+
+var (
+	// defaultLabelFields and defaultAnnotationFields are what the default
+	// template shows when template.label_fields and annotation_fields are
+	// not set.
+	defaultLabelFields      = []string{"severity"}
+	defaultAnnotationFields = []string{"description", "summary"}
+
+	// fieldTitles are the display names of the fields shown by default.
+	fieldTitles = map[string]string{
+		"severity":    "严重度",
+		"description": "描述",
+		"summary":     "摘要",
+	}
+)
+
+// Field is one label or annotation of an alert as shown by the default
+// template.
+type Field struct {
+	Name  string
+	Title string
+	Value string
+	// Label is true for labels, which the default template shows as code.
+	Label bool
+}
+
+// Fields returns the LabelFields and then the AnnotationFields of a, in
+// configured order. Values missing on the alert fall back to the common
+// labels and annotations. The fields shown by default keep their
+// placeholders ("unknown" severity, "-" text) when missing everywhere;
+// other fields are left out.
+func (d RenderData) Fields(a alertmanager.Alert) []Field {
+	out := make([]Field, 0, len(d.LabelFields)+len(d.AnnotationFields))
+	for _, name := range d.LabelFields {
+		value := firstNonEmpty(a.Labels[name], d.Payload.CommonLabels[name])
+		if name == "severity" {
+			value = firstNonEmpty(value, a.Labels["level"], d.Payload.CommonLabels["level"], "unknown")
+		}
+		if f, ok := newField(name, value, true); ok {
+			out = append(out, f)
+		}
+	}
+	for _, name := range d.AnnotationFields {
+		value := firstNonEmpty(a.Annotations[name], d.Payload.CommonAnnotations[name])
+		if value == "" && fieldTitles[name] != "" {
+			value = "-"
+		}
+		if f, ok := newField(name, value, false); ok {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// CommonFields is Fields for a payload without alerts, from the common
+// labels and annotations only.
+func (d RenderData) CommonFields() []Field {
+	return d.Fields(alertmanager.Alert{})
+}
+
+func newField(name, value string, label bool) (Field, bool) {
+	if value == "" {
+		return Field{}, false
+	}
+	title := fieldTitles[name]
+	if title == "" {
+		title = name
+	}
+	return Field{Name: name, Title: title, Value: value, Label: label}, true
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
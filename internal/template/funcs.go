@@ -0,0 +1,302 @@
+package template
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Humanizing helpers modelled on the Prometheus template functions. They
+// accept numbers or numeric strings such as label values; anything else is
+// returned unchanged so a template never fails on an unexpected value.
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		if err != nil {
+			return 0, false
+		}
+		return f, true
+	default:
+		return 0, false
+	}
+}
+
+func original(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// humanize formats v with SI prefixes, e.g. 1234567 -> "1.235M", 0.002 -> "2m".
+func humanize(v any) string {
+	f, ok := toFloat(v)
+	if !ok {
+		return original(v)
+	}
+	if f == 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Sprintf("%.4g", f)
+	}
+	if math.Abs(f) >= 1 {
+		prefix := ""
+		for _, p := range []string{"k", "M", "G", "T", "P", "E", "Z", "Y"} {
+			if math.Abs(f) < 1000 {
+				break
+			}
+			prefix = p
+			f /= 1000
+		}
+		return fmt.Sprintf("%.4g%s", f, prefix)
+	}
+	prefix := ""
+	for _, p := range []string{"m", "u", "n", "p", "f", "a", "z", "y"} {
+		if math.Abs(f) >= 1 {
+			break
+		}
+		prefix = p
+		f *= 1000
+	}
+	return fmt.Sprintf("%.4g%s", f, prefix)
+}
+
+// humanizeBytes formats v bytes with binary prefixes, e.g. 10737418240 -> "10GiB".
+func humanizeBytes(v any) string {
+	f, ok := toFloat(v)
+	if !ok {
+		return original(v)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Sprintf("%.4g", f)
+	}
+	unit := "B"
+	for _, u := range []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB", "ZiB", "YiB"} {
+		if math.Abs(f) < 1024 {
+			break
+		}
+		unit = u
+		f /= 1024
+	}
+	return fmt.Sprintf("%.4g%s", f, unit)
+}
+
+// humanizeDuration formats v seconds, e.g. 3723 -> "1h2m3s", 0.25 -> "250ms".
+func humanizeDuration(v any) string {
+	f, ok := toFloat(v)
+	if !ok {
+		return original(v)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Sprintf("%.4g", f)
+	}
+	if f == 0 {
+		return "0s"
+	}
+	sign := ""
+	if f < 0 {
+		sign = "-"
+		f = -f
+	}
+	if f < 1 {
+		for _, u := range []string{"ms", "us", "ns", "ps"} {
+			f *= 1000
+			if f >= 1 {
+				return fmt.Sprintf("%s%.4g%s", sign, f, u)
+			}
+		}
+		return fmt.Sprintf("%s%.4gps", sign, f)
+	}
+
+	total := int64(f)
+	days := total / 86400
+	hours := total / 3600 % 24
+	minutes := total / 60 % 60
+	seconds := total % 60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%s%dd%dh%dm%ds", sign, days, hours, minutes, seconds)
+	case hours > 0:
+		return fmt.Sprintf("%s%dh%dm%ds", sign, hours, minutes, seconds)
+	case minutes > 0:
+		return fmt.Sprintf("%s%dm%ds", sign, minutes, seconds)
+	default:
+		return fmt.Sprintf("%s%ds", sign, seconds)
+	}
+}
+
+// toTime accepts a time.Time or an RFC 3339 string such as a label value.
+func toTime(v any) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case *time.Time:
+		if t == nil {
+			return time.Time{}, false
+		}
+		return *t, true
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(t))
+		if err != nil {
+			return time.Time{}, false
+		}
+		return parsed, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// toLocalIn returns the toLocal function converting times to loc.
+func toLocalIn(loc *time.Location) func(any) any {
+	if loc == nil {
+		loc = time.Local
+	}
+	return func(v any) any {
+		t, ok := toTime(v)
+		if !ok {
+			return v
+		}
+		return t.In(loc)
+	}
+}
+
+// DefaultTimeFormat is the layout of localTime when template.time_format is
+// not set.
+const DefaultTimeFormat = "2006-01-02 15:04:05"
+
+// localTimeIn returns the localTime function, which converts a time to loc
+// and formats it with layout: {{ .StartsAt | localTime }}.
+func localTimeIn(loc *time.Location, layout string) func(any) string {
+	toLocal := toLocalIn(loc)
+	if layout == "" {
+		layout = DefaultTimeFormat
+	}
+	return func(v any) string {
+		return formatTime(layout, toLocal(v))
+	}
+}
+
+// tz converts v to the named IANA zone, e.g. {{ .StartsAt | tz "Asia/Shanghai" }}.
+func tz(name string, v any) (any, error) {
+	loc, err := time.LoadLocation(strings.TrimSpace(name))
+	if err != nil {
+		return nil, fmt.Errorf("tz: %w", err)
+	}
+	return toLocalIn(loc)(v), nil
+}
+
+// formatTime formats v with a Go layout in its current location; the zero
+// time (e.g. EndsAt of a firing alert) formats as an empty string.
+func formatTime(layout string, v any) string {
+	t, ok := toTime(v)
+	if !ok {
+		return original(v)
+	}
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+// markdownSpecial holds the characters DingTalk markdown gives meaning to.
+const markdownSpecial = "\\`*_#[]()<>~|"
+
+// escapeMarkdown backslash-escapes markdown characters in s so label and
+// annotation values render literally. Characters that are already escaped
+// are kept as is, so escaping twice does not stack backslashes.
+func escapeMarkdown(v any) string {
+	s := original(v)
+	var b strings.Builder
+	b.Grow(len(s))
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\\' {
+			if i+1 < len(runes) && strings.ContainsRune(markdownSpecial, runes[i+1]) {
+				b.WriteRune(r)
+				b.WriteRune(runes[i+1])
+				i++
+				continue
+			}
+			b.WriteString(`\\`)
+			continue
+		}
+		if strings.ContainsRune(markdownSpecial, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// String helpers, a curated subset of the Sprig functions with the same
+// argument order so the piped value comes last. Nothing here touches the
+// filesystem, environment or processes.
+func stringFuncs() map[string]any {
+	return map[string]any{
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"title":      title,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       join,
+	}
+}
+
+// title upper-cases the first letter of each space-separated word.
+func title(s string) string {
+	runes := []rune(s)
+	start := true
+	for i, r := range runes {
+		if unicode.IsSpace(r) {
+			start = true
+			continue
+		}
+		if start {
+			runes[i] = unicode.ToUpper(r)
+			start = false
+		}
+	}
+	return string(runes)
+}
+
+// join joins the elements of a string or generic slice with sep.
+func join(sep string, v any) string {
+	switch list := v.(type) {
+	case []string:
+		return strings.Join(list, sep)
+	case []any:
+		parts := make([]string, 0, len(list))
+		for _, e := range list {
+			parts = append(parts, original(e))
+		}
+		return strings.Join(parts, sep)
+	default:
+		return original(v)
+	}
+}
@@ -0,0 +1,209 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/config"
+)
+
+func TestHumanizeFuncs(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(any) string
+		in   any
+		want string
+	}{
+		{"humanize zero", humanize, 0, "0"},
+		{"humanize kilo", humanize, 1234, "1.234k"},
+		{"humanize mega string", humanize, "2500000", "2.5M"},
+		{"humanize negative", humanize, -1500, "-1.5k"},
+		{"humanize milli", humanize, 0.002, "2m"},
+		{"humanize small", humanize, 12.5, "12.5"},
+		{"humanize non-numeric", humanize, "n/a", "n/a"},
+
+		{"bytes zero", humanizeBytes, 0, "0B"},
+		{"bytes gib", humanizeBytes, "10737418240", "10GiB"},
+		{"bytes kib", humanizeBytes, 1536, "1.5KiB"},
+		{"bytes negative", humanizeBytes, -2048, "-2KiB"},
+		{"bytes non-numeric", humanizeBytes, "lots", "lots"},
+
+		{"duration zero", humanizeDuration, 0, "0s"},
+		{"duration hms", humanizeDuration, 3723, "1h2m3s"},
+		{"duration days", humanizeDuration, "90061", "1d1h1m1s"},
+		{"duration minutes", humanizeDuration, 60, "1m0s"},
+		{"duration negative", humanizeDuration, -75, "-1m15s"},
+		{"duration millis", humanizeDuration, 0.25, "250ms"},
+		{"duration non-numeric", humanizeDuration, "soon", "soon"},
+	}
+	for _, tt := range tests {
+		if got := tt.fn(tt.in); got != tt.want {
+			t.Fatalf("%s: got %q want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTimeFuncs(t *testing.T) {
+	start := time.Date(2024, 5, 1, 16, 30, 0, 0, time.UTC)
+	if got := formatTime("2006-01-02 15:04", mustTZ(t, "Asia/Shanghai", start)); got != "2024-05-02 00:30" {
+		t.Fatalf("tz formatTime=%q", got)
+	}
+	if got := formatTime("15:04", "2024-05-01T16:30:00Z"); got != "16:30" {
+		t.Fatalf("string formatTime=%q", got)
+	}
+	if got := formatTime("15:04", time.Time{}); got != "" {
+		t.Fatalf("zero formatTime=%q want empty", got)
+	}
+	if got := formatTime("15:04", "not-a-time"); got != "not-a-time" {
+		t.Fatalf("non-time formatTime=%q", got)
+	}
+	if _, err := tz("Mars/Olympus", start); err == nil {
+		t.Fatalf("expected error for unknown zone")
+	}
+}
+
+func mustTZ(t *testing.T, name string, v any) any {
+	t.Helper()
+	out, err := tz(name, v)
+	if err != nil {
+		t.Fatalf("tz: %v", err)
+	}
+	return out
+}
+
+func TestRender_TimezoneFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "time.tmpl"), []byte(`{{ range .Payload.Alerts }}{{ .StartsAt | toLocal | formatTime "2006-01-02 15:04:05" }}{{ end }}`), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	r, err := NewRenderer(config.TemplateConfig{Dir: dir, Timezone: "Asia/Shanghai"})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	payload := alertmanager.WebhookMessage{
+		Status: "resolved",
+		Alerts: []alertmanager.Alert{{
+			Status:   "resolved",
+			StartsAt: time.Date(2024, 5, 1, 16, 30, 0, 0, time.UTC),
+			EndsAt:   time.Date(2024, 5, 1, 17, 0, 0, 0, time.UTC),
+		}},
+	}
+	out, err := r.Render("time", payload)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if out != "2024-05-02 00:30:00" {
+		t.Fatalf("out=%q", out)
+	}
+
+	out, err = r.Render("default", payload)
+	if err != nil {
+		t.Fatalf("Render default: %v", err)
+	}
+	if !strings.Contains(out, "- **开始时间**: 2024-05-02 00:30:00") || !strings.Contains(out, "- **恢复时间**: 2024-05-02 01:00:00") {
+		t.Fatalf("default template missing times: %q", out)
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain text", "plain text"},
+		{"# heading *bold* _it_ `code`", `\# heading \*bold\* \_it\_ \` + "`code\\`"},
+		{"磁盘 /data 使用率 > 90%", `磁盘 /data 使用率 \> 90%`},
+		{"[link](url)", `\[link\]\(url\)`},
+		{`already \*escaped\*`, `already \*escaped\*`},
+		{`C:\temp`, `C:\\temp`},
+	}
+	for _, tt := range tests {
+		got := escapeMarkdown(tt.in)
+		if got != tt.want {
+			t.Fatalf("escapeMarkdown(%q)=%q want %q", tt.in, got, tt.want)
+		}
+		if again := escapeMarkdown(got); again != got {
+			t.Fatalf("escapeMarkdown not idempotent for %q: %q", tt.in, again)
+		}
+	}
+}
+
+func TestStringFuncs_PreviewMatchesRenderer(t *testing.T) {
+	tpl := `{{ $a := index .Payload.Alerts 0 }}{{ index $a.Labels "instance" | trimSuffix ":9100" | upper }} ` +
+		`{{ .Payload.Receiver | replace "-" " " | title }} {{ join "," (split "/" "a/b/c") }} ` +
+		`{{ if hasPrefix "web" (index $a.Labels "job") }}web{{ end }} {{ "  MiXed " | trim | lower }}`
+	if err := ValidateText(tpl); err != nil {
+		t.Fatalf("ValidateText: %v", err)
+	}
+	payload := alertmanager.WebhookMessage{
+		Receiver: "ops-team",
+		Alerts: []alertmanager.Alert{{
+			Labels: map[string]string{"instance": "host-1:9100", "job": "web-api"},
+		}},
+	}
+	want := "HOST-1 Ops Team a,b,c web mixed"
+
+	preview, err := RenderText(tpl, payload)
+	if err != nil {
+		t.Fatalf("RenderText: %v", err)
+	}
+	if preview != want {
+		t.Fatalf("preview=%q want %q", preview, want)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "strings.tmpl"), []byte(tpl), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	r, err := NewRenderer(config.TemplateConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	out, err := r.Render("strings", payload)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if out != want {
+		t.Fatalf("render=%q want %q", out, want)
+	}
+
+	for _, name := range []string{"env", "expandenv", "readFile", "exec"} {
+		if _, ok := funcMap()[name]; ok {
+			t.Fatalf("unsafe function %q registered", name)
+		}
+	}
+}
+
+func TestRender_DefaultTemplateUsesConfiguredTimeFormat(t *testing.T) {
+	r, err := NewRenderer(config.TemplateConfig{Timezone: "Asia/Shanghai", TimeFormat: "01-02 15:04"})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	payload := alertmanager.WebhookMessage{
+		Status: "resolved",
+		Alerts: []alertmanager.Alert{{
+			Status:   "resolved",
+			StartsAt: time.Date(2024, 5, 1, 16, 30, 0, 0, time.UTC),
+			EndsAt:   time.Date(2024, 5, 1, 17, 0, 0, 0, time.UTC),
+		}},
+	}
+	out, err := r.Render("default", payload)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(out, "- **开始时间**: 05-02 00:30") || !strings.Contains(out, "- **恢复时间**: 05-02 01:00") {
+		t.Fatalf("default template ignored time_format: %q", out)
+	}
+
+	preview, err := r.RenderText(`{{ range .Payload.Alerts }}{{ localTime .StartsAt }}{{ end }}`, payload)
+	if err != nil {
+		t.Fatalf("RenderText: %v", err)
+	}
+	if preview != "05-02 00:30" {
+		t.Fatalf("preview=%q", preview)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"sort"
 	"strings"
 	"text/template"
+	"time"
 
 	"prometheus-dingtalk-hook/internal/alertmanager"
 	"prometheus-dingtalk-hook/internal/config"
@@ -23,26 +24,130 @@ func EmbeddedDefaultText() string {
 	return embeddedDefaultTemplate
 }
 
+// DefaultText returns the default template used when the template directory
+// has no "default.tmpl": template.inline when set, otherwise the embedded one.
+func DefaultText(cfg config.TemplateConfig) string {
+	if strings.TrimSpace(cfg.Inline) != "" {
+		return cfg.Inline
+	}
+	return embeddedDefaultTemplate
+}
+
 type Renderer struct {
 	defaultName string
 	templates   map[string]*template.Template
+	// set holds every template and {{ define }} block of every file, so
+	// previews can call the same partials as the files.
+	set            *template.Template
+	bodyAnnotation string
+	location       *time.Location
+	timeFormat     string
+	trimOutput     bool
+	// labelFields and annotationFields are template.label_fields and
+	// annotation_fields, passed to templates in RenderData.
+	labelFields      []string
+	annotationFields []string
+	sourceLink       bool
+	coalesceFlapping bool
+	// footer is appended to every rendered message; nil when not configured.
+	footer *template.Template
+	// textTitle is the first line of text messages; nil when not configured.
+	textTitle *template.Template
+	// conflicts are the name conflicts resolved by on_name_conflict last_wins.
+	conflicts []string
 }
 
 type RenderData struct {
 	Payload       alertmanager.WebhookMessage
 	FiringCount   int
 	ResolvedCount int
+	// FiringAlerts and ResolvedAlerts are Payload.Alerts split by status, in
+	// payload order, so templates can list them separately.
+	FiringAlerts   []alertmanager.Alert
+	ResolvedAlerts []alertmanager.Alert
+	// Now is the render time, for footers such as "at {{ .Now | toLocal | formatTime "15:04" }}".
+	Now time.Time
+	// Groups partitions Payload.Alerts by the channel's group_by labels, in
+	// order of first appearance. Without group_by it holds a single group
+	// with no labels and every alert, so templates can always range over it.
+	Groups []AlertGroup
+	// LabelFields and AnnotationFields are the labels and annotations the
+	// default template shows per alert, see Fields.
+	LabelFields      []string
+	AnnotationFields []string
+	// ChannelData is the data map of the channel being rendered for; nil
+	// outside a channel, e.g. in previews, where missing keys render as
+	// "<no value>".
+	ChannelData map[string]string
+	// SourceLink is template.source_link: whether the default template
+	// links each alert's GeneratorURL.
+	SourceLink bool
+}
+
+// Channel is the per-channel context a message is rendered with.
+type Channel struct {
+	// GroupBy lists the labels that split the alerts into RenderData.Groups.
+	GroupBy []string
+	// Data is exposed to templates as .ChannelData.
+	Data map[string]string
+}
+
+// AlertGroup is the alerts sharing the same values of the group_by labels.
+type AlertGroup struct {
+	Labels         map[string]string
+	Alerts         []alertmanager.Alert
+	FiringAlerts   []alertmanager.Alert
+	ResolvedAlerts []alertmanager.Alert
+	FiringCount    int
+	ResolvedCount  int
 }
 
+// Button is a link collected from the {{ button "title" "url" }} template
+// directive. It is used by actionCard robots and ignored elsewhere.
+type Button struct {
+	Title string
+	URL   string
+}
+
+// Output is the result of rendering a template.
+type Output struct {
+	Content string
+	Buttons []Button
+	// LinkURL and PicURL come from the {{ link "url" }} and
+	// {{ linkPic "url" }} directives and are used by link robots.
+	LinkURL string
+	PicURL  string
+}
+
+// NewRenderer loads the default template, cfg.Inline or the embedded one,
+// and every "*.tmpl" file in cfg.Dir. A file always takes precedence over
+// the default template, so "default.tmpl" in the directory replaces it. A
+// missing or empty directory, including one emptied by a later import or
+// edit, leaves the default template in place. Subdirectories of cfg.Dir are
+// not read. A template name used twice is resolved by cfg.OnNameConflict.
+//
+// All files share one namespace: a {{ define "header" }} block in any file,
+// e.g. a "partials.tmpl" holding only definitions, can be called from every
+// other file with {{ template "header" . }}.
 func NewRenderer(cfg config.TemplateConfig) (*Renderer, error) {
 	defaultName := "default"
 
-	templates := make(map[string]*template.Template, 8)
-
-	if err := loadTemplateText(templates, "default", embeddedDefaultTemplate); err != nil {
-		return nil, err
+	location := time.Local
+	if name := strings.TrimSpace(cfg.Timezone); name != "" {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("load template timezone: %w", err)
+		}
+		location = loc
 	}
 
+	if strings.TrimSpace(cfg.Inline) != "" {
+		if err := ValidateText(cfg.Inline); err != nil {
+			return nil, fmt.Errorf("template.inline: %w", err)
+		}
+	}
+	files := map[string]string{"default": DefaultText(cfg)}
+	paths := map[string]string{"default": "the default template"}
 	if strings.TrimSpace(cfg.Dir) != "" {
 		entries, err := os.ReadDir(cfg.Dir)
 		if err != nil {
@@ -69,22 +174,60 @@ func NewRenderer(cfg config.TemplateConfig) (*Renderer, error) {
 			if err != nil {
 				return nil, fmt.Errorf("read template: %w", err)
 			}
-			if err := loadTemplateText(templates, base, string(data)); err != nil {
-				return nil, err
-			}
+			files[base] = string(data)
+			paths[base] = path
 		}
 	}
 
+	set, templates, conflicts, err := parseTemplateSet(files, paths, cfg.OnNameConflict == "last_wins")
+	if err != nil {
+		return nil, err
+	}
 	if _, ok := templates[defaultName]; !ok {
 		return nil, fmt.Errorf("default template %q not found", defaultName)
 	}
 
+	var footer *template.Template
+	if strings.TrimSpace(cfg.Footer) != "" {
+		parsed, err := template.New("footer").Funcs(funcMap()).Parse(cfg.Footer)
+		if err != nil {
+			return nil, fmt.Errorf("parse template.footer: %w", err)
+		}
+		footer = parsed
+	}
+	var textTitle *template.Template
+	if strings.TrimSpace(cfg.TextTitle) != "" {
+		parsed, err := template.New("text_title").Funcs(funcMap()).Parse(cfg.TextTitle)
+		if err != nil {
+			return nil, fmt.Errorf("parse template.text_title: %w", err)
+		}
+		textTitle = parsed
+	}
+
 	return &Renderer{
-		defaultName: defaultName,
-		templates:   templates,
+		defaultName:      defaultName,
+		templates:        templates,
+		set:              set,
+		bodyAnnotation:   strings.TrimSpace(cfg.BodyAnnotation),
+		location:         location,
+		timeFormat:       strings.TrimSpace(cfg.TimeFormat),
+		trimOutput:       cfg.TrimOutputEnabled(),
+		labelFields:      cfg.LabelFields,
+		annotationFields: cfg.AnnotationFields,
+		sourceLink:       cfg.SourceLink,
+		coalesceFlapping: cfg.CoalesceFlapping,
+		footer:           footer,
+		textTitle:        textTitle,
+		conflicts:        conflicts,
 	}, nil
 }
 
+// NameConflicts describes the template names defined twice whose last
+// definition won under template.on_name_conflict last_wins.
+func (r *Renderer) NameConflicts() []string {
+	return r.conflicts
+}
+
 func (r *Renderer) DefaultName() string {
 	return r.defaultName
 }
@@ -104,59 +247,246 @@ func (r *Renderer) HasTemplate(name string) bool {
 }
 
 func (r *Renderer) Render(templateName string, payload alertmanager.WebhookMessage) (string, error) {
+	out, err := r.RenderOutput(templateName, payload)
+	if err != nil {
+		return "", err
+	}
+	return out.Content, nil
+}
+
+// RenderOutput renders like Render and also returns the buttons declared by the template.
+func (r *Renderer) RenderOutput(templateName string, payload alertmanager.WebhookMessage) (Output, error) {
+	return r.RenderGrouped(templateName, payload, nil)
+}
+
+// RenderGrouped renders like RenderOutput with the alerts grouped by the
+// groupBy labels in RenderData.Groups.
+func (r *Renderer) RenderGrouped(templateName string, payload alertmanager.WebhookMessage, groupBy []string) (Output, error) {
+	return r.RenderChannel(templateName, payload, Channel{GroupBy: groupBy})
+}
+
+// RenderChannel renders like RenderOutput for the channel ch: the alerts
+// are grouped by ch.GroupBy and ch.Data is available as .ChannelData.
+func (r *Renderer) RenderChannel(templateName string, payload alertmanager.WebhookMessage, ch Channel) (Output, error) {
 	name := strings.TrimSpace(templateName)
 	if name == "" {
 		name = r.defaultName
 	}
 	tmpl, ok := r.templates[name]
 	if !ok {
-		return "", fmt.Errorf("template %q not found", name)
+		return Output{}, fmt.Errorf("template %q not found", name)
+	}
+	if r.coalesceFlapping {
+		payload = coalesceFlapping(payload)
+	}
+	data := r.newRenderData(payload, ch.GroupBy)
+	data.ChannelData = ch.Data
+	if body, ok := annotationBody(r.bodyAnnotation, payload); ok {
+		return r.withFooter(Output{Content: body}, data)
 	}
 
-	var firing, resolved int
-	for _, a := range payload.Alerts {
+	var buttons []Button
+	var linkURL, picURL string
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return Output{}, fmt.Errorf("clone template: %w", err)
+	}
+	tmpl.Funcs(template.FuncMap{
+		"button": func(title, url string) string {
+			title, url = strings.TrimSpace(title), strings.TrimSpace(url)
+			if title != "" && url != "" {
+				buttons = append(buttons, Button{Title: title, URL: url})
+			}
+			return ""
+		},
+		"link": func(url string) string {
+			linkURL = strings.TrimSpace(url)
+			return ""
+		},
+		"linkPic": func(url string) string {
+			picURL = strings.TrimSpace(url)
+			return ""
+		},
+		"toLocal":   toLocalIn(r.location),
+		"localTime": localTimeIn(r.location, r.timeFormat),
+	})
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return Output{}, fmt.Errorf("execute template: %w", err)
+	}
+	content := buf.String()
+	if r.trimOutput {
+		content = strings.TrimSpace(content)
+	}
+	return r.withFooter(Output{
+		Content: content,
+		Buttons: buttons,
+		LinkURL: linkURL,
+		PicURL:  picURL,
+	}, data)
+}
+
+func (r *Renderer) newRenderData(payload alertmanager.WebhookMessage, groupBy []string) RenderData {
+	data := RenderData{
+		Payload:          payload,
+		Now:              time.Now(),
+		Groups:           groupAlerts(payload.Alerts, groupBy),
+		LabelFields:      r.labelFields,
+		AnnotationFields: r.annotationFields,
+		SourceLink:       r.sourceLink,
+	}
+	if len(data.LabelFields) == 0 && len(data.AnnotationFields) == 0 {
+		data.LabelFields, data.AnnotationFields = defaultLabelFields, defaultAnnotationFields
+	}
+	data.FiringAlerts, data.ResolvedAlerts = splitStatus(payload.Alerts)
+	data.FiringCount, data.ResolvedCount = len(data.FiringAlerts), len(data.ResolvedAlerts)
+	return data
+}
+
+func splitStatus(alerts []alertmanager.Alert) (firing, resolved []alertmanager.Alert) {
+	for _, a := range alerts {
 		switch strings.ToLower(a.Status) {
 		case "firing":
-			firing++
+			firing = append(firing, a)
 		case "resolved":
-			resolved++
+			resolved = append(resolved, a)
+		}
+	}
+	return firing, resolved
+}
+
+func newAlertGroup(labels map[string]string, alerts []alertmanager.Alert) AlertGroup {
+	g := AlertGroup{Labels: labels, Alerts: alerts}
+	g.FiringAlerts, g.ResolvedAlerts = splitStatus(alerts)
+	g.FiringCount, g.ResolvedCount = len(g.FiringAlerts), len(g.ResolvedAlerts)
+	return g
+}
+
+// groupAlerts splits alerts by their values of the groupBy labels, keeping
+// the order in which each group first appears.
+func groupAlerts(alerts []alertmanager.Alert, groupBy []string) []AlertGroup {
+	if len(groupBy) == 0 {
+		return []AlertGroup{newAlertGroup(nil, alerts)}
+	}
+	var groups []AlertGroup
+	index := make(map[string]int)
+	for _, a := range alerts {
+		labels := make(map[string]string, len(groupBy))
+		values := make([]string, 0, len(groupBy))
+		for _, name := range groupBy {
+			labels[name] = a.Labels[name]
+			values = append(values, a.Labels[name])
 		}
+		key := strings.Join(values, "\xff")
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, AlertGroup{Labels: labels})
+		}
+		groups[i].Alerts = append(groups[i].Alerts, a)
+	}
+	for i := range groups {
+		groups[i] = newAlertGroup(groups[i].Labels, groups[i].Alerts)
+	}
+	return groups
+}
+
+// withFooter appends the rendered template.footer to out, separated by a
+// blank line. Mentions are added later by the sender, after the footer.
+func (r *Renderer) withFooter(out Output, data RenderData) (Output, error) {
+	if r.footer == nil {
+		return out, nil
+	}
+	footer, err := r.executeSnippet(r.footer, data)
+	if err != nil {
+		return Output{}, err
+	}
+	if footer != "" {
+		out.Content += "\n\n" + footer
+	}
+	return out, nil
+}
+
+// RenderTextTitle renders template.text_title for the channel ch, with the
+// same data as RenderChannel. It returns "" when no text title is
+// configured. Line breaks are folded so the title stays a single line.
+func (r *Renderer) RenderTextTitle(payload alertmanager.WebhookMessage, ch Channel) (string, error) {
+	if r.textTitle == nil {
+		return "", nil
+	}
+	if r.coalesceFlapping {
+		payload = coalesceFlapping(payload)
+	}
+	data := r.newRenderData(payload, ch.GroupBy)
+	data.ChannelData = ch.Data
+	title, err := r.executeSnippet(r.textTitle, data)
+	if err != nil {
+		return "", err
 	}
+	return strings.Join(strings.Fields(title), " "), nil
+}
 
+// executeSnippet runs a footer or text title template and returns its
+// output with surrounding whitespace removed.
+func (r *Renderer) executeSnippet(t *template.Template, data RenderData) (string, error) {
+	tmpl, err := t.Clone()
+	if err != nil {
+		return "", fmt.Errorf("clone %s: %w", t.Name(), err)
+	}
+	tmpl.Funcs(template.FuncMap{
+		"toLocal":   toLocalIn(r.location),
+		"localTime": localTimeIn(r.location, r.timeFormat),
+	})
 	buf := new(bytes.Buffer)
-	if err := tmpl.Execute(buf, RenderData{
-		Payload:       payload,
-		FiringCount:   firing,
-		ResolvedCount: resolved,
-	}); err != nil {
-		return "", fmt.Errorf("execute template: %w", err)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("execute %s: %w", t.Name(), err)
 	}
 	return strings.TrimSpace(buf.String()), nil
 }
 
 func RenderText(tplText string, payload alertmanager.WebhookMessage) (string, error) {
-	tmpl := template.New("preview").Funcs(template.FuncMap{
-		"default": defaultString,
-		"kv":      formatKV,
-	})
+	return (&Renderer{trimOutput: true}).RenderText(tplText, payload)
+}
+
+// RenderText renders tplText with the settings of r, such as its timezone
+// and output trimming, so previews match what r would send.
+// The text may call the partials defined by r's template files.
+func (r *Renderer) RenderText(tplText string, payload alertmanager.WebhookMessage) (string, error) {
+	// "_preview" is not a valid file name, so it cannot shadow a file.
+	tmpl := template.New("_preview").Funcs(funcMap())
+	if r.set != nil {
+		set, err := r.set.Clone()
+		if err != nil {
+			return "", fmt.Errorf("clone templates: %w", err)
+		}
+		tmpl = set.New("_preview")
+	}
 	parsed, err := tmpl.Parse(tplText)
 	if err != nil {
 		return "", fmt.Errorf("parse template: %w", err)
 	}
-	r := &Renderer{
-		defaultName: "preview",
+	preview := &Renderer{
+		defaultName: "_preview",
 		templates: map[string]*template.Template{
-			"preview": parsed,
+			"_preview": parsed,
 		},
+		location:   r.location,
+		timeFormat: r.timeFormat,
+		trimOutput: r.trimOutput,
+		footer:     r.footer,
+
+		labelFields:      r.labelFields,
+		annotationFields: r.annotationFields,
+		sourceLink:       r.sourceLink,
+		coalesceFlapping: r.coalesceFlapping,
 	}
-	return r.Render("preview", payload)
+	return preview.Render("_preview", payload)
 }
 
 func ValidateText(tplText string) error {
-	tmpl := template.New("validate").Funcs(template.FuncMap{
-		"default": defaultString,
-		"kv":      formatKV,
-	})
+	tmpl := template.New("validate").Funcs(funcMap())
 	_, err := tmpl.Parse(tplText)
 	if err != nil {
 		return fmt.Errorf("parse template: %w", err)
@@ -164,20 +494,108 @@ func ValidateText(tplText string) error {
 	return nil
 }
 
-func loadTemplateText(dst map[string]*template.Template, name, tplText string) error {
-	if strings.TrimSpace(name) == "" {
-		return errors.New("template name is empty")
+// annotationBody returns the preformatted body carried in the given
+// annotation: the common annotation when set, otherwise the per-alert values
+// joined together when every alert carries one.
+func annotationBody(key string, payload alertmanager.WebhookMessage) (string, bool) {
+	if key == "" {
+		return "", false
 	}
-	tmpl := template.New(name).Funcs(template.FuncMap{
+	if v := strings.TrimSpace(payload.CommonAnnotations[key]); v != "" {
+		return v, true
+	}
+	if len(payload.Alerts) == 0 {
+		return "", false
+	}
+	parts := make([]string, 0, len(payload.Alerts))
+	for _, a := range payload.Alerts {
+		v := strings.TrimSpace(a.Annotations[key])
+		if v == "" {
+			return "", false
+		}
+		parts = append(parts, v)
+	}
+	return strings.Join(parts, "\n\n---\n\n"), true
+}
+
+// parseTemplateSet parses the template files, keyed by name, into one
+// namespace and returns it with the template of each file. A name defined
+// twice, by two {{ define }} blocks or by a block and a file, is an error
+// naming both files from paths, unless lastWins is set: then the file
+// parsed last, in name order, wins and the conflict is returned.
+func parseTemplateSet(files, paths map[string]string, lastWins bool) (*template.Template, map[string]*template.Template, []string, error) {
+	where := func(name string) string {
+		if p, ok := paths[name]; ok {
+			return p
+		}
+		return name
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	set := template.New("").Funcs(funcMap())
+	var conflicts []string
+	definedIn := make(map[string]string)
+	for _, name := range names {
+		definedIn[name] = name
+	}
+	for _, name := range names {
+		parsed, err := template.New(name).Funcs(funcMap()).Parse(files[name])
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("parse template %q: %w", name, err)
+		}
+		for _, t := range parsed.Templates() {
+			if t.Tree == nil {
+				continue
+			}
+			if file, ok := definedIn[t.Name()]; ok && file != name {
+				if !lastWins {
+					return nil, nil, nil, fmt.Errorf("parse template %q: template %q is already defined by %s (in %s)", name, t.Name(), where(file), where(name))
+				}
+				conflicts = append(conflicts, fmt.Sprintf("template %q: %s replaces the definition in %s", t.Name(), where(name), where(file)))
+			}
+			definedIn[t.Name()] = name
+			if _, err := set.AddParseTree(t.Name(), t.Tree); err != nil {
+				return nil, nil, nil, fmt.Errorf("parse template %q: %w", name, err)
+			}
+		}
+	}
+
+	templates := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		templates[name] = set.Lookup(name)
+	}
+	return set, templates, conflicts, nil
+}
+
+// funcMap returns the functions available to every template. NewRenderer,
+// RenderText and ValidateText all use it so previews behave like production.
+func funcMap() template.FuncMap {
+	funcs := template.FuncMap{
 		"default": defaultString,
 		"kv":      formatKV,
-	})
-	parsed, err := tmpl.Parse(tplText)
-	if err != nil {
-		return fmt.Errorf("parse template %q: %w", name, err)
+		"button":  func(string, string) string { return "" },
+		"link":    func(string) string { return "" },
+		"linkPic": func(string) string { return "" },
+
+		"humanize":         humanize,
+		"humanizeBytes":    humanizeBytes,
+		"humanizeDuration": humanizeDuration,
+
+		"toLocal":    toLocalIn(time.Local),
+		"tz":         tz,
+		"formatTime": formatTime,
+		"localTime":  localTimeIn(time.Local, DefaultTimeFormat),
+
+		"escapeMarkdown": escapeMarkdown,
 	}
-	dst[name] = parsed
-	return nil
+	for name, fn := range stringFuncs() {
+		funcs[name] = fn
+	}
+	return funcs
 }
 
 func defaultString(fallback string, v any) string {
@@ -1,8 +1,11 @@
 package template
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"prometheus-dingtalk-hook/internal/alertmanager"
 	"prometheus-dingtalk-hook/internal/config"
@@ -59,3 +62,556 @@ func TestNewRenderer_DirEmptyFallbackToEmbeddedDefault(t *testing.T) {
 		t.Fatalf("missing embedded default template")
 	}
 }
+
+func TestNewRenderer_FileDefaultOverridesEmbedded(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "default.tmpl")
+	if err := os.WriteFile(path, []byte("custom {{ .Payload.Status }}"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	r, err := NewRenderer(config.TemplateConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	out, err := r.Render("default", alertmanager.WebhookMessage{Status: "firing"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if out != "custom firing" {
+		t.Fatalf("out=%q want file template", out)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	r, err = NewRenderer(config.TemplateConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewRenderer after remove: %v", err)
+	}
+	out, err = r.Render("default", alertmanager.WebhookMessage{Status: "firing"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(out, "### 🔥 告警触发") {
+		t.Fatalf("out=%q want embedded default", out)
+	}
+}
+
+func TestRenderOutput_CollectsButtons(t *testing.T) {
+	dir := t.TempDir()
+	tpl := `{{ button "Grafana" "https://grafana.example/d/x" }}# {{ .Payload.Status }}
+body{{ button "" "https://ignored.example" }}`
+	if err := os.WriteFile(filepath.Join(dir, "card.tmpl"), []byte(tpl), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	r, err := NewRenderer(config.TemplateConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+
+	out, err := r.RenderOutput("card", alertmanager.WebhookMessage{Status: "firing"})
+	if err != nil {
+		t.Fatalf("RenderOutput: %v", err)
+	}
+	if out.Content != "# firing\nbody" {
+		t.Fatalf("content=%q", out.Content)
+	}
+	if len(out.Buttons) != 1 || out.Buttons[0].Title != "Grafana" || out.Buttons[0].URL != "https://grafana.example/d/x" {
+		t.Fatalf("buttons=%+v", out.Buttons)
+	}
+}
+
+func TestRender_BodyAnnotationOverridesTemplate(t *testing.T) {
+	r, err := NewRenderer(config.TemplateConfig{BodyAnnotation: "dingtalk_message"})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+
+	payload := alertmanager.WebhookMessage{
+		Status: "firing",
+		Alerts: []alertmanager.Alert{
+			{Status: "firing", Annotations: map[string]string{"dingtalk_message": "**disk** full on a"}},
+			{Status: "firing", Annotations: map[string]string{"dingtalk_message": "**disk** full on b"}},
+		},
+	}
+	out, err := r.Render("", payload)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if out != "**disk** full on a\n\n---\n\n**disk** full on b" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+
+	payload.Alerts[1].Annotations = nil
+	out, err = r.Render("", payload)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(out, "### 🔥 告警触发") {
+		t.Fatalf("expected template fallback, got %q", out)
+	}
+}
+
+func TestRender_TrimOutputDisabledPreservesWhitespace(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "exact.tmpl"), []byte("\n    code block\n\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	r, err := NewRenderer(config.TemplateConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	if out, _ := r.Render("exact", alertmanager.WebhookMessage{}); out != "code block" {
+		t.Fatalf("default out=%q want trimmed", out)
+	}
+
+	keep := false
+	r, err = NewRenderer(config.TemplateConfig{Dir: dir, TrimOutput: &keep})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	if out, _ := r.Render("exact", alertmanager.WebhookMessage{}); out != "\n    code block\n\n" {
+		t.Fatalf("out=%q want whitespace preserved", out)
+	}
+	if out, _ := r.RenderText("\n  x\n", alertmanager.WebhookMessage{}); out != "\n  x\n" {
+		t.Fatalf("preview out=%q want whitespace preserved", out)
+	}
+}
+
+func TestRender_FooterWithCounts(t *testing.T) {
+	r, err := NewRenderer(config.TemplateConfig{
+		Footer:         `Firing: {{ .FiringCount }} | Resolved: {{ .ResolvedCount }} | at {{ .Now | toLocal | formatTime "15:04" }}`,
+		Timezone:       "UTC",
+		BodyAnnotation: "body",
+	})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	payload := alertmanager.WebhookMessage{
+		Status: "firing",
+		Alerts: []alertmanager.Alert{
+			{Status: "firing"}, {Status: "firing"}, {Status: "firing"}, {Status: "resolved"},
+		},
+	}
+	out, err := r.Render("", payload)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	idx := strings.LastIndex(out, "\n\nFiring: 3 | Resolved: 1 | at ")
+	if idx < 0 || !strings.HasPrefix(out, "### 🔥 告警触发（3）") {
+		t.Fatalf("out=%q", out)
+	}
+
+	payload.CommonAnnotations = map[string]string{"body": "custom body"}
+	out, err = r.Render("", payload)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.HasPrefix(out, "custom body\n\nFiring: 3 | Resolved: 1 | at ") {
+		t.Fatalf("annotation body out=%q", out)
+	}
+
+	if _, err := NewRenderer(config.TemplateConfig{Footer: "{{ .Broken"}); err == nil || !strings.Contains(err.Error(), "template.footer") {
+		t.Fatalf("err=%v want footer parse error", err)
+	}
+}
+
+func TestRenderGrouped_DefaultTemplateGroupHeaders(t *testing.T) {
+	r, err := NewRenderer(config.TemplateConfig{})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+
+	alert := func(name, cluster string) alertmanager.Alert {
+		return alertmanager.Alert{Status: "firing", Labels: map[string]string{"alertname": name, "cluster": cluster}}
+	}
+	payload := alertmanager.WebhookMessage{
+		Status: "firing",
+		Alerts: []alertmanager.Alert{alert("A", "prod"), alert("B", "dev"), alert("C", "prod")},
+	}
+
+	out, err := r.RenderGrouped("", payload, []string{"cluster"})
+	if err != nil {
+		t.Fatalf("RenderGrouped: %v", err)
+	}
+	prod := strings.Index(out.Content, "#### cluster=prod（2）")
+	dev := strings.Index(out.Content, "#### cluster=dev（1）")
+	if prod < 0 || dev < 0 || prod > dev {
+		t.Fatalf("unexpected group headers: %q", out.Content)
+	}
+
+	flat, err := r.RenderOutput("", payload)
+	if err != nil {
+		t.Fatalf("RenderOutput: %v", err)
+	}
+	if strings.Contains(flat.Content, "####") {
+		t.Fatalf("ungrouped output has group headers: %q", flat.Content)
+	}
+}
+
+func TestRenderGrouped_GroupsData(t *testing.T) {
+	dir := t.TempDir()
+	body := `{{ range .Groups }}[{{ index .Labels "env" }}:{{ len .Alerts }}/{{ .FiringCount }}/{{ .ResolvedCount }}]{{ end }}`
+	if err := os.WriteFile(filepath.Join(dir, "groups.tmpl"), []byte(body), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	r, err := NewRenderer(config.TemplateConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	payload := alertmanager.WebhookMessage{
+		Alerts: []alertmanager.Alert{
+			{Status: "firing", Labels: map[string]string{"env": "a"}},
+			{Status: "resolved", Labels: map[string]string{"env": "b"}},
+			{Status: "resolved", Labels: map[string]string{"env": "a"}},
+			{Status: "firing"},
+		},
+	}
+
+	out, err := r.RenderGrouped("groups", payload, []string{"env"})
+	if err != nil {
+		t.Fatalf("RenderGrouped: %v", err)
+	}
+	if out.Content != "[a:2/1/1][b:1/0/1][:1/1/0]" {
+		t.Fatalf("content=%q", out.Content)
+	}
+}
+
+func TestRender_DefaultTemplateResolvedSection(t *testing.T) {
+	r, err := NewRenderer(config.TemplateConfig{})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+
+	out, err := r.Render("", alertmanager.WebhookMessage{
+		Status: "firing",
+		Alerts: []alertmanager.Alert{
+			{Status: "firing", Labels: map[string]string{"alertname": "DiskFull"}},
+			{Status: "resolved", Labels: map[string]string{"alertname": "HighCPU"}, Annotations: map[string]string{"summary": "cpu back to normal"}},
+			{Status: "firing", Labels: map[string]string{"alertname": "DiskFull"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(out, "### 🔥 告警触发（2）") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+	resolved := strings.Index(out, "#### ✅ 已恢复（1）\n- HighCPU：cpu back to normal")
+	if resolved < 0 {
+		t.Fatalf("missing resolved section: %q", out)
+	}
+	if strings.Contains(out[:resolved], "cpu back to normal") {
+		t.Fatalf("resolved alert listed with firing alerts: %q", out)
+	}
+}
+
+func TestRender_FiringAndResolvedAlerts(t *testing.T) {
+	dir := t.TempDir()
+	body := `{{ range .FiringAlerts }}F:{{ index .Labels "n" }} {{ end }}{{ range .ResolvedAlerts }}R:{{ index .Labels "n" }} {{ end }}`
+	if err := os.WriteFile(filepath.Join(dir, "split.tmpl"), []byte(body), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	r, err := NewRenderer(config.TemplateConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+
+	out, err := r.Render("split", alertmanager.WebhookMessage{Alerts: []alertmanager.Alert{
+		{Status: "resolved", Labels: map[string]string{"n": "1"}},
+		{Status: "firing", Labels: map[string]string{"n": "2"}},
+		{Status: "FIRING", Labels: map[string]string{"n": "3"}},
+	}})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if out != "F:2 F:3 R:1" {
+		t.Fatalf("content=%q", out)
+	}
+}
+
+func TestRender_DefaultTemplateCustomFields(t *testing.T) {
+	r, err := NewRenderer(config.TemplateConfig{
+		LabelFields:      []string{"instance", "severity"},
+		AnnotationFields: []string{"summary", "runbook_url", "dashboard"},
+	})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+
+	out, err := r.Render("default", alertmanager.WebhookMessage{
+		Status:       "firing",
+		CommonLabels: map[string]string{"severity": "critical"},
+		Alerts: []alertmanager.Alert{{
+			Status:      "firing",
+			Labels:      map[string]string{"instance": "db-1:9100"},
+			Annotations: map[string]string{"summary": "disk full", "runbook_url": "https://runbooks/disk", "description": "not shown"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	want := "- **instance**: `db-1:9100`\n- **严重度**: `critical`\n- **摘要**: disk full\n- **runbook_url**: https://runbooks/disk"
+	if !strings.Contains(out, want) {
+		t.Fatalf("fields not rendered in order, want %q in:\n%s", want, out)
+	}
+	if strings.Contains(out, "not shown") || strings.Contains(out, "dashboard") {
+		t.Fatalf("unlisted or missing fields rendered:\n%s", out)
+	}
+}
+
+func TestRender_DefaultTemplateSourceLink(t *testing.T) {
+	payload := alertmanager.WebhookMessage{
+		Status: "firing",
+		Alerts: []alertmanager.Alert{
+			{Status: "firing", Labels: map[string]string{"alertname": "A"}, GeneratorURL: "http://prom:9090/graph?g0.expr=up"},
+			{Status: "firing", Labels: map[string]string{"alertname": "B"}},
+		},
+	}
+	link := "- **来源**: [查看表达式](http://prom:9090/graph?g0.expr=up)"
+
+	r, err := NewRenderer(config.TemplateConfig{SourceLink: true})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	out, err := r.Render("default", payload)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(out, link) || strings.Count(out, "来源") != strings.Count(out, link) {
+		t.Fatalf("want source links only for the alert that has a generatorURL:\n%s", out)
+	}
+
+	// A single alert goes through the summary branch of the template.
+	single := payload
+	single.Alerts = payload.Alerts[:1]
+	if out, err = r.Render("default", single); err != nil || !strings.Contains(out, link) {
+		t.Fatalf("single alert: err=%v\n%s", err, out)
+	}
+
+	off, err := NewRenderer(config.TemplateConfig{})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	if out, err = off.Render("default", payload); err != nil || strings.Contains(out, "来源") {
+		t.Fatalf("source link rendered without template.source_link: err=%v\n%s", err, out)
+	}
+}
+
+func TestRenderChannel_ChannelData(t *testing.T) {
+	dir := t.TempDir()
+	body := `{{ .ChannelData.team }}: {{ .Payload.Status }}{{ with index .ChannelData "runbook" }} ({{ . }}){{ end }}`
+	if err := os.WriteFile(filepath.Join(dir, "team.tmpl"), []byte(body), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	r, err := NewRenderer(config.TemplateConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	payload := alertmanager.WebhookMessage{Status: "firing"}
+
+	out, err := r.RenderChannel("team", payload, Channel{Data: map[string]string{"team": "payments", "runbook": "wiki/pay"}})
+	if err != nil {
+		t.Fatalf("RenderChannel: %v", err)
+	}
+	if out.Content != "payments: firing (wiki/pay)" {
+		t.Fatalf("content=%q", out.Content)
+	}
+
+	out, err = r.RenderChannel("team", payload, Channel{Data: map[string]string{"team": "infra"}})
+	if err != nil {
+		t.Fatalf("RenderChannel: %v", err)
+	}
+	if out.Content != "infra: firing" {
+		t.Fatalf("content=%q", out.Content)
+	}
+}
+
+func TestNewRenderer_SharedPartials(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"partials.tmpl": `{{ define "header" }}## {{ .Payload.Status }}{{ end }}{{ define "footer" }}-- {{ .ChannelData.team }}{{ end }}`,
+		"default.tmpl":  `{{ template "header" . }} default`,
+		"ops.tmpl":      `{{ template "header" . }} ops {{ template "footer" . }}`,
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	r, err := NewRenderer(config.TemplateConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	payload := alertmanager.WebhookMessage{Status: "firing"}
+
+	if out, err := r.Render("", payload); err != nil || out != "## firing default" {
+		t.Fatalf("default=%q err=%v", out, err)
+	}
+	out, err := r.RenderChannel("ops", payload, Channel{Data: map[string]string{"team": "sre"}})
+	if err != nil || out.Content != "## firing ops -- sre" {
+		t.Fatalf("ops=%q err=%v", out.Content, err)
+	}
+	if r.HasTemplate("header") {
+		t.Fatalf("define block listed as a template: %v", r.TemplateNames())
+	}
+
+	// Previews of an edited file see the same partials.
+	if err := ValidateText(`{{ template "header" . }} edited`); err != nil {
+		t.Fatalf("ValidateText: %v", err)
+	}
+	preview, err := r.RenderText(`{{ template "header" . }} edited`, payload)
+	if err != nil || preview != "## firing edited" {
+		t.Fatalf("preview=%q err=%v", preview, err)
+	}
+}
+
+func TestNewRenderer_DuplicateDefine(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"a.tmpl": `{{ define "header" }}a{{ end }}`,
+		"b.tmpl": `{{ define "header" }}b{{ end }}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	_, err := NewRenderer(config.TemplateConfig{Dir: dir})
+	if err == nil || !strings.Contains(err.Error(), `"header" is already defined by `+filepath.Join(dir, "a.tmpl")+" (in "+filepath.Join(dir, "b.tmpl")+")") {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestNewRenderer_NameConflict(t *testing.T) {
+	dir := t.TempDir()
+	// alert.tmpl is shadowed by the {{ define "alert" }} in partials.tmpl,
+	// which sorts after it.
+	for name, body := range map[string]string{
+		"alert.tmpl":    `from file`,
+		"partials.tmpl": `{{ define "alert" }}from define{{ end }}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	_, err := NewRenderer(config.TemplateConfig{Dir: dir})
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(dir, "alert.tmpl")) || !strings.Contains(err.Error(), filepath.Join(dir, "partials.tmpl")) {
+		t.Fatalf("err=%v want both paths", err)
+	}
+
+	r, err := NewRenderer(config.TemplateConfig{Dir: dir, OnNameConflict: "last_wins"})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	out, err := r.Render("alert", alertmanager.WebhookMessage{})
+	if err != nil || out != "from define" {
+		t.Fatalf("out=%q err=%v", out, err)
+	}
+	if got := r.NameConflicts(); len(got) != 1 || !strings.Contains(got[0], `template "alert"`) {
+		t.Fatalf("NameConflicts=%v", got)
+	}
+}
+
+func TestRenderChannel_CoalesceFlapping(t *testing.T) {
+	dir := t.TempDir()
+	body := `{{ .Payload.Status }}{{ range .Payload.Alerts }} {{ .Labels.alertname }}={{ .Status }}{{ end }}`
+	if err := os.WriteFile(filepath.Join(dir, "list.tmpl"), []byte(body), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	payload := alertmanager.WebhookMessage{
+		Status: "firing",
+		Alerts: []alertmanager.Alert{
+			{Status: "firing", Fingerprint: "a1", Labels: map[string]string{"alertname": "A"}, StartsAt: start},
+			{Status: "firing", Fingerprint: "b1", Labels: map[string]string{"alertname": "B"}, StartsAt: start},
+			{Status: "resolved", Fingerprint: "a1", Labels: map[string]string{"alertname": "A"}, StartsAt: start, EndsAt: start.Add(time.Minute)},
+		},
+	}
+
+	r, err := NewRenderer(config.TemplateConfig{Dir: dir, CoalesceFlapping: true})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	out, err := r.RenderChannel("list", payload, Channel{})
+	if err != nil {
+		t.Fatalf("RenderChannel: %v", err)
+	}
+	if out.Content != "firing A=resolved B=firing" {
+		t.Fatalf("content=%q", out.Content)
+	}
+
+	// Once the flapping alert fires again after resolving, firing wins and
+	// the payload stays firing even without other alerts.
+	refired := payload
+	refired.Alerts = []alertmanager.Alert{
+		payload.Alerts[2],
+		{Status: "firing", Fingerprint: "a1", Labels: map[string]string{"alertname": "A"}, StartsAt: start.Add(2 * time.Minute)},
+	}
+	if out, err = r.RenderChannel("list", refired, Channel{}); err != nil || out.Content != "firing A=firing" {
+		t.Fatalf("refired: err=%v content=%q", err, out.Content)
+	}
+
+	// Without a fingerprint the labels identify the alert; a resolved entry
+	// left alone turns the payload status to resolved.
+	nofp := payload
+	nofp.Alerts = []alertmanager.Alert{
+		{Status: "firing", Labels: map[string]string{"alertname": "A"}, StartsAt: start},
+		{Status: "resolved", Labels: map[string]string{"alertname": "A"}, StartsAt: start, EndsAt: start.Add(time.Minute)},
+	}
+	if out, err = r.RenderChannel("list", nofp, Channel{}); err != nil || out.Content != "resolved A=resolved" {
+		t.Fatalf("no fingerprint: err=%v content=%q", err, out.Content)
+	}
+
+	off, err := NewRenderer(config.TemplateConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	if out, err = off.RenderChannel("list", payload, Channel{}); err != nil || out.Content != "firing A=firing B=firing A=resolved" {
+		t.Fatalf("without coalesce_flapping: err=%v content=%q", err, out.Content)
+	}
+}
+
+func TestNewRenderer_InlineDefault(t *testing.T) {
+	payload := alertmanager.WebhookMessage{Status: "firing"}
+	inline := `inline: {{ .Payload.Status }}`
+
+	r, err := NewRenderer(config.TemplateConfig{Inline: inline})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	if out, err := r.Render("default", payload); err != nil || out != "inline: firing" {
+		t.Fatalf("inline default: err=%v out=%q", err, out)
+	}
+
+	// Directory templates load alongside it, and a default.tmpl wins.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "other.tmpl"), []byte(`other`), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	r, err = NewRenderer(config.TemplateConfig{Dir: dir, Inline: inline})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	if out, err := r.Render("default", payload); err != nil || out != "inline: firing" {
+		t.Fatalf("inline default with dir: err=%v out=%q", err, out)
+	}
+	if out, err := r.Render("other", payload); err != nil || out != "other" {
+		t.Fatalf("dir template: err=%v out=%q", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "default.tmpl"), []byte(`file`), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	r, err = NewRenderer(config.TemplateConfig{Dir: dir, Inline: inline})
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	if out, err := r.Render("default", payload); err != nil || out != "file" {
+		t.Fatalf("default.tmpl over inline: err=%v out=%q", err, out)
+	}
+
+	if _, err := NewRenderer(config.TemplateConfig{Inline: `{{ .Payload.Status `}); err == nil || !strings.Contains(err.Error(), "template.inline") {
+		t.Fatalf("want template.inline parse error, got %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"prometheus-dingtalk-hook/internal/alertmanager"
+	"prometheus-dingtalk-hook/internal/config"
+)
+
+// MissingFields lists the required labels and annotations that payload does
+// not provide. A field counts as present for an alert when the alert or the
+// common labels/annotations carry a non-empty value; a payload without
+// alerts is checked against the common maps only.
+func MissingFields(req config.TemplateRequirement, payload alertmanager.WebhookMessage) []string {
+	var out []string
+	check := func(kind string, names []string, common map[string]string, perAlert func(alertmanager.Alert) map[string]string) {
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			if strings.TrimSpace(common[name]) != "" {
+				continue
+			}
+			if len(payload.Alerts) == 0 {
+				out = append(out, fmt.Sprintf("%s %q is missing", kind, name))
+				continue
+			}
+			var missing int
+			for _, a := range payload.Alerts {
+				if strings.TrimSpace(perAlert(a)[name]) == "" {
+					missing++
+				}
+			}
+			if missing > 0 {
+				out = append(out, fmt.Sprintf("%s %q is missing in %d of %d alerts", kind, name, missing, len(payload.Alerts)))
+			}
+		}
+	}
+	check("label", req.Labels, payload.CommonLabels, func(a alertmanager.Alert) map[string]string { return a.Labels })
+	check("annotation", req.Annotations, payload.CommonAnnotations, func(a alertmanager.Alert) map[string]string { return a.Annotations })
+	return out
+}